@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/0Mattias/earthmc-scraper/internal/fakeapi"
+)
+
+// fakeearthmc serves a local stand-in for the EarthMC API and live map so the
+// scrapers can be developed offline. Point the worker at it with
+// EARTHMC_API_URL=http://localhost:8090/v3/aurora and
+// EARTHMC_MAP_URL=http://localhost:8090/tiles/players.json.
+func main() {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	})))
+
+	var (
+		addr     = flag.String("addr", ":8090", "listen address")
+		prefix   = flag.String("prefix", "/v3/aurora", "API path prefix")
+		fixtures = flag.String("fixtures", "", "directory of JSON fixtures (server.json, towns.json, ...); generates data when empty")
+		seed     = flag.Uint64("seed", 1, "random seed for generated data")
+		players  = flag.Int("players", 2000, "number of generated players")
+		towns    = flag.Int("towns", 300, "number of generated towns")
+		nations  = flag.Int("nations", 40, "number of generated nations")
+		online   = flag.Float64("online-ratio", 0.1, "fraction of generated players online")
+		visible  = flag.Float64("visible-ratio", 0.6, "fraction of online players visible on the map")
+	)
+	flag.Parse()
+
+	var world *fakeapi.World
+	if *fixtures != "" {
+		var err error
+		world, err = fakeapi.LoadFixtures(*fixtures)
+		if err != nil {
+			slog.Error("failed to load fixtures", "dir", *fixtures, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("loaded fixtures", "dir", *fixtures)
+	} else {
+		world = fakeapi.Generate(fakeapi.GenerateOptions{
+			Seed:         *seed,
+			NumPlayers:   *players,
+			NumTowns:     *towns,
+			NumNations:   *nations,
+			OnlineRatio:  *online,
+			VisibleRatio: *visible,
+		})
+		slog.Info("generated world", "players", *players, "towns", *towns, "nations", *nations)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: world.Handler(*prefix),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("fake earthmc listening", "addr", *addr, "prefix", *prefix)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("server failed", "error", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/0Mattias/earthmc-scraper/internal/config"
+	"github.com/0Mattias/earthmc-scraper/internal/maintenance"
+)
+
+const backfillUsage = "backfill dimensions [--server=NAME]"
+
+// runBackfill rebuilds derived tables from the snapshot history.
+func runBackfill(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "dimensions" {
+		return errors.New("usage: worker " + backfillUsage)
+	}
+
+	fs := newFlagSet("backfill", backfillUsage)
+	servers := fs.String("server", "", "comma-separated servers to backfill (default: all configured)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	targets, err := selectServers(cfg, *servers)
+	if err != nil {
+		return err
+	}
+
+	pool, err := connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	for _, target := range targets {
+		counts, err := maintenance.BackfillDimensions(ctx, pool, target.Name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", target.Name, err)
+		}
+		fmt.Printf("%s: players=%d towns=%d nations=%d\n",
+			target.Name, counts["players"], counts["towns"], counts["nations"])
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0Mattias/earthmc-scraper/internal/config"
+	"github.com/0Mattias/earthmc-scraper/internal/db"
+)
+
+const benchUsage = "bench [--rows=N] [--runs=N]"
+
+// runBench times the bulk write paths against the multi-row VALUES
+// statements they replaced, built as the scraper built them. Everything is
+// written to temporary tables on one connection, so it is safe to run
+// against production.
+func runBench(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("bench", benchUsage)
+	n := fs.Int("rows", 5000, "rows per batch")
+	runs := fs.Int("runs", 5, "timed runs per method")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *n <= 0 || *runs <= 0 {
+		return errors.New("--rows and --runs must be positive")
+	}
+	if most := maxBindParams / len(benchActivityColumns); *n > most {
+		// The old activity insert wrote a whole tick as one statement.
+		return fmt.Errorf("--rows must be at most %d, the most one VALUES statement of activity can bind", most)
+	}
+
+	pool, err := connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	for _, stmt := range []string{
+		"CREATE TEMP TABLE bench_activity AS SELECT " + strings.Join(benchActivityColumns, ", ") + " FROM player_activity WITH NO DATA",
+		"CREATE TEMP TABLE bench_players AS SELECT " + strings.Join(benchPlayerColumns, ", ") + " FROM players WITH NO DATA",
+		"ALTER TABLE bench_players ADD PRIMARY KEY (server_id, uuid)",
+	} {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("create bench tables: %w", err)
+		}
+	}
+
+	ts := time.Now()
+	activity := make([][]any, *n)
+	players := make([][]any, *n)
+	for i := range *n {
+		uuid := fmt.Sprintf("00000000-0000-0000-0000-%012d", i)
+		name := fmt.Sprintf("bench%d", i)
+		x, y, z, yaw, world := i%20000-10000, 64, i%15000-7500, i%360, "earth"
+		activity[i] = []any{"bench", ts, uuid, name, true, true, &x, &y, &z, &yaw, &world, true}
+		players[i] = []any{"bench", uuid, name, ts, ts}
+	}
+	// Half the upserted keys already exist, so both branches are exercised.
+	seed := players[:*n/2]
+	const upsertSuffix = " ON CONFLICT (server_id, uuid) DO UPDATE SET name = EXCLUDED.name, last_seen = EXCLUDED.last_seen"
+	merge := db.Merge{
+		Table:    "bench_players",
+		Columns:  benchPlayerColumns,
+		Conflict: []string{"server_id", "uuid"},
+		Update:   []string{"name", "last_seen"},
+	}
+
+	cases := []struct {
+		name, method string
+		reset        string
+		seed         [][]any
+		write        func() error
+	}{
+		{"activity insert", "values", "bench_activity", nil, func() error {
+			return insertValues(ctx, conn, "bench_activity", benchActivityColumns, activity, len(activity), "")
+		}},
+		{"activity insert", "copy", "bench_activity", nil, func() error {
+			_, err := db.CopyRows(ctx, conn, "bench_activity", benchActivityColumns, activity)
+			return err
+		}},
+		{"dimension upsert", "values", "bench_players", seed, func() error {
+			return insertValues(ctx, conn, "bench_players", benchPlayerColumns, players, valuesChunk, upsertSuffix)
+		}},
+		{"dimension upsert", "copy+merge", "bench_players", seed, func() error {
+			_, err := merge.Run(ctx, conn, players, nil)
+			return err
+		}},
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "case\tmethod\trows\tbest\tmean\trows/s")
+	for _, c := range cases {
+		var best, total time.Duration
+		for range *runs {
+			if _, err := conn.Exec(ctx, "TRUNCATE "+c.reset); err != nil {
+				return err
+			}
+			if _, err := db.CopyRows(ctx, conn, c.reset, benchPlayerColumns, c.seed); err != nil {
+				return err
+			}
+			start := time.Now()
+			if err := c.write(); err != nil {
+				return fmt.Errorf("%s (%s): %w", c.name, c.method, err)
+			}
+			d := time.Since(start)
+			total += d
+			if best == 0 || d < best {
+				best = d
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%.0f\n", c.name, c.method, *n,
+			best.Round(time.Microsecond), (total / time.Duration(*runs)).Round(time.Microsecond),
+			float64(*n)/best.Seconds())
+	}
+	return w.Flush()
+}
+
+var (
+	benchActivityColumns = []string{
+		"server_id", "snapshot_ts", "player_uuid", "player_name", "is_online", "is_visible",
+		"x", "y", "z", "yaw", "world", "is_keyframe",
+	}
+	benchPlayerColumns = []string{"server_id", "uuid", "name", "first_seen", "last_seen"}
+)
+
+const (
+	// maxBindParams is the most parameters one PostgreSQL statement takes.
+	maxBindParams = 65535
+	// valuesChunk is how many rows the low-freq upserts put in one
+	// statement before COPY.
+	valuesChunk = 500
+)
+
+// insertValues is the multi-row INSERT ... VALUES the scraper used before
+// COPY, built the same way: a fmt.Sprintf placeholder group per row and
+// chunkSize rows per statement. The high-freq loop wrote a tick's activity
+// as one statement; the low-freq upserts went in chunks of valuesChunk.
+func insertValues(ctx context.Context, conn *pgxpool.Conn, table string, cols []string, rows [][]any, chunkSize int, suffix string) error {
+	for i := 0; i < len(rows); i += chunkSize {
+		chunk := rows[i:min(i+chunkSize, len(rows))]
+
+		var sb strings.Builder
+		sb.WriteString(fmt.Sprintf("INSERT INTO %s (%s) VALUES ", table, strings.Join(cols, ", ")))
+		args := make([]any, 0, len(chunk)*len(cols))
+		placeholders := make([]string, len(cols))
+		for j, r := range chunk {
+			if j > 0 {
+				sb.WriteString(",")
+			}
+			base := j * len(cols)
+			for k := range cols {
+				placeholders[k] = fmt.Sprintf("$%d", base+k+1)
+			}
+			sb.WriteString(fmt.Sprintf("(%s)", strings.Join(placeholders, ",")))
+			args = append(args, r...)
+		}
+		sb.WriteString(suffix)
+
+		if _, err := conn.Exec(ctx, sb.String(), args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
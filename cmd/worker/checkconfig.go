@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/0Mattias/earthmc-scraper/internal/config"
+)
+
+const checkConfigUsage = "check-config [--ping]"
+
+// runCheckConfig prints the resolved configuration. config.Load has already
+// validated it by the time this runs; --ping also checks that the database
+// and every server's API answer.
+func runCheckConfig(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("check-config", checkConfigUsage)
+	ping := fs.Bool("ping", false, "connect to the database and fetch each server's status")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if cfg.CloudSQLConnectionName != "" {
+		fmt.Fprintf(w, "database\tcloudsql:%s db=%s user=%s\n", cfg.CloudSQLConnectionName, cfg.DBName, cfg.DBUser)
+	} else {
+		fmt.Fprintf(w, "database\t%s:%d db=%s user=%s\n", cfg.DBHost, cfg.DBPort, cfg.DBName, cfg.DBUser)
+	}
+	fmt.Fprintf(w, "pool max\t%d\n", cfg.DBPoolMax)
+	fmt.Fprintf(w, "user agent\t%s\n", cfg.UserAgent)
+	fmt.Fprintf(w, "api rate\t%g/s burst %d\n", cfg.APIRateLimit, cfg.APIRateBurst)
+	fmt.Fprintf(w, "map rate\t%g/s burst %d\n", cfg.MapRateLimit, cfg.MapRateBurst)
+	fmt.Fprintf(w, "batches\t%d concurrent, %d retries\n", cfg.BatchConcurrency, cfg.BatchRetries)
+	if cfg.RecordDir != "" {
+		fmt.Fprintf(w, "record dir\t%s\n", cfg.RecordDir)
+	}
+	if cfg.ReplayDir != "" {
+		fmt.Fprintf(w, "replay dir\t%s\n", cfg.ReplayDir)
+	}
+	fmt.Fprintf(w, "session grace\t%s\n", cfg.SessionGrace)
+	fmt.Fprintf(w, "keyframe interval\t%s\n", cfg.KeyframeInterval)
+	fmt.Fprintf(w, "raw retention\t%s (pass every %s)\n", cfg.ActivityRawRetention, cfg.RetentionInterval)
+	if cfg.ActivityArchiveDir != "" {
+		fmt.Fprintf(w, "archive dir\t%s\n", cfg.ActivityArchiveDir)
+	}
+	if cfg.SpoolDir != "" {
+		fmt.Fprintf(w, "spool dir\t%s (max %d MiB)\n", cfg.SpoolDir, cfg.SpoolMaxBytes>>20)
+	}
+	fmt.Fprintf(w, "port\t%d\n", cfg.Port)
+	fmt.Fprintf(w, "query timeout\t%s\n", cfg.QueryTimeout)
+	for _, t := range cfg.Servers {
+		mapURL := t.MapURL
+		if mapURL == "" {
+			mapURL = "(none)"
+		}
+		fmt.Fprintf(w, "server %s\tapi=%s map=%s high=%s low=%s\n",
+			t.Name, t.APIBaseURL, mapURL, t.HighFreqInterval, t.LowFreqInterval)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !*ping {
+		return nil
+	}
+
+	var errs []error
+	pool, err := connect(ctx, cfg)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		pool.Close()
+		fmt.Println("database: ok")
+	}
+
+	clientOpts, err := clientOptions(cfg)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, t := range cfg.Servers {
+		srv, err := newClient(t, clientOpts).GetServer(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s api: %w", t.Name, err))
+			continue
+		}
+		fmt.Printf("%s api: ok (version %s, %d online)\n", t.Name, srv.Version, srv.Stats.NumOnlinePlayers)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/0Mattias/earthmc-scraper/internal/config"
+	"github.com/0Mattias/earthmc-scraper/internal/maintenance"
+)
+
+const exportUsage = "export --table=NAME [--server=NAME] [--from=T] [--to=T] [--format=csv|jsonl] [--out=FILE]"
+
+// runExport writes rows of one table to stdout or a file.
+func runExport(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("export", exportUsage)
+	table := fs.String("table", "", "table or view to export")
+	server := fs.String("server", "", "only rows for this server")
+	from := fs.String("from", "", "only rows at or after this time (RFC 3339 or YYYY-MM-DD)")
+	to := fs.String("to", "", "only rows before this time (RFC 3339 or YYYY-MM-DD)")
+	format := fs.String("format", "csv", "csv or jsonl")
+	out := fs.String("out", "", "output file (default: stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *table == "" {
+		fs.Usage()
+		return errors.New("--table is required")
+	}
+
+	q := maintenance.ExportQuery{Table: *table, Server: *server, Format: *format}
+	var err error
+	if q.From, err = parseTime(*from); err != nil {
+		return fmt.Errorf("--from: %w", err)
+	}
+	if q.To, err = parseTime(*to); err != nil {
+		return fmt.Errorf("--to: %w", err)
+	}
+
+	pool, err := connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	if *out == "" {
+		return maintenance.Export(ctx, pool, os.Stdout, q)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := maintenance.Export(ctx, pool, f, q); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseTime accepts RFC 3339 timestamps or bare UTC dates; empty is zero.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
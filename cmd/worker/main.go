@@ -2,26 +2,85 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/0Mattias/earthmc-scraper/internal/api"
 	"github.com/0Mattias/earthmc-scraper/internal/config"
 	"github.com/0Mattias/earthmc-scraper/internal/db"
-	"github.com/0Mattias/earthmc-scraper/internal/health"
+	"github.com/0Mattias/earthmc-scraper/internal/maintenance"
 	"github.com/0Mattias/earthmc-scraper/internal/scraper"
+	"github.com/0Mattias/earthmc-scraper/internal/spool"
 )
 
+// command is one worker subcommand. Every command shares config.Load and the
+// signal-aware context; run is the default when none is given, so the
+// container's plain entrypoint keeps scraping.
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx context.Context, cfg *config.Config, args []string) error
+}
+
+var commands = []command{
+	{"run", "run", "migrate, then scrape every configured server until stopped (default)", runWorker},
+	{"migrate", migrateUsage, "apply, revert or list schema migrations", runMigrate},
+	{"scrape-once", scrapeOnceUsage, "run a single scrape and exit", runScrapeOnce},
+	{"backfill", backfillUsage, "rebuild derived tables from stored snapshots", runBackfill},
+	{"export", exportUsage, "write rows of a table to CSV or JSON lines", runExport},
+	{"partitions", partitionsUsage, "manage hourly player_activity partitions", runPartitions},
+	{"restore", restoreUsage, "re-attach an archived player_activity hour", runRestore},
+	{"bench", benchUsage, "time COPY-based bulk writes against multi-row INSERTs", runBench},
+	{"serve", serveUsage, "serve the read-only JSON API until stopped", runServe},
+	{"mcp", mcpUsage, "serve read-only MCP tools for the AI agent over stdio or HTTP", runMCP},
+	{"check-config", checkConfigUsage, "print the resolved configuration and optionally test connectivity", runCheckConfig},
+}
+
 func main() {
-	// Structured JSON logging for Cloud Run
-	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+	name, args := "run", os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			usage(os.Stdout)
+			return
+		}
+		name, args = args[0], args[1:]
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	// Structured JSON logging for Cloud Run. One-off commands log to stderr
+	// so their stdout output (exports, status tables) stays clean.
+	logOut := os.Stdout
+	if cmd.name != "run" && cmd.name != "serve" {
+		logOut = os.Stderr
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(logOut, &slog.HandlerOptions{
 		Level: slog.LevelInfo,
 	})))
 
-	slog.Info("earthmc-scraper starting")
-
 	// Load config
 	cfg, err := config.Load()
 	if err != nil {
@@ -41,56 +100,148 @@ func main() {
 		cancel()
 	}()
 
-	// Connect to database
-	pool, err := db.Connect(ctx, cfg.DSN())
-	if err != nil {
-		slog.Error("failed to connect to database", "error", err)
+	if err := cmd.run(ctx, cfg, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		slog.Error(cmd.name+" failed", "error", err)
+		cancel()
 		os.Exit(1)
 	}
-	defer pool.Close()
+}
 
-	// Run migrations
-	if err := db.Migrate(ctx, pool); err != nil {
-		slog.Error("failed to run migrations", "error", err)
-		os.Exit(1)
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: worker <command> [flags]")
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  worker %s\n", c.usage)
 	}
+}
 
-	// Create API client
-	client := api.NewClient()
+// newFlagSet returns a flag set that reports errors instead of exiting.
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: worker %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
 
-	// Create health server
-	healthSrv := health.NewServer(pool, cfg.Port)
+// connect opens the database pool. Only commands that connect with the
+// worker's own role need DB_PASSWORD; mcp has its own connection string.
+func connect(ctx context.Context, cfg *config.Config) (*pgxpool.Pool, error) {
+	if cfg.DBPassword == "" {
+		return nil, errors.New("DB_PASSWORD is required")
+	}
+	pool, err := db.Connect(ctx, cfg.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	return pool, nil
+}
 
-	// Create scrapers
-	highFreq := scraper.NewHighFreq(client, pool, cfg.HighFreqInterval)
-	lowFreq := scraper.NewLowFreq(client, pool, cfg.LowFreqInterval)
+// clientOptions builds the API client options shared by every server; the
+// clients all draw from the same per-host rate limits.
+func clientOptions(cfg *config.Config) ([]api.Option, error) {
+	opts := []api.Option{
+		api.WithUserAgent(cfg.UserAgent),
+		api.WithAPIRateLimit(cfg.APIRateLimit, cfg.APIRateBurst),
+		api.WithMapRateLimit(cfg.MapRateLimit, cfg.MapRateBurst),
+		api.WithLimits(api.NewLimits()),
+		api.WithBatchConcurrency(cfg.BatchConcurrency),
+		api.WithBatchRetries(cfg.BatchRetries),
+	}
+	if cfg.RecordDir != "" {
+		slog.Info("recording API fixtures", "dir", cfg.RecordDir)
+		opts = append(opts, api.WithRecorder(cfg.RecordDir))
+	}
+	if cfg.ReplayDir != "" {
+		replay, err := api.NewReplayTransport(cfg.ReplayDir)
+		if err != nil {
+			return nil, fmt.Errorf("load replay fixtures: %w", err)
+		}
+		opts = append(opts, api.WithHTTPClient(&http.Client{Transport: replay}))
+	}
+	return opts, nil
+}
 
-	// Launch all goroutines
-	errCh := make(chan error, 3)
+// newClient creates the API client for one server.
+func newClient(target config.Target, shared []api.Option) *api.Client {
+	opts := append([]api.Option{
+		api.WithBaseURL(target.APIBaseURL),
+		api.WithMapURL(target.MapURL),
+	}, shared...)
+	return api.NewClient(opts...)
+}
 
-	go func() {
-		errCh <- healthSrv.Start(ctx)
-	}()
+// highFreqOptions returns the high-freq scraper settings for one server.
+func highFreqOptions(cfg *config.Config, target config.Target, sp *spool.Spool, claims *scraper.ClaimIndex) scraper.HighFreqOptions {
+	return scraper.HighFreqOptions{
+		Interval:         target.HighFreqInterval,
+		SessionGrace:     cfg.SessionGrace,
+		KeyframeInterval: cfg.KeyframeInterval,
+		Spool:            sp,
+		Claims:           claims,
+	}
+}
 
-	go func() {
-		highFreq.Run(ctx)
-		errCh <- nil
-	}()
+// openSpool opens the write spool, or returns nil when SPOOL_DIR is unset.
+// Only the long-running worker uses it: two processes must not share one.
+func openSpool(cfg *config.Config) (*spool.Spool, error) {
+	if cfg.SpoolDir == "" {
+		return nil, nil
+	}
+	return spool.Open(cfg.SpoolDir, cfg.SpoolMaxBytes)
+}
 
-	go func() {
-		lowFreq.Run(ctx)
-		errCh <- nil
-	}()
+// newArchiver returns the partition archiver, or nil when
+// ACTIVITY_ARCHIVE_DIR is unset.
+func newArchiver(pool *pgxpool.Pool, cfg *config.Config) (*maintenance.Archiver, error) {
+	if cfg.ActivityArchiveDir == "" {
+		return nil, nil
+	}
+	sink, err := maintenance.NewDirSink(cfg.ActivityArchiveDir)
+	if err != nil {
+		return nil, err
+	}
+	return maintenance.NewArchiver(pool, sink), nil
+}
 
-	// Wait for first error or context cancellation
-	select {
-	case err := <-errCh:
-		if err != nil {
-			slog.Error("component failed", "error", err)
-			cancel()
-		}
-	case <-ctx.Done():
+// serverNames returns the names of the configured servers, in order.
+func serverNames(cfg *config.Config) []string {
+	names := make([]string, len(cfg.Servers))
+	for i, t := range cfg.Servers {
+		names[i] = t.Name
 	}
+	return names
+}
 
-	slog.Info("earthmc-scraper shutdown complete")
+// selectServers returns the configured targets named in a comma-separated
+// list, or all of them when the list is empty.
+func selectServers(cfg *config.Config, list string) ([]config.Target, error) {
+	if list == "" {
+		return cfg.Servers, nil
+	}
+	var out []config.Target
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, t := range cfg.Servers {
+			if t.Name == name {
+				out = append(out, t)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("server %q is not in EARTHMC_SERVERS", name)
+		}
+	}
+	return out, nil
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/0Mattias/earthmc-scraper/internal/config"
+	"github.com/0Mattias/earthmc-scraper/internal/db"
+	"github.com/0Mattias/earthmc-scraper/internal/mcp"
+)
+
+const mcpUsage = "mcp [--http=PORT [--listen=HOST]] [--rows=N] [--timeout=D]"
+
+// runMCP serves the MCP tools for the site's AI agent, over stdio unless
+// --http is given. It connects with MCP_DATABASE_URL rather than the
+// worker's credentials, since run_readonly_sql takes arbitrary SQL.
+func runMCP(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("mcp", mcpUsage)
+	port := fs.Int("http", 0, "serve MCP over HTTP at /mcp on this port instead of stdio")
+	listen := fs.String("listen", "127.0.0.1", "host to bind with --http")
+	rows := fs.Int("rows", 500, "most rows a tool call returns")
+	timeout := fs.Duration("timeout", cfg.QueryTimeout, "longest a tool call's queries may run (default: QUERY_TIMEOUT)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *rows < 1 {
+		return errors.New("--rows must be positive")
+	}
+	if *timeout <= 0 {
+		return errors.New("--timeout must be positive")
+	}
+
+	if cfg.MCPDatabaseURL == "" {
+		return errors.New("MCP_DATABASE_URL is required: point it at a role that can only SELECT")
+	}
+	if *port != 0 && cfg.MCPToken == "" {
+		return errors.New("MCP_TOKEN is required with --http")
+	}
+
+	pool, err := db.Connect(ctx, cfg.MCPDatabaseURL)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+	defer pool.Close()
+
+	srv := mcp.NewServer(pool, serverNames(cfg), *timeout, *rows)
+	if *port != 0 {
+		return srv.RunHTTP(ctx, net.JoinHostPort(*listen, strconv.Itoa(*port)), cfg.MCPToken)
+	}
+	return srv.RunStdio(ctx, os.Stdin, os.Stdout)
+}
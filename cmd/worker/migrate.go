@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/0Mattias/earthmc-scraper/internal/config"
+	"github.com/0Mattias/earthmc-scraper/internal/db"
+)
+
+const migrateUsage = "migrate up | down [N] | status"
+
+// runMigrate implements `worker migrate up|down [N]|status`.
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: worker " + migrateUsage)
+	}
+
+	pool, err := connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	switch args[0] {
+	case "up":
+		return db.Migrate(ctx, pool)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+		}
+		return db.MigrateDown(ctx, pool, steps)
+
+	case "status":
+		states, err := db.MigrationStatus(ctx, pool)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED\tNOTE")
+		for _, s := range states {
+			applied, note := "pending", ""
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+			}
+			if s.Modified {
+				note = "checksum mismatch"
+			} else if s.Down == "" {
+				note = "no down file"
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", s.Version, s.Name, applied, note)
+		}
+		return w.Flush()
+
+	default:
+		return errors.New("usage: worker " + migrateUsage)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/0Mattias/earthmc-scraper/internal/config"
+	"github.com/0Mattias/earthmc-scraper/internal/maintenance"
+)
+
+const partitionsUsage = "partitions ensure [--hours=N] | list | rollup [--hour=T] | prune --older-than=DURATION [--dry-run]"
+
+// runPartitions manages the hourly player_activity partitions.
+func runPartitions(ctx context.Context, cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: worker " + partitionsUsage)
+	}
+
+	fs := newFlagSet("partitions", partitionsUsage)
+	hours := fs.Int("hours", 720, "ensure: hours ahead to create")
+	hour := fs.String("hour", "", "rollup: re-summarise this hour (RFC 3339) instead of every pending one")
+	olderThan := fs.Duration("older-than", 0, "prune: roll up, archive, then drop partitions whose hour ended more than this long ago")
+	dryRun := fs.Bool("dry-run", false, "prune: list what would be dropped")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	pool, err := connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	switch args[0] {
+	case "ensure":
+		if err := maintenance.EnsurePartitions(ctx, pool, *hours); err != nil {
+			return err
+		}
+		fmt.Printf("ensured partitions for the next %d hours\n", *hours)
+		return nil
+
+	case "list":
+		parts, err := maintenance.ListPartitions(ctx, pool)
+		if err != nil {
+			return err
+		}
+		for _, p := range parts {
+			fmt.Printf("%s\t%s\t%s\n", p.Name, p.Start.UTC().Format(time.RFC3339), p.End.UTC().Format(time.RFC3339))
+		}
+		return nil
+
+	case "rollup":
+		if *hour != "" {
+			t, err := time.Parse(time.RFC3339, *hour)
+			if err != nil {
+				return fmt.Errorf("--hour: %w", err)
+			}
+			rows, err := maintenance.RollupHour(ctx, pool, t.Truncate(time.Hour))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("rolled up %s (%d raw rows)\n", t.Truncate(time.Hour).UTC().Format(time.RFC3339), rows)
+			return nil
+		}
+		n, err := maintenance.RollupPending(ctx, pool, time.Now(), math.MaxInt)
+		fmt.Printf("rolled up %d hours\n", n)
+		return err
+
+	case "prune":
+		// Refuse a zero duration: it would drop the current hour.
+		if *olderThan <= 0 {
+			return errors.New("prune requires --older-than, e.g. --older-than=336h")
+		}
+		archive, err := newArchiver(pool, cfg)
+		if err != nil {
+			return err
+		}
+		pruned, err := maintenance.PrunePartitions(ctx, pool, time.Now().Add(-*olderThan), archive, *dryRun)
+		for _, p := range pruned {
+			if *dryRun {
+				fmt.Println("would drop", p.Name)
+			} else {
+				fmt.Println("dropped", p.Name)
+			}
+		}
+		return err
+
+	default:
+		return errors.New("usage: worker " + partitionsUsage)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/0Mattias/earthmc-scraper/internal/config"
+)
+
+const restoreUsage = "restore --hour=T [--keep=DURATION]"
+
+// runRestore loads an archived hour back into player_activity.
+func runRestore(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("restore", restoreUsage)
+	hour := fs.String("hour", "", "hour to restore (RFC 3339), e.g. 2026-02-28T15:00:00Z")
+	keep := fs.Duration("keep", 7*24*time.Hour, "how long retention leaves the restored partition in place")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *hour == "" {
+		fs.Usage()
+		return errors.New("--hour is required")
+	}
+	t, err := time.Parse(time.RFC3339, *hour)
+	if err != nil {
+		return fmt.Errorf("--hour: %w", err)
+	}
+
+	pool, err := connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	archive, err := newArchiver(pool, cfg)
+	if err != nil {
+		return err
+	}
+	if archive == nil {
+		return errors.New("ACTIVITY_ARCHIVE_DIR is not set")
+	}
+
+	arc, err := archive.Restore(ctx, t.Truncate(time.Hour), time.Now().Add(*keep))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %s (%d rows) from %s\n", arc.Partition, arc.Rows, arc.Location)
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/0Mattias/earthmc-scraper/internal/config"
+	"github.com/0Mattias/earthmc-scraper/internal/db"
+	"github.com/0Mattias/earthmc-scraper/internal/health"
+	"github.com/0Mattias/earthmc-scraper/internal/maintenance"
+	"github.com/0Mattias/earthmc-scraper/internal/scraper"
+)
+
+// runWorker is the long-running scraper: migrate, then a high/low-freq loop
+// pair per EarthMC server plus the health server and retention job.
+func runWorker(ctx context.Context, cfg *config.Config, _ []string) error {
+	slog.Info("earthmc-scraper starting")
+
+	// Connect to database
+	pool, err := connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	// Run migrations
+	if err := db.Migrate(ctx, pool); err != nil {
+		return err
+	}
+
+	clientOpts, err := clientOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	sp, err := openSpool(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Create health server
+	healthSrv := health.NewServer(pool, cfg.Port)
+	healthSrv.SetSpool(sp)
+
+	// Launch all goroutines: the health server, the retention job and a
+	// high/low-freq pair per EarthMC server
+	errCh := make(chan error, 2+2*len(cfg.Servers))
+
+	go func() {
+		errCh <- healthSrv.Start(ctx)
+	}()
+
+	archive, err := newArchiver(pool, cfg)
+	if err != nil {
+		return err
+	}
+	retention := maintenance.NewRetention(pool, cfg.ActivityRawRetention, cfg.RetentionInterval, archive)
+	go func() {
+		retention.Run(ctx)
+		errCh <- nil
+	}()
+
+	for _, target := range cfg.Servers {
+		client := newClient(target, clientOpts)
+		claims := scraper.NewClaimIndex()
+
+		highFreq := scraper.NewHighFreq(target.Name, client, pool, highFreqOptions(cfg, target, sp, claims))
+		lowFreq := scraper.NewLowFreq(target.Name, client, pool, scraper.LowFreqOptions{
+			Interval: target.LowFreqInterval,
+			Spool:    sp,
+			Claims:   claims,
+		})
+		slog.Info("scraping server", "server", target.Name, "api", target.APIBaseURL, "map", target.MapURL)
+
+		go func() {
+			highFreq.Run(ctx)
+			errCh <- nil
+		}()
+
+		go func() {
+			lowFreq.Run(ctx)
+			errCh <- nil
+		}()
+	}
+
+	// Wait for first error or context cancellation
+	select {
+	case err := <-errCh:
+		if err != nil {
+			slog.Error("component failed", "error", err)
+		}
+	case <-ctx.Done():
+	}
+
+	slog.Info("earthmc-scraper shutdown complete")
+	return nil
+}
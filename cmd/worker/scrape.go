@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/0Mattias/earthmc-scraper/internal/config"
+	"github.com/0Mattias/earthmc-scraper/internal/db"
+	"github.com/0Mattias/earthmc-scraper/internal/scraper"
+)
+
+const scrapeOnceUsage = "scrape-once [--server=NAME] [--only=STEPS]"
+
+// runScrapeOnce runs one scrape per selected server and exits. --only takes
+// low-freq steps and/or "online" for the high-freq sample.
+func runScrapeOnce(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("scrape-once", scrapeOnceUsage)
+	servers := fs.String("server", "", "comma-separated servers to scrape (default: all configured)")
+	only := fs.String("only", "", "comma-separated steps: online,"+strings.Join(scraper.LowFreqSteps, ",")+" (default: all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	targets, err := selectServers(cfg, *servers)
+	if err != nil {
+		return err
+	}
+
+	online, steps := true, scraper.LowFreqSteps
+	if *only != "" {
+		online, steps = false, nil
+		for _, step := range strings.Split(*only, ",") {
+			step = strings.TrimSpace(step)
+			switch {
+			case step == "online":
+				online = true
+			case slices.Contains(scraper.LowFreqSteps, step):
+				steps = append(steps, step)
+			default:
+				return fmt.Errorf("unknown step %q", step)
+			}
+		}
+	}
+
+	pool, err := connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	if err := db.Migrate(ctx, pool); err != nil {
+		return err
+	}
+
+	clientOpts, err := clientOptions(cfg)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, target := range targets {
+		client := newClient(target, clientOpts)
+		if online {
+			hf := scraper.NewHighFreq(target.Name, client, pool, highFreqOptions(cfg, target, nil, nil))
+			if err := hf.ScrapeOnce(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("%s online: %w", target.Name, err))
+			}
+		}
+		if len(steps) > 0 {
+			lf := scraper.NewLowFreq(target.Name, client, pool, scraper.LowFreqOptions{Interval: target.LowFreqInterval})
+			if err := lf.ScrapeOnce(ctx, steps...); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
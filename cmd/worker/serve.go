@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/0Mattias/earthmc-scraper/internal/config"
+	"github.com/0Mattias/earthmc-scraper/internal/httpapi"
+)
+
+const serveUsage = "serve [--port=N] [--timeout=D]"
+
+// runServe serves the read-only JSON API over the scraped data. It does not
+// scrape or migrate, so it can run as its own service next to the worker.
+func runServe(ctx context.Context, cfg *config.Config, args []string) error {
+	fs := newFlagSet("serve", serveUsage)
+	port := fs.Int("port", cfg.Port, "port to listen on (default: PORT)")
+	timeout := fs.Duration("timeout", cfg.QueryTimeout, "longest a request's queries may run (default: QUERY_TIMEOUT)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *timeout <= 0 {
+		return errors.New("--timeout must be positive")
+	}
+
+	pool, err := connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	return httpapi.NewServer(pool, *port, serverNames(cfg), *timeout).Start(ctx)
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// WithBatchConcurrency sets how many batched POSTs may be in flight at once.
+func WithBatchConcurrency(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.batchConcurrency = n
+		}
+	}
+}
+
+// WithBatchRetries sets how many extra passes are made over batches that
+// still failed after the per-request retries.
+func WithBatchRetries(n int) Option {
+	return func(c *Client) {
+		if n >= 0 {
+			c.batchRetries = n
+		}
+	}
+}
+
+// BatchResult is the outcome of a batched POST: every entity that was
+// fetched, plus the UUID ranges that could not be.
+type BatchResult struct {
+	Results []json.RawMessage
+	Failed  []FailedBatch
+}
+
+// FailedBatch is one batch that failed on every attempt.
+type FailedBatch struct {
+	// Start and End index into the UUIDs passed to the Post* call.
+	Start, End int
+	UUIDs      []string
+	Err        error
+}
+
+// FailedUUIDs returns the UUIDs of every failed batch, in request order.
+func (r *BatchResult) FailedUUIDs() []string {
+	var out []string
+	for _, f := range r.Failed {
+		out = append(out, f.UUIDs...)
+	}
+	return out
+}
+
+// Err summarises the failed batches, or returns nil if there were none.
+func (r *BatchResult) Err() error {
+	if len(r.Failed) == 0 {
+		return nil
+	}
+	errs := make([]error, len(r.Failed))
+	for i, f := range r.Failed {
+		errs[i] = fmt.Errorf("batch %d-%d: %w", f.Start, f.End, f.Err)
+	}
+	return errors.Join(errs...)
+}
+
+// batchPost sends POST requests in batches of batchSize, up to
+// batchConcurrency at a time. A failing batch does not affect the others;
+// it is retried in a later pass and reported in Failed if it never succeeds.
+// The returned error is non-nil only if ctx is cancelled.
+func (c *Client) batchPost(ctx context.Context, url string, uuids []string) (*BatchResult, error) {
+	type batch struct {
+		start, end int
+		results    []json.RawMessage
+		err        error
+	}
+
+	var batches []*batch
+	for i := 0; i < len(uuids); i += batchSize {
+		batches = append(batches, &batch{start: i, end: min(i+batchSize, len(uuids))})
+	}
+
+	pending := batches
+	for pass := 0; pass <= c.batchRetries && len(pending) > 0; pass++ {
+		if pass > 0 {
+			slog.Warn("retrying failed batches", "url", url, "pass", pass, "batches", len(pending))
+		}
+
+		var g errgroup.Group
+		g.SetLimit(c.batchConcurrency)
+		for _, b := range pending {
+			g.Go(func() error {
+				body := PostQuery{Query: uuids[b.start:b.end]}
+				var results []json.RawMessage
+				b.err = c.doPost(ctx, url, body, &results)
+				if b.err == nil {
+					b.results = results
+				}
+				return nil
+			})
+		}
+		_ = g.Wait()
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var failed []*batch
+		for _, b := range pending {
+			if b.err != nil {
+				failed = append(failed, b)
+			}
+		}
+		pending = failed
+	}
+
+	res := &BatchResult{}
+	for _, b := range batches {
+		if b.err != nil {
+			res.Failed = append(res.Failed, FailedBatch{
+				Start: b.start,
+				End:   b.end,
+				UUIDs: uuids[b.start:b.end],
+				Err:   b.err,
+			})
+			continue
+		}
+		res.Results = append(res.Results, b.results...)
+	}
+	return res, nil
+}
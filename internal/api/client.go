@@ -8,23 +8,83 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 )
 
 const (
-	baseURL    = "https://api.earthmc.net/v3/aurora"
-	mapBaseURL = "https://map.earthmc.net/tiles/players.json"
-	batchSize  = 100
+	// APIRoot is the v3 API; each server's root is below it.
+	APIRoot = "https://api.earthmc.net/v3"
+	// DefaultBaseURL is the Aurora v3 API root.
+	DefaultBaseURL = APIRoot + "/aurora"
+	// DefaultMapURL is the live map's player positions file.
+	DefaultMapURL = "https://map.earthmc.net/tiles/players.json"
+	// DefaultUserAgent is sent with every request unless overridden.
+	DefaultUserAgent = "earthmc-scraper"
+
+	batchSize = 100
+
+	defaultBatchConcurrency = 4
+	defaultBatchRetries     = 1
+
+	// defaultRateLimitPause is how long to back off after a 429 that carries
+	// no usable Retry-After header.
+	defaultRateLimitPause = 10 * time.Second
 )
 
 // Client wraps HTTP calls to the EarthMC API and map.
 type Client struct {
-	http *http.Client
+	http      *http.Client
+	baseURL   string
+	mapURL    string
+	userAgent string
+	recordDir string
+
+	batchConcurrency int
+	batchRetries     int
+
+	apiLimit *rateSpec
+	mapLimit *rateSpec
+	limits   *Limits
+
+	etags *etagCache
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithBaseURL overrides the API root (e.g. a staging mirror or a local fake).
+func WithBaseURL(url string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(url, "/")
+	}
+}
+
+// WithMapURL overrides the URL of the map's players.json. An empty URL
+// disables map fetches.
+func WithMapURL(url string) Option {
+	return func(c *Client) {
+		c.mapURL = url
+	}
+}
+
+// WithHTTPClient replaces the underlying HTTP client.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) {
+		c.userAgent = ua
+	}
 }
 
 // NewClient creates a new API client with sensible timeouts.
-func NewClient() *Client {
-	return &Client{
+func NewClient(opts ...Option) *Client {
+	c := &Client{
 		http: &http.Client{
 			Timeout: 60 * time.Second,
 			Transport: &http.Transport{
@@ -33,7 +93,18 @@ func NewClient() *Client {
 				IdleConnTimeout:     90 * time.Second,
 			},
 		},
+		baseURL:          DefaultBaseURL,
+		mapURL:           DefaultMapURL,
+		userAgent:        DefaultUserAgent,
+		batchConcurrency: defaultBatchConcurrency,
+		batchRetries:     defaultBatchRetries,
+		etags:            newETagCache(),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	c.buildLimiters()
+	return c
 }
 
 // ---- GET helpers ----
@@ -51,11 +122,21 @@ func (c *Client) doPost(ctx context.Context, url string, body interface{}, out i
 }
 
 func (c *Client) doWithRetry(ctx context.Context, method, url string, body []byte, out interface{}) error {
-	var lastErr error
+	lim := c.limiterFor(url)
+	prio := priorityFrom(ctx)
+	st := statsFrom(ctx)
+
+	var (
+		lastErr error
+		pause   time.Duration // server-requested delay when there is no limiter to hold it
+	)
 	for attempt := 0; attempt < 3; attempt++ {
 		if attempt > 0 {
 			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
+			backoff = max(backoff, pause)
+			pause = 0
 			slog.Debug("retrying request", "attempt", attempt+1, "backoff", backoff, "url", url)
+			st.retries.Add(1)
 			select {
 			case <-time.After(backoff):
 			case <-ctx.Done():
@@ -63,6 +144,14 @@ func (c *Client) doWithRetry(ctx context.Context, method, url string, body []byt
 			}
 		}
 
+		if lim != nil {
+			waitStart := time.Now()
+			if err := lim.wait(ctx, prio); err != nil {
+				return err
+			}
+			st.wait.Add(int64(time.Since(waitStart)))
+		}
+
 		var bodyReader io.Reader
 		if body != nil {
 			bodyReader = bytes.NewReader(body)
@@ -75,21 +164,65 @@ func (c *Client) doWithRetry(ctx context.Context, method, url string, body []byt
 		if body != nil {
 			req.Header.Set("Content-Type", "application/json")
 		}
+		if c.userAgent != "" {
+			req.Header.Set("User-Agent", c.userAgent)
+		}
+		c.etags.apply(req)
 
+		st.requests.Add(1)
 		resp, err := c.http.Do(req)
 		if err != nil {
+			st.errors.Add(1)
 			lastErr = fmt.Errorf("do request: %w", err)
 			continue
 		}
 
 		respBody, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
+		st.bytes.Add(int64(len(respBody)))
 
 		if err != nil {
+			st.errors.Add(1)
 			lastErr = fmt.Errorf("read body: %w", err)
 			continue
 		}
 
+		status := resp.StatusCode
+		if status == http.StatusNotModified {
+			st.notModified.Add(1)
+			cached, ok := c.etags.resolve(url, resp, respBody)
+			if !ok {
+				return fmt.Errorf("not modified but nothing cached for %s", url)
+			}
+			respBody, status = cached, http.StatusOK
+		} else {
+			respBody, _ = c.etags.resolve(url, resp, respBody)
+		}
+
+		// Record the resolved body so replays never depend on the ETag cache.
+		c.record(method, url, body, status, respBody)
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			st.errors.Add(1)
+			st.rateLimited.Add(1)
+			wait := retryAfter(resp.Header)
+			if wait <= 0 && resp.StatusCode == http.StatusTooManyRequests {
+				wait = defaultRateLimitPause
+			}
+			if wait > 0 {
+				slog.Warn("rate limited by server", "status", resp.StatusCode, "retry_after", wait, "url", url)
+				if lim != nil {
+					lim.block(time.Now().Add(wait))
+				} else {
+					pause = wait
+				}
+			}
+			lastErr = fmt.Errorf("rate limited %d: %s", resp.StatusCode, string(respBody[:min(len(respBody), 200)]))
+			continue
+		}
+		if resp.StatusCode >= 400 {
+			st.errors.Add(1)
+		}
 		if resp.StatusCode >= 500 {
 			lastErr = fmt.Errorf("server error %d: %s", resp.StatusCode, string(respBody[:min(len(respBody), 200)]))
 			continue
@@ -111,25 +244,38 @@ func (c *Client) doWithRetry(ctx context.Context, method, url string, body []byt
 // GetServer fetches the server status.
 func (c *Client) GetServer(ctx context.Context) (*ServerResponse, error) {
 	var resp ServerResponse
-	if err := c.doGet(ctx, baseURL+"/", &resp); err != nil {
+	if err := c.doGet(ctx, c.baseURL+"/", &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
+// GetServerRaw fetches the server status as raw JSON.
+func (c *Client) GetServerRaw(ctx context.Context) (json.RawMessage, error) {
+	var resp json.RawMessage
+	if err := c.doGet(ctx, c.baseURL+"/", &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
 // GetOnline fetches currently online players.
 func (c *Client) GetOnline(ctx context.Context) (*OnlineResponse, error) {
 	var resp OnlineResponse
-	if err := c.doGet(ctx, baseURL+"/online", &resp); err != nil {
+	if err := c.doGet(ctx, c.baseURL+"/online", &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
 }
 
-// GetMapPlayers fetches the map's live player positions.
+// GetMapPlayers fetches the map's live player positions. A client with no
+// map URL returns an empty response.
 func (c *Client) GetMapPlayers(ctx context.Context) (*MapPlayersResponse, error) {
 	var resp MapPlayersResponse
-	if err := c.doGet(ctx, mapBaseURL, &resp); err != nil {
+	if c.mapURL == "" {
+		return &resp, nil
+	}
+	if err := c.doGet(ctx, c.mapURL, &resp); err != nil {
 		return nil, err
 	}
 	return &resp, nil
@@ -138,7 +284,7 @@ func (c *Client) GetMapPlayers(ctx context.Context) (*MapPlayersResponse, error)
 // GetTownsList fetches the list of all towns (name + uuid only).
 func (c *Client) GetTownsList(ctx context.Context) ([]ListEntry, error) {
 	var resp []ListEntry
-	if err := c.doGet(ctx, baseURL+"/towns", &resp); err != nil {
+	if err := c.doGet(ctx, c.baseURL+"/towns", &resp); err != nil {
 		return nil, err
 	}
 	return resp, nil
@@ -147,7 +293,7 @@ func (c *Client) GetTownsList(ctx context.Context) ([]ListEntry, error) {
 // GetNationsList fetches the list of all nations (name + uuid only).
 func (c *Client) GetNationsList(ctx context.Context) ([]ListEntry, error) {
 	var resp []ListEntry
-	if err := c.doGet(ctx, baseURL+"/nations", &resp); err != nil {
+	if err := c.doGet(ctx, c.baseURL+"/nations", &resp); err != nil {
 		return nil, err
 	}
 	return resp, nil
@@ -156,45 +302,80 @@ func (c *Client) GetNationsList(ctx context.Context) ([]ListEntry, error) {
 // GetPlayersList fetches the list of all players (name + uuid only).
 func (c *Client) GetPlayersList(ctx context.Context) ([]ListEntry, error) {
 	var resp []ListEntry
-	if err := c.doGet(ctx, baseURL+"/players", &resp); err != nil {
+	if err := c.doGet(ctx, c.baseURL+"/players", &resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// GetQuartersList fetches the list of all quarters (name + uuid only).
+func (c *Client) GetQuartersList(ctx context.Context) ([]ListEntry, error) {
+	var resp []ListEntry
+	if err := c.doGet(ctx, c.baseURL+"/quarters", &resp); err != nil {
 		return nil, err
 	}
 	return resp, nil
 }
 
 // PostTowns fetches detailed town data for the given UUIDs (batched).
-func (c *Client) PostTowns(ctx context.Context, uuids []string) ([]json.RawMessage, error) {
-	return c.batchPost(ctx, baseURL+"/towns", uuids)
+func (c *Client) PostTowns(ctx context.Context, uuids []string) (*BatchResult, error) {
+	return c.batchPost(ctx, c.baseURL+"/towns", uuids)
 }
 
 // PostNations fetches detailed nation data for the given UUIDs (batched).
-func (c *Client) PostNations(ctx context.Context, uuids []string) ([]json.RawMessage, error) {
-	return c.batchPost(ctx, baseURL+"/nations", uuids)
+func (c *Client) PostNations(ctx context.Context, uuids []string) (*BatchResult, error) {
+	return c.batchPost(ctx, c.baseURL+"/nations", uuids)
 }
 
 // PostPlayers fetches detailed player data for the given UUIDs (batched).
-func (c *Client) PostPlayers(ctx context.Context, uuids []string) ([]json.RawMessage, error) {
-	return c.batchPost(ctx, baseURL+"/players", uuids)
+func (c *Client) PostPlayers(ctx context.Context, uuids []string) (*BatchResult, error) {
+	return c.batchPost(ctx, c.baseURL+"/players", uuids)
 }
 
-// batchPost sends POST requests in batches and collects all results.
-func (c *Client) batchPost(ctx context.Context, url string, uuids []string) ([]json.RawMessage, error) {
-	var allResults []json.RawMessage
+// PostQuarters fetches detailed quarter data for the given UUIDs (batched).
+func (c *Client) PostQuarters(ctx context.Context, uuids []string) (*BatchResult, error) {
+	return c.batchPost(ctx, c.baseURL+"/quarters", uuids)
+}
 
-	for i := 0; i < len(uuids); i += batchSize {
-		end := i + batchSize
-		if end > len(uuids) {
-			end = len(uuids)
+// PostLocation reports which town and nation, if any, owns each [x, z]
+// block coordinate. Results are in query order.
+func (c *Client) PostLocation(ctx context.Context, coords [][2]int) ([]LocationResult, error) {
+	var all []LocationResult
+	for i := 0; i < len(coords); i += batchSize {
+		end := min(i+batchSize, len(coords))
+		var results []LocationResult
+		if err := c.doPost(ctx, c.baseURL+"/location", LocationQuery{Query: coords[i:end]}, &results); err != nil {
+			return nil, fmt.Errorf("batch %d-%d: %w", i, end, err)
 		}
-		batch := uuids[i:end]
+		all = append(all, results...)
+	}
+	return all, nil
+}
 
-		body := PostQuery{Query: batch}
-		var results []json.RawMessage
-		if err := c.doPost(ctx, url, body, &results); err != nil {
+// PostNearby returns, for each query, the towns found within its radius.
+func (c *Client) PostNearby(ctx context.Context, queries []NearbyQuery) ([][]ListEntry, error) {
+	var all [][]ListEntry
+	for i := 0; i < len(queries); i += batchSize {
+		end := min(i+batchSize, len(queries))
+		var results [][]ListEntry
+		if err := c.doPost(ctx, c.baseURL+"/nearby", NearbyRequest{Query: queries[i:end]}, &results); err != nil {
 			return nil, fmt.Errorf("batch %d-%d: %w", i, end, err)
 		}
-		allResults = append(allResults, results...)
+		all = append(all, results...)
 	}
+	return all, nil
+}
 
-	return allResults, nil
+// PostDiscord resolves Discord IDs to Minecraft UUIDs or vice versa.
+func (c *Client) PostDiscord(ctx context.Context, queries []DiscordQuery) ([]DiscordLink, error) {
+	var all []DiscordLink
+	for i := 0; i < len(queries); i += batchSize {
+		end := min(i+batchSize, len(queries))
+		var results []DiscordLink
+		if err := c.doPost(ctx, c.baseURL+"/discord", DiscordRequest{Query: queries[i:end]}, &results); err != nil {
+			return nil, fmt.Errorf("batch %d-%d: %w", i, end, err)
+		}
+		all = append(all, results...)
+	}
+	return all, nil
 }
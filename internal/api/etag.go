@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+)
+
+// etagCache remembers the last ETag and body per GET URL so unchanged
+// responses can be answered with 304 Not Modified.
+type etagCache struct {
+	mu      sync.Mutex
+	entries map[string]etagEntry
+}
+
+type etagEntry struct {
+	etag string
+	body []byte
+}
+
+func newETagCache() *etagCache {
+	return &etagCache{entries: make(map[string]etagEntry)}
+}
+
+// apply adds If-None-Match to req when a cached ETag exists for its URL.
+func (e *etagCache) apply(req *http.Request) {
+	if req.Method != http.MethodGet {
+		return
+	}
+	e.mu.Lock()
+	entry, ok := e.entries[req.URL.String()]
+	e.mu.Unlock()
+	if ok {
+		req.Header.Set("If-None-Match", entry.etag)
+	}
+}
+
+// resolve returns the body to decode for a response: the cached body on
+// 304, otherwise body itself, which is cached if the server sent an ETag.
+// ok is false for a 304 with nothing cached.
+func (e *etagCache) resolve(url string, resp *http.Response, body []byte) (out []byte, ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if resp.StatusCode == http.StatusNotModified {
+		entry, found := e.entries[url]
+		return entry.body, found
+	}
+	if resp.Request != nil && resp.Request.Method == http.MethodGet && resp.StatusCode == http.StatusOK {
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			e.entries[url] = etagEntry{etag: etag, body: body}
+		} else {
+			delete(e.entries, url)
+		}
+	}
+	return body, true
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Fixture is one recorded request/response pair.
+type Fixture struct {
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response,omitempty"`
+	// ResponseText holds bodies that are not valid JSON, such as error pages.
+	ResponseText string `json:"responseText,omitempty"`
+}
+
+// FixtureKey identifies a request by method, URL and body, so batched POSTs
+// to the same endpoint get distinct fixtures.
+func FixtureKey(method, url string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(url))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))[:24]
+}
+
+// WithRecorder makes the client write every response it receives to dir as
+// a fixture that ReplayTransport can serve back later.
+func WithRecorder(dir string) Option {
+	return func(c *Client) {
+		c.recordDir = dir
+	}
+}
+
+// record writes a fixture for one response. Failures are logged, never
+// returned: recording must not break a scrape.
+func (c *Client) record(method, url string, body []byte, status int, resp []byte) {
+	if c.recordDir == "" {
+		return
+	}
+
+	f := Fixture{Method: method, URL: url, Status: status}
+	if len(body) > 0 {
+		f.Body = body
+	}
+	if json.Valid(resp) {
+		f.Response = resp
+	} else {
+		f.ResponseText = string(resp)
+	}
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		slog.Warn("record fixture: marshal failed", "url", url, "error", err)
+		return
+	}
+
+	if err := os.MkdirAll(c.recordDir, 0o755); err != nil {
+		slog.Warn("record fixture: mkdir failed", "dir", c.recordDir, "error", err)
+		return
+	}
+
+	// Write then rename so a concurrent replay never sees a partial file.
+	path := filepath.Join(c.recordDir, FixtureKey(method, url, body)+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		slog.Warn("record fixture: write failed", "path", tmp, "error", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		slog.Warn("record fixture: rename failed", "path", path, "error", err)
+	}
+}
+
+// ReplayTransport is an http.RoundTripper that answers requests from
+// fixtures recorded with WithRecorder. Requests without a fixture get a 404
+// so the client fails fast instead of retrying.
+type ReplayTransport struct {
+	fixtures map[string]Fixture
+}
+
+// NewReplayTransport loads every fixture in dir.
+func NewReplayTransport(dir string) (*ReplayTransport, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read fixtures dir: %w", err)
+	}
+
+	t := &ReplayTransport{fixtures: make(map[string]Fixture, len(entries))}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read fixture %s: %w", entry.Name(), err)
+		}
+
+		var f Fixture
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("parse fixture %s: %w", entry.Name(), err)
+		}
+		t.fixtures[FixtureKey(f.Method, f.URL, f.Body)] = f
+	}
+
+	slog.Info("loaded replay fixtures", "dir", dir, "count", len(t.fixtures))
+	return t, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read request body: %w", err)
+		}
+	}
+
+	url := req.URL.String()
+	f, ok := t.fixtures[FixtureKey(req.Method, url, body)]
+	if !ok {
+		return replayResponse(req, http.StatusNotFound,
+			[]byte(fmt.Sprintf("no fixture recorded for %s %s", req.Method, url))), nil
+	}
+
+	resp := []byte(f.Response)
+	if resp == nil {
+		resp = []byte(f.ResponseText)
+	}
+	return replayResponse(req, f.Status, resp), nil
+}
+
+func replayResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	tokyo = "aaaaaaaa-aaaa-4aaa-8aaa-aaaaaaaaaaaa"
+	kyoto = "bbbbbbbb-bbbb-4bbb-8bbb-bbbbbbbbbbbb"
+)
+
+// replayClient answers from the fixtures recorded in testdata/aurora.
+func replayClient(t *testing.T) *Client {
+	t.Helper()
+	rt, err := NewReplayTransport("testdata/aurora")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(WithHTTPClient(&http.Client{Transport: rt}))
+}
+
+func TestReplayFixtures(t *testing.T) {
+	c := replayClient(t)
+
+	tests := []struct {
+		name    string
+		call    func(context.Context) (any, error)
+		want    any
+		wantErr string
+	}{
+		{
+			name: "server",
+			call: func(ctx context.Context) (any, error) {
+				s, err := c.GetServer(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return []any{s.Version, s.Stats.NumTowns, s.VoteParty.NumRemaining}, nil
+			},
+			want: []any{"1.21.4", 1500, 1200},
+		},
+		{
+			name: "online",
+			call: func(ctx context.Context) (any, error) {
+				o, err := c.GetOnline(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return o.Players, nil
+			},
+			want: []ListEntry{
+				{Name: "Fix", UUID: "11111111-1111-4111-8111-111111111111"},
+				{Name: "Owen3H", UUID: "22222222-2222-4222-8222-222222222222"},
+			},
+		},
+		{
+			name: "towns list",
+			call: func(ctx context.Context) (any, error) {
+				return c.GetTownsList(ctx)
+			},
+			want: []ListEntry{{Name: "Tokyo", UUID: tokyo}, {Name: "Kyoto", UUID: kyoto}},
+		},
+		{
+			name: "towns batch",
+			call: func(ctx context.Context) (any, error) {
+				res, err := c.PostTowns(ctx, []string{tokyo, kyoto})
+				if err != nil {
+					return nil, err
+				}
+				if err := res.Err(); err != nil {
+					return nil, err
+				}
+				var mayors []string
+				for _, raw := range res.Results {
+					var town TownDetail
+					if err := json.Unmarshal(raw, &town); err != nil {
+						return nil, err
+					}
+					mayors = append(mayors, town.Name+":"+town.Mayor.Name)
+				}
+				return mayors, nil
+			},
+			want: []string{"Tokyo:Fix", "Kyoto:Owen3H"},
+		},
+		{
+			name: "map players",
+			call: func(ctx context.Context) (any, error) {
+				m, err := c.GetMapPlayers(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return m.Players, nil
+			},
+			want: []MapPlayer{{
+				World: "minecraft_overworld", Name: "Fix", X: 100, Y: 64, Z: -200,
+				DisplayName: "Fix", UUID: "11111111-1111-4111-8111-111111111111", Yaw: 90,
+			}},
+		},
+		{
+			name: "recorded error page",
+			call: func(ctx context.Context) (any, error) {
+				return c.GetPlayersList(ctx)
+			},
+			wantErr: "client error 400: Bad Request",
+		},
+		{
+			name: "no fixture",
+			call: func(ctx context.Context) (any, error) {
+				return c.GetNationsList(ctx)
+			},
+			wantErr: "client error 404",
+		},
+		{
+			name: "batch body not recorded",
+			call: func(ctx context.Context) (any, error) {
+				res, err := c.PostTowns(ctx, []string{kyoto, tokyo})
+				if err != nil {
+					return nil, err
+				}
+				return nil, res.Err()
+			},
+			wantErr: "client error 404",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.call(context.Background())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRecordThenReplay records live responses and serves them back with the
+// server gone.
+func TestRecordThenReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/aurora/towns":
+			fmt.Fprintf(w, `[{"name":"Tokyo","uuid":%q}]`, tokyo)
+		case r.Method == http.MethodPost && r.URL.Path == "/aurora/towns":
+			var q PostQuery
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &q)
+			var out []string
+			for _, uuid := range q.Query {
+				out = append(out, fmt.Sprintf(`{"name":"Tokyo","uuid":%q}`, uuid))
+			}
+			fmt.Fprintf(w, "[%s]", strings.Join(out, ","))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	live := NewClient(WithBaseURL(srv.URL+"/aurora"), WithRecorder(dir))
+	wantList, err := live.GetTownsList(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantBatch, err := live.PostTowns(ctx, []string{tokyo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	rt, err := NewReplayTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay := NewClient(WithBaseURL(srv.URL+"/aurora"), WithHTTPClient(&http.Client{Transport: rt}))
+	gotList, err := replay.GetTownsList(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotList, wantList) {
+		t.Errorf("replayed list %v, recorded %v", gotList, wantList)
+	}
+	gotBatch, err := replay.PostTowns(ctx, []string{tokyo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gotBatch.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotBatch.Results, wantBatch.Results) {
+		t.Errorf("replayed batch %s, recorded %s", gotBatch.Results, wantBatch.Results)
+	}
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Priority decides who gets tokens first when a host's budget runs low.
+type Priority int
+
+const (
+	// PriorityLow is the default, used by the bulk low-freq scrapes.
+	PriorityLow Priority = iota
+	// PriorityHigh is for the 3-second high-freq calls, which must not be
+	// starved by low-freq bursts.
+	PriorityHigh
+)
+
+type priorityKey struct{}
+
+// WithPriority marks every request made with ctx as having priority p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+func priorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityLow
+}
+
+// highPriorityReserve is the fraction of a bucket that only high-priority
+// requests may spend. Low-priority requests always keep at least one token
+// of the bucket, or they could never get one.
+const highPriorityReserve = 0.25
+
+// limiter is a token bucket for a single host. It also tracks a hard pause
+// set by 429/Retry-After responses, during which nobody gets a token.
+type limiter struct {
+	mu           sync.Mutex
+	rate         float64 // tokens per second
+	burst        float64
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+func newLimiter(rps float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until a token is available for priority p or ctx is done.
+func (l *limiter) wait(ctx context.Context, p Priority) error {
+	for {
+		delay := l.reserve(p)
+		if delay <= 0 {
+			return nil
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// reserve takes a token and returns 0, or returns how long to wait before
+// trying again.
+func (l *limiter) reserve(p Priority) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.blockedUntil) {
+		return l.blockedUntil.Sub(now)
+	}
+
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	floor := 0.0
+	if p == PriorityLow {
+		floor = min(l.burst*highPriorityReserve, l.burst-1)
+	}
+	if l.tokens-1 >= floor {
+		l.tokens--
+		return 0
+	}
+	need := floor + 1 - l.tokens
+	return time.Duration(need / l.rate * float64(time.Second))
+}
+
+// block pauses the host until at least t and empties the bucket, so requests
+// resume gradually rather than all at once.
+func (l *limiter) block(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until.After(l.blockedUntil) {
+		l.blockedUntil = until
+		l.last = until
+	}
+	l.tokens = 0
+}
+
+// WithAPIRateLimit budgets requests to the API host.
+func WithAPIRateLimit(rps float64, burst int) Option {
+	return func(c *Client) {
+		c.apiLimit = &rateSpec{rps: rps, burst: burst}
+	}
+}
+
+// WithMapRateLimit budgets requests to the map host.
+func WithMapRateLimit(rps float64, burst int) Option {
+	return func(c *Client) {
+		c.mapLimit = &rateSpec{rps: rps, burst: burst}
+	}
+}
+
+type rateSpec struct {
+	rps   float64
+	burst int
+}
+
+// Limits is a set of per-host token buckets. Clients given the same Limits
+// draw from one budget per host, so several servers scraped from
+// api.earthmc.net cannot together exceed it.
+type Limits struct {
+	mu     sync.Mutex
+	byHost map[string]*limiter
+}
+
+// NewLimits creates an empty set of host budgets.
+func NewLimits() *Limits {
+	return &Limits{byHost: make(map[string]*limiter)}
+}
+
+// WithLimits makes the client register and look up its host budgets in l
+// instead of a private set.
+func WithLimits(l *Limits) Option {
+	return func(c *Client) {
+		c.limits = l
+	}
+}
+
+// ensure creates a bucket for host unless one exists; the first budget
+// registered for a host wins.
+func (l *Limits) ensure(host string, spec *rateSpec) {
+	if spec == nil || spec.rps <= 0 || host == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.byHost[host]; !ok {
+		l.byHost[host] = newLimiter(spec.rps, spec.burst)
+	}
+}
+
+func (l *Limits) get(host string) *limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.byHost[host]
+}
+
+// buildLimiters resolves the configured budgets to hosts. If the API and map
+// share a host (e.g. a local fake), the API budget wins.
+func (c *Client) buildLimiters() {
+	if c.limits == nil {
+		c.limits = NewLimits()
+	}
+	c.limits.ensure(hostOf(c.baseURL), c.apiLimit)
+	c.limits.ensure(hostOf(c.mapURL), c.mapLimit)
+}
+
+func (c *Client) limiterFor(rawURL string) *limiter {
+	return c.limits.get(hostOf(rawURL))
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// retryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date. It returns 0 if the header is absent or invalid.
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
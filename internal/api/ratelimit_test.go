@@ -0,0 +1,85 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// granted counts the tokens priority p gets before reserve asks it to wait.
+func granted(l *limiter, p Priority) int {
+	n := 0
+	for n < 100 && l.reserve(p) == 0 {
+		n++
+	}
+	return n
+}
+
+func TestLimiterReserve(t *testing.T) {
+	// A rate this slow refills nothing while the test runs.
+	const rate = 0.001
+
+	tests := []struct {
+		name  string
+		burst int
+		prio  Priority
+		want  int
+	}{
+		{"high priority spends the whole bucket", 10, PriorityHigh, 10},
+		{"low priority leaves the reserve", 10, PriorityLow, 7},
+		{"low priority with a small bucket", 4, PriorityLow, 3},
+		{"low priority with a burst of 1", 1, PriorityLow, 1},
+		{"high priority with a burst of 1", 1, PriorityHigh, 1},
+		{"burst below 1 acts as 1", 0, PriorityLow, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLimiter(rate, tt.burst)
+			if got := granted(l, tt.prio); got != tt.want {
+				t.Errorf("granted %d tokens, want %d", got, tt.want)
+			}
+			if d := l.reserve(tt.prio); d <= 0 {
+				t.Errorf("reserve on an empty bucket = %v, want a wait", d)
+			}
+		})
+	}
+}
+
+func TestLimiterReserveLeavesHighPriorityTokens(t *testing.T) {
+	l := newLimiter(0.001, 8)
+	if got := granted(l, PriorityLow); got != 6 {
+		t.Fatalf("low priority granted %d tokens, want 6", got)
+	}
+	if got := granted(l, PriorityHigh); got != 2 {
+		t.Errorf("high priority granted %d tokens after low, want 2", got)
+	}
+}
+
+func TestLimiterReserveWaitsForRefill(t *testing.T) {
+	l := newLimiter(10, 1)
+	if d := l.reserve(PriorityLow); d != 0 {
+		t.Fatalf("first reserve = %v, want 0", d)
+	}
+	d := l.reserve(PriorityLow)
+	if d <= 0 || d > 100*time.Millisecond {
+		t.Errorf("reserve on an empty bucket = %v, want up to one token's refill (100ms)", d)
+	}
+}
+
+func TestLimiterBlock(t *testing.T) {
+	l := newLimiter(1000, 5)
+	until := time.Now().Add(time.Hour)
+	l.block(until)
+
+	if d := l.reserve(PriorityHigh); d < 59*time.Minute {
+		t.Errorf("reserve while blocked = %v, want about an hour", d)
+	}
+
+	// A shorter block must not move the pause, or the refill clock, back.
+	l.block(time.Now().Add(time.Second))
+	if !l.blockedUntil.Equal(until) || !l.last.Equal(until) {
+		t.Errorf("after a shorter block: blockedUntil %v, last %v, want both %v", l.blockedUntil, l.last, until)
+	}
+	if l.tokens != 0 {
+		t.Errorf("tokens = %v after block, want 0", l.tokens)
+	}
+}
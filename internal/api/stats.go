@@ -0,0 +1,62 @@
+package api
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts the HTTP traffic of every request made with a context from
+// WithStats. It is safe for concurrent use.
+type Stats struct {
+	requests    atomic.Int64
+	retries     atomic.Int64
+	errors      atomic.Int64
+	rateLimited atomic.Int64
+	notModified atomic.Int64
+	bytes       atomic.Int64
+	wait        atomic.Int64 // nanoseconds
+}
+
+// Totals is a point-in-time copy of Stats.
+type Totals struct {
+	// Requests counts every attempt sent, retries included
+	Requests int64 `json:"requests"`
+	Retries  int64 `json:"retries"`
+	// Errors counts failed attempts: transport errors and 4xx/5xx responses
+	Errors      int64 `json:"errors"`
+	RateLimited int64 `json:"rate_limited"`
+	NotModified int64 `json:"not_modified"`
+	// Bytes is the response bodies received, before ETag resolution
+	Bytes int64 `json:"bytes"`
+	// WaitMS is time spent waiting on the client-side rate limiter
+	WaitMS int64 `json:"wait_ms"`
+}
+
+type statsKey struct{}
+
+// WithStats makes every request made with ctx count towards s.
+func WithStats(ctx context.Context, s *Stats) context.Context {
+	return context.WithValue(ctx, statsKey{}, s)
+}
+
+// statsFrom returns ctx's Stats, or a throwaway one when there is none.
+func statsFrom(ctx context.Context) *Stats {
+	if s, ok := ctx.Value(statsKey{}).(*Stats); ok {
+		return s
+	}
+	return new(Stats)
+}
+
+// Totals returns the counts so far.
+func (s *Stats) Totals() Totals {
+	return Totals{
+		Requests:    s.requests.Load(),
+		Retries:     s.retries.Load(),
+		Errors:      s.errors.Load(),
+		RateLimited: s.rateLimited.Load(),
+		NotModified: s.notModified.Load(),
+		Bytes:       s.bytes.Load(),
+		WaitMS:      time.Duration(s.wait.Load()).Milliseconds(),
+	}
+}
@@ -245,6 +245,91 @@ type NationCoordinates struct {
 	Spawn *SpawnCoord `json:"spawn"`
 }
 
+// ============================================================
+// Quarter Detail (POST /quarters response)
+// ============================================================
+
+type QuarterDetail struct {
+	Name       *string           `json:"name"`
+	UUID       string            `json:"uuid"`
+	Type       string            `json:"type"`
+	Owner      *ListEntry        `json:"owner"`
+	Town       *ListEntry        `json:"town"`
+	Nation     *ListEntry        `json:"nation"`
+	Timestamps *QuarterTimestamp `json:"timestamps"`
+	Status     *QuarterStatus    `json:"status"`
+	Stats      *QuarterStats     `json:"stats"`
+	Colour     []int             `json:"colour"`
+	Trusted    []ListEntry       `json:"trusted"`
+	Cuboids    []Cuboid          `json:"cuboids"`
+}
+
+type QuarterTimestamp struct {
+	Registered *int64 `json:"registered"`
+	ClaimedAt  *int64 `json:"claimedAt"`
+}
+
+type QuarterStatus struct {
+	IsEmbassy bool `json:"isEmbassy"`
+	IsForSale bool `json:"isForSale"`
+}
+
+type QuarterStats struct {
+	Price      *float64 `json:"price"`
+	Volume     int      `json:"volume"`
+	NumCuboids int      `json:"numCuboids"`
+}
+
+type Cuboid struct {
+	Pos1 []int `json:"pos1"`
+	Pos2 []int `json:"pos2"`
+}
+
+// ============================================================
+// Location (POST /location response)
+// ============================================================
+
+type LocationResult struct {
+	Location     LocationPoint `json:"location"`
+	IsWilderness bool          `json:"isWilderness"`
+	Town         *ListEntry    `json:"town"`
+	Nation       *ListEntry    `json:"nation"`
+}
+
+type LocationPoint struct {
+	X int `json:"x"`
+	Z int `json:"z"`
+}
+
+// ============================================================
+// Nearby (POST /nearby)
+// ============================================================
+
+// NearbyQuery searches for towns within Radius blocks of Target, which is
+// either a town name (TargetType "TOWN") or an [x, z] pair ("COORDINATE").
+type NearbyQuery struct {
+	TargetType string      `json:"target_type"`
+	Target     interface{} `json:"target"`
+	SearchType string      `json:"search_type"`
+	Radius     int         `json:"radius"`
+}
+
+// ============================================================
+// Discord (POST /discord)
+// ============================================================
+
+// DiscordQuery looks up a link by Discord ID (Type "discord") or by
+// Minecraft UUID (Type "minecraft").
+type DiscordQuery struct {
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+type DiscordLink struct {
+	ID   *string `json:"id"`
+	UUID *string `json:"uuid"`
+}
+
 // ============================================================
 // Shared permission structure
 // ============================================================
@@ -272,5 +357,18 @@ type PostQuery struct {
 	Query []string `json:"query"`
 }
 
+// LocationQuery asks which town owns each [x, z] coordinate.
+type LocationQuery struct {
+	Query [][2]int `json:"query"`
+}
+
+type NearbyRequest struct {
+	Query []NearbyQuery `json:"query"`
+}
+
+type DiscordRequest struct {
+	Query []DiscordQuery `json:"query"`
+}
+
 // RawJSON is used for storing complete API responses as JSONB.
 type RawJSON = json.RawMessage
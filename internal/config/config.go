@@ -4,9 +4,22 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/0Mattias/earthmc-scraper/internal/api"
 )
 
+// Target is one EarthMC map to scrape. Name is stored as server_id on every
+// row written for it.
+type Target struct {
+	Name             string
+	APIBaseURL       string
+	MapURL           string // empty when the map has no public players.json
+	HighFreqInterval time.Duration
+	LowFreqInterval  time.Duration
+}
+
 // Config holds all configuration for the worker.
 type Config struct {
 	// Database
@@ -20,12 +33,63 @@ type Config struct {
 	// Cloud SQL
 	CloudSQLConnectionName string
 
-	// Scraper intervals
+	// EarthMC servers to scrape, each with its own endpoints and intervals
+	Servers   []Target
+	UserAgent string
+
+	// Client-side request budgets per host (requests/second and burst).
+	// A rate of 0 disables the limiter for that host.
+	APIRateLimit float64
+	APIRateBurst int
+	MapRateLimit float64
+	MapRateBurst int
+
+	// Batched POST fan-out and extra passes over failed batches
+	BatchConcurrency int
+	BatchRetries     int
+
+	// HTTP fixtures: record every response to a directory, or serve
+	// responses from a previously recorded one instead of the network.
+	RecordDir string
+	ReplayDir string
+
+	// Default scraper intervals, overridable per server
 	HighFreqInterval time.Duration
 	LowFreqInterval  time.Duration
 
+	// How long a player may be missing from /online before their session
+	// is closed
+	SessionGrace time.Duration
+
+	// How often the high-freq loop writes every online player rather than
+	// only those whose state changed
+	KeyframeInterval time.Duration
+
+	// How long raw player_activity rows are kept before their hourly
+	// partitions are dropped (0 keeps them forever), and how often the
+	// rollup/retention pass runs.
+	ActivityRawRetention time.Duration
+	RetentionInterval    time.Duration
+
+	// Directory hourly partitions are exported to before being dropped;
+	// empty drops them without an archive.
+	ActivityArchiveDir string
+
+	// Local directory batches are spooled to while the database is
+	// unreachable (empty disables spooling), and its size cap
+	SpoolDir      string
+	SpoolMaxBytes int64
+
 	// HTTP server
 	Port int
+
+	// How long one read query of the API may run
+	QueryTimeout time.Duration
+
+	// MCP server: the connection string of a role that may only SELECT,
+	// and the bearer token its HTTP transport requires
+	MCPDatabaseURL string
+	MCPToken       string
 }
 
 // Load reads configuration from environment variables with sensible defaults.
@@ -38,7 +102,19 @@ func Load() (*Config, error) {
 		DBPassword:             getEnv("DB_PASSWORD", ""),
 		DBPoolMax:              getEnvInt("DB_POOL_MAX", 10),
 		CloudSQLConnectionName: getEnv("CLOUD_SQL_CONNECTION_NAME", ""),
+		UserAgent:              getEnv("EARTHMC_USER_AGENT", api.DefaultUserAgent),
+		APIRateBurst:           getEnvInt("API_RATE_BURST", 10),
+		MapRateBurst:           getEnvInt("MAP_RATE_BURST", 4),
+		BatchConcurrency:       getEnvInt("BATCH_CONCURRENCY", 4),
+		BatchRetries:           getEnvInt("BATCH_RETRIES", 1),
+		RecordDir:              getEnv("EARTHMC_RECORD_DIR", ""),
+		ReplayDir:              getEnv("EARTHMC_REPLAY_DIR", ""),
+		ActivityArchiveDir:     getEnv("ACTIVITY_ARCHIVE_DIR", ""),
+		SpoolDir:               getEnv("SPOOL_DIR", ""),
+		SpoolMaxBytes:          int64(getEnvInt("SPOOL_MAX_MB", 1024)) << 20,
 		Port:                   getEnvInt("PORT", 8080),
+		MCPDatabaseURL:         getEnv("MCP_DATABASE_URL", ""),
+		MCPToken:               getEnv("MCP_TOKEN", ""),
 	}
 
 	var err error
@@ -52,8 +128,61 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("invalid LOW_FREQ_INTERVAL: %w", err)
 	}
 
-	if c.DBPassword == "" {
-		return nil, fmt.Errorf("DB_PASSWORD is required")
+	c.SessionGrace, err = getEnvDuration("SESSION_GRACE", 90*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	c.KeyframeInterval, err = getEnvDuration("KEYFRAME_INTERVAL", 5*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ActivityRawRetention, err = getEnvDuration("ACTIVITY_RAW_RETENTION", 14*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	c.QueryTimeout, err = getEnvDuration("QUERY_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if c.QueryTimeout <= 0 {
+		return nil, fmt.Errorf("QUERY_TIMEOUT must be positive")
+	}
+
+	c.RetentionInterval, err = getEnvDuration("RETENTION_INTERVAL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if c.RetentionInterval <= 0 {
+		return nil, fmt.Errorf("RETENTION_INTERVAL must be positive")
+	}
+
+	c.Servers, err = loadServers(c.HighFreqInterval, c.LowFreqInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	c.APIRateLimit, err = strconv.ParseFloat(getEnv("API_RATE_LIMIT", "5"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API_RATE_LIMIT: %w", err)
+	}
+
+	c.MapRateLimit, err = strconv.ParseFloat(getEnv("MAP_RATE_LIMIT", "2"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAP_RATE_LIMIT: %w", err)
+	}
+
+	if c.APIRateBurst < 1 {
+		return nil, fmt.Errorf("API_RATE_BURST must be at least 1")
+	}
+	if c.MapRateBurst < 1 {
+		return nil, fmt.Errorf("MAP_RATE_BURST must be at least 1")
+	}
+
+	if c.RecordDir != "" && c.ReplayDir != "" {
+		return nil, fmt.Errorf("EARTHMC_RECORD_DIR and EARTHMC_REPLAY_DIR are mutually exclusive")
 	}
 
 	return c, nil
@@ -70,6 +199,72 @@ func (c *Config) DSN() string {
 		c.DBHost, c.DBPort, c.DBUser, c.DBPassword, c.DBName, c.DBPoolMax)
 }
 
+// loadServers reads EARTHMC_SERVERS (a comma-separated list of names,
+// default "aurora") and each server's EARTHMC_<NAME>_API_URL, _MAP_URL,
+// _HIGH_FREQ_INTERVAL and _LOW_FREQ_INTERVAL. The unprefixed EARTHMC_API_URL
+// and EARTHMC_MAP_URL still apply to the first server listed.
+func loadServers(highFreq, lowFreq time.Duration) ([]Target, error) {
+	var targets []Target
+	seen := make(map[string]bool)
+
+	for i, name := range strings.Split(getEnv("EARTHMC_SERVERS", "aurora"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !validServerName(name) {
+			return nil, fmt.Errorf("invalid server name %q in EARTHMC_SERVERS", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate server %q in EARTHMC_SERVERS", name)
+		}
+		seen[name] = true
+
+		prefix := "EARTHMC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		apiDefault := api.APIRoot + "/" + name
+		mapDefault := ""
+		if name == "aurora" {
+			mapDefault = api.DefaultMapURL
+		}
+		if i == 0 {
+			apiDefault = getEnv("EARTHMC_API_URL", apiDefault)
+			mapDefault = getEnv("EARTHMC_MAP_URL", mapDefault)
+		}
+
+		t := Target{
+			Name:       name,
+			APIBaseURL: getEnv(prefix+"API_URL", apiDefault),
+			MapURL:     getEnv(prefix+"MAP_URL", mapDefault),
+		}
+
+		var err error
+		t.HighFreqInterval, err = getEnvDuration(prefix+"HIGH_FREQ_INTERVAL", highFreq)
+		if err != nil {
+			return nil, err
+		}
+		t.LowFreqInterval, err = getEnvDuration(prefix+"LOW_FREQ_INTERVAL", lowFreq)
+		if err != nil {
+			return nil, err
+		}
+
+		targets = append(targets, t)
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("EARTHMC_SERVERS lists no servers")
+	}
+	return targets, nil
+}
+
+func validServerName(name string) bool {
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
 func getEnv(key, fallback string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -85,3 +280,15 @@ func getEnvInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+func getEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return d, nil
+}
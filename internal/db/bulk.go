@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Bulker is what the bulk writers need. *pgxpool.Pool, *pgxpool.Conn,
+// *pgx.Conn and pgx.Tx all satisfy it.
+type Bulker interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// CopyRows streams rows into table with the COPY protocol. Each row holds
+// one value per column, in order.
+func CopyRows(ctx context.Context, q Bulker, table string, columns []string, rows [][]any) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	n, err := q.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(rows))
+	if err != nil {
+		return n, fmt.Errorf("copy into %s: %w", table, err)
+	}
+	return n, nil
+}
+
+// Merge describes an INSERT ... SELECT from a COPY-loaded temporary table:
+// an upsert when Conflict is set, a plain insert otherwise.
+type Merge struct {
+	Table   string
+	Columns []string
+	// Conflict is the unique key to upsert on. Rows repeating a key within
+	// one batch are collapsed to the last one.
+	Conflict []string
+	// Update lists the columns overwritten on conflict; with none the
+	// existing row is kept.
+	Update []string
+	// Returning columns are passed to the scan function, one call per row.
+	Returning []string
+}
+
+// mergeSeq keeps temporary table names unique when merges nest inside one
+// transaction.
+var mergeSeq atomic.Uint64
+
+// Run copies rows into a temporary table and merges them into m.Table with
+// a single statement, in one transaction. scan is called for each returned
+// row when m.Returning is set.
+func (m Merge) Run(ctx context.Context, q Bulker, rows [][]any, scan func(pgx.Rows) error) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	tx, err := q.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	cols := strings.Join(m.Columns, ", ")
+	tmp := fmt.Sprintf("bulk_%s_%d", m.Table, mergeSeq.Add(1))
+	if _, err := tx.Exec(ctx, fmt.Sprintf(
+		"CREATE TEMP TABLE %s ON COMMIT DROP AS SELECT %s FROM %s WITH NO DATA", tmp, cols, m.Table)); err != nil {
+		return 0, fmt.Errorf("create %s: %w", tmp, err)
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{tmp}, m.Columns, pgx.CopyFromRows(rows)); err != nil {
+		return 0, fmt.Errorf("copy into %s: %w", tmp, err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "INSERT INTO %s (%s) SELECT ", m.Table, cols)
+	if len(m.Conflict) > 0 {
+		// ON CONFLICT cannot touch the same row twice in one statement
+		key := strings.Join(m.Conflict, ", ")
+		fmt.Fprintf(&sb, "DISTINCT ON (%s) %s FROM %s ORDER BY %s, ctid DESC", key, cols, tmp, key)
+		fmt.Fprintf(&sb, " ON CONFLICT (%s) DO ", key)
+		if len(m.Update) == 0 {
+			sb.WriteString("NOTHING")
+		} else {
+			sets := make([]string, len(m.Update))
+			for i, c := range m.Update {
+				sets[i] = c + " = EXCLUDED." + c
+			}
+			sb.WriteString("UPDATE SET " + strings.Join(sets, ", "))
+		}
+	} else {
+		fmt.Fprintf(&sb, "%s FROM %s", cols, tmp)
+	}
+	if len(m.Returning) > 0 {
+		sb.WriteString(" RETURNING " + strings.Join(m.Returning, ", "))
+	}
+
+	var n int64
+	if len(m.Returning) > 0 {
+		res, err := tx.Query(ctx, sb.String())
+		if err != nil {
+			return 0, fmt.Errorf("merge into %s: %w", m.Table, err)
+		}
+		for res.Next() {
+			if err := scan(res); err != nil {
+				res.Close()
+				return 0, err
+			}
+			n++
+		}
+		res.Close()
+		if err := res.Err(); err != nil {
+			return 0, fmt.Errorf("merge into %s: %w", m.Table, err)
+		}
+	} else {
+		tag, err := tx.Exec(ctx, sb.String())
+		if err != nil {
+			return 0, fmt.Errorf("merge into %s: %w", m.Table, err)
+		}
+		n = tag.RowsAffected()
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -2,17 +2,12 @@ package db
 
 import (
 	"context"
-	"embed"
 	"fmt"
 	"log/slog"
-	"strings"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-//go:embed migrations/*.sql
-var migrationsFS embed.FS
-
 // Connect creates a new pgx connection pool.
 func Connect(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 	config, err := pgxpool.ParseConfig(dsn)
@@ -33,30 +28,3 @@ func Connect(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 	slog.Info("connected to database")
 	return pool, nil
 }
-
-// Migrate runs all SQL migration files in order.
-func Migrate(ctx context.Context, pool *pgxpool.Pool) error {
-	entries, err := migrationsFS.ReadDir("migrations")
-	if err != nil {
-		return fmt.Errorf("read migrations dir: %w", err)
-	}
-
-	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
-			continue
-		}
-
-		data, err := migrationsFS.ReadFile("migrations/" + entry.Name())
-		if err != nil {
-			return fmt.Errorf("read migration %s: %w", entry.Name(), err)
-		}
-
-		slog.Info("running migration", "file", entry.Name())
-		if _, err := pool.Exec(ctx, string(data)); err != nil {
-			return fmt.Errorf("exec migration %s: %w", entry.Name(), err)
-		}
-	}
-
-	slog.Info("all migrations completed")
-	return nil
-}
@@ -0,0 +1,360 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockID is the pg_advisory_lock key held while migrating, so
+// instances booting at the same time apply each migration exactly once.
+const migrationLockID = 0x6561727468_6d63 // "earthmc"
+
+// noTxMarker on the first line of a migration runs it outside a transaction,
+// for a file holding a single statement such as CREATE INDEX CONCURRENTLY.
+const noTxMarker = "-- migrate:no-transaction"
+
+// Migration is one versioned schema change. Files are named
+// NNN_name.sql (up) with an optional NNN_name.down.sql.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationState is a migration as reported by MigrationStatus.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+	// Modified is true when the applied checksum differs from the embedded file.
+	Modified bool
+}
+
+// loadMigrations reads and orders the embedded migration files.
+func loadMigrations() ([]Migration, error) {
+	dir, err := fs.Sub(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return parseMigrations(dir)
+}
+
+// parseMigrations reads and orders the migration files in fsys.
+func parseMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations dir: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+
+		isDown := strings.HasSuffix(name, ".down.sql")
+		base := strings.TrimSuffix(strings.TrimSuffix(name, ".sql"), ".down")
+		prefix, label, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: expected NNN_name.sql", name)
+		}
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version: %w", name, err)
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", name, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if m.Name != label {
+			return nil, fmt.Errorf("migration %d has mismatched names %q and %q", version, m.Name, label)
+		}
+		if isDown {
+			m.Down = string(data)
+		} else {
+			m.Up = string(data)
+			sum := sha256.Sum256(data)
+			m.Checksum = hex.EncodeToString(sum[:])
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has a down file but no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrate applies every pending migration in order. It is what the worker
+// runs on boot.
+func Migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	return withMigrationLock(ctx, pool, func(conn *pgx.Conn) error {
+		migrations, applied, err := migrationState(ctx, conn)
+		if err != nil {
+			return err
+		}
+		todo, err := pending(migrations, applied)
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		for _, m := range todo {
+			slog.Info("applying migration", "version", m.Version, "name", m.Name)
+			start := time.Now()
+			err := runMigration(ctx, conn, m.Up, func(q execer) error {
+				_, err := q.Exec(ctx, `
+					INSERT INTO schema_migrations (version, name, checksum, duration_ms)
+					VALUES ($1, $2, $3, $4)`,
+					m.Version, m.Name, m.Checksum, time.Since(start).Milliseconds())
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("apply migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			count++
+		}
+
+		slog.Info("all migrations completed", "applied", count)
+		return nil
+	})
+}
+
+// pending returns the migrations not yet applied, in order. It fails if an
+// applied migration's file has changed since, by checksum.
+func pending(migrations []Migration, applied map[int64]string) ([]Migration, error) {
+	var todo []Migration
+	for _, m := range migrations {
+		sum, ok := applied[m.Version]
+		if !ok {
+			todo = append(todo, m)
+			continue
+		}
+		if sum != m.Checksum {
+			return nil, fmt.Errorf("migration %d_%s was modified after being applied (checksum mismatch)", m.Version, m.Name)
+		}
+	}
+	return todo, nil
+}
+
+// MigrateDown rolls back the latest steps applied migrations using their
+// down files.
+func MigrateDown(ctx context.Context, pool *pgxpool.Pool, steps int) error {
+	return withMigrationLock(ctx, pool, func(conn *pgx.Conn) error {
+		migrations, applied, err := migrationState(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+			}
+
+			slog.Info("reverting migration", "version", m.Version, "name", m.Name)
+			err := runMigration(ctx, conn, m.Down, func(q execer) error {
+				_, err := q.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", m.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("revert migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			steps--
+		}
+		return nil
+	})
+}
+
+// MigrationStatus lists every embedded migration and whether it is applied.
+func MigrationStatus(ctx context.Context, pool *pgxpool.Pool) ([]MigrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if err := ensureMigrationsTable(ctx, conn.Conn()); err != nil {
+		return nil, err
+	}
+
+	rows, err := conn.Query(ctx, "SELECT version, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	type appliedRow struct {
+		checksum string
+		at       time.Time
+	}
+	applied := make(map[int64]appliedRow)
+	for rows.Next() {
+		var (
+			v int64
+			r appliedRow
+		)
+		if err := rows.Scan(&v, &r.checksum, &r.at); err != nil {
+			return nil, err
+		}
+		applied[v] = r
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i].Migration = m
+		if r, ok := applied[m.Version]; ok {
+			at := r.at
+			states[i].AppliedAt = &at
+			states[i].Modified = r.checksum != m.Checksum
+		}
+	}
+	return states, nil
+}
+
+// execer is satisfied by both *pgx.Conn and pgx.Tx.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// runMigration executes sql and then record, in one transaction unless the
+// file opts out with noTxMarker.
+func runMigration(ctx context.Context, conn *pgx.Conn, sql string, record func(execer) error) error {
+	if noTransaction(sql) {
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			return err
+		}
+		return record(conn)
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+	if err := record(tx); err != nil {
+		return fmt.Errorf("record: %w", err)
+	}
+	return tx.Commit(ctx)
+}
+
+// noTransaction reports whether sql opts out of a transaction with
+// noTxMarker.
+func noTransaction(sql string) bool {
+	return strings.HasPrefix(strings.TrimSpace(sql), noTxMarker)
+}
+
+// withMigrationLock runs fn on a single connection holding the migration
+// advisory lock.
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(*pgx.Conn) error) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	slog.Info("waiting for migration lock")
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", int64(migrationLockID)); err != nil {
+		return fmt.Errorf("take migration lock: %w", err)
+	}
+	defer func() {
+		// Use a fresh context so the lock is released even on cancellation.
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.Exec(unlockCtx, "SELECT pg_advisory_unlock($1)", int64(migrationLockID)); err != nil {
+			slog.Warn("failed to release migration lock", "error", err)
+		}
+	}()
+
+	if err := ensureMigrationsTable(ctx, conn.Conn()); err != nil {
+		return err
+	}
+	return fn(conn.Conn())
+}
+
+func ensureMigrationsTable(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version     BIGINT PRIMARY KEY,
+			name        TEXT NOT NULL,
+			checksum    TEXT NOT NULL,
+			applied_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			duration_ms BIGINT
+		)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// migrationState returns the embedded migrations and the checksums of those
+// already applied.
+func migrationState(ctx context.Context, conn *pgx.Conn) ([]Migration, map[int64]string, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := conn.Query(ctx, "SELECT version, checksum FROM schema_migrations")
+	if err != nil {
+		return nil, nil, fmt.Errorf("query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]string)
+	for rows.Next() {
+		var (
+			v   int64
+			sum string
+		)
+		if err := rows.Scan(&v, &sum); err != nil {
+			return nil, nil, err
+		}
+		applied[v] = sum
+	}
+	return migrations, applied, rows.Err()
+}
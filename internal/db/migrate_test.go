@@ -0,0 +1,170 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func file(s string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(s)}
+}
+
+func checksum(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_add_towns.sql":      file("CREATE TABLE towns ();"),
+		"001_initial.sql":        file("CREATE TABLE players ();"),
+		"001_initial.down.sql":   file("DROP TABLE players;"),
+		"010_index.sql":          file(noTxMarker + "\nCREATE INDEX CONCURRENTLY i ON towns (x);"),
+		"README.md":              file("not a migration"),
+		"archive/003_old.sql":    file("ignored: directories are skipped"),
+		"002_add_towns.down.sql": file("DROP TABLE towns;"),
+	}
+	got, err := parseMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Migration{
+		{Version: 1, Name: "initial", Up: "CREATE TABLE players ();", Down: "DROP TABLE players;"},
+		{Version: 2, Name: "add_towns", Up: "CREATE TABLE towns ();", Down: "DROP TABLE towns;"},
+		{Version: 10, Name: "index", Up: noTxMarker + "\nCREATE INDEX CONCURRENTLY i ON towns (x);"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parsed %d migrations, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		w.Checksum = checksum(w.Up)
+		if got[i] != w {
+			t.Errorf("migration %d = %+v, want %+v", i, got[i], w)
+		}
+	}
+}
+
+func TestParseMigrationsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{
+			name: "no name",
+			fsys: fstest.MapFS{"001.sql": file("")},
+			want: "expected NNN_name.sql",
+		},
+		{
+			name: "bad version",
+			fsys: fstest.MapFS{"one_initial.sql": file("")},
+			want: "invalid version",
+		},
+		{
+			name: "down without up",
+			fsys: fstest.MapFS{"001_initial.sql": file("x"), "002_towns.down.sql": file("y")},
+			want: "has a down file but no up file",
+		},
+		{
+			name: "names differ",
+			fsys: fstest.MapFS{"001_initial.sql": file("x"), "001_first.down.sql": file("y")},
+			want: "mismatched names",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseMigrations(tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestEmbeddedMigrations checks the shipped files: numbered without gaps,
+// and each one revertible.
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s is number %d in order", m.Version, m.Name, i+1)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+	}
+}
+
+func TestPending(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "initial", Checksum: "a"},
+		{Version: 2, Name: "towns", Checksum: "b"},
+		{Version: 3, Name: "index", Checksum: "c"},
+	}
+
+	tests := []struct {
+		name    string
+		applied map[int64]string
+		want    []int64
+		wantErr string
+	}{
+		{"fresh database", map[int64]string{}, []int64{1, 2, 3}, ""},
+		{"partly applied", map[int64]string{1: "a"}, []int64{2, 3}, ""},
+		{"up to date", map[int64]string{1: "a", 2: "b", 3: "c"}, nil, ""},
+		{"gap is filled", map[int64]string{1: "a", 3: "c"}, []int64{2}, ""},
+		{"edited after applying", map[int64]string{1: "a", 2: "stale"}, nil, "migration 2_towns was modified after being applied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			todo, err := pending(migrations, tt.applied)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int64
+			for _, m := range todo {
+				got = append(got, m.Version)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("pending = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("pending = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNoTransaction(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{noTxMarker + "\nCREATE INDEX CONCURRENTLY i ON t (x);", true},
+		{"\n  " + noTxMarker + "\nCREATE INDEX CONCURRENTLY i ON t (x);", true},
+		{"CREATE TABLE t ();", false},
+		{"-- comment\n" + noTxMarker + "\nCREATE INDEX CONCURRENTLY i ON t (x);", false},
+	}
+	for _, tt := range tests {
+		if got := noTransaction(tt.sql); got != tt.want {
+			t.Errorf("noTransaction(%q) = %v, want %v", tt.sql, got, tt.want)
+		}
+	}
+}
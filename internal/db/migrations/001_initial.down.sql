@@ -0,0 +1,21 @@
+-- Reverts 001_initial: drops every base table. All scraped data is lost.
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_cron') THEN
+        PERFORM cron.unschedule(jobid) FROM cron.job WHERE jobname = 'create_activity_partitions_job';
+    END IF;
+EXCEPTION
+    WHEN OTHERS THEN
+        RAISE NOTICE 'Skipping pg_cron cleanup due to environment restrictions.';
+END $$;
+
+DROP TABLE IF EXISTS nation_snapshots;
+DROP TABLE IF EXISTS town_snapshots;
+DROP TABLE IF EXISTS player_snapshots;
+DROP TABLE IF EXISTS server_snapshots;
+DROP TABLE IF EXISTS player_activity;
+DROP FUNCTION IF EXISTS create_activity_partitions(TIMESTAMPTZ, INT);
+DROP TABLE IF EXISTS nations;
+DROP TABLE IF EXISTS towns;
+DROP TABLE IF EXISTS players;
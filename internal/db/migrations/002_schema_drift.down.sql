@@ -0,0 +1,3 @@
+-- Reverts 002_schema_drift.
+
+DROP TABLE IF EXISTS schema_drift;
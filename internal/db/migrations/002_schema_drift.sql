@@ -0,0 +1,19 @@
+-- ============================================================
+-- Schema drift: differences between sampled API payloads and the
+-- typed structs in internal/api/types.go. One row per
+-- (entity, path, change); last_seen moves while the drift persists.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS schema_drift (
+    id            BIGSERIAL PRIMARY KEY,
+    entity        TEXT NOT NULL,
+    path          TEXT NOT NULL,
+    change        TEXT NOT NULL,
+    expected_type TEXT,
+    observed_type TEXT,
+    first_seen    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    occurrences   BIGINT NOT NULL DEFAULT 1,
+    UNIQUE (entity, path, change)
+);
+CREATE INDEX IF NOT EXISTS idx_schema_drift_last_seen ON schema_drift (last_seen);
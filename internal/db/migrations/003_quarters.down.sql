@@ -0,0 +1,3 @@
+-- Reverts 003_quarters. Quarter history is lost.
+
+DROP TABLE IF EXISTS quarter_snapshots;
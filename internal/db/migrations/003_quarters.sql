@@ -0,0 +1,19 @@
+-- ============================================================
+-- Low-frequency: Quarter Snapshots (every 3 min)
+-- Quarters are plots inside a town that can be owned or rented.
+-- town_uuid and owner_uuid are lifted out of data for lookups.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS quarter_snapshots (
+    id           BIGSERIAL PRIMARY KEY,
+    snapshot_ts  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    quarter_uuid TEXT NOT NULL,
+    quarter_name TEXT,
+    town_uuid    TEXT,
+    owner_uuid   TEXT,
+    data         JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_quarter_snapshots_ts ON quarter_snapshots (snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_quarter_snapshots_quarter ON quarter_snapshots (quarter_uuid, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_quarter_snapshots_town ON quarter_snapshots (town_uuid, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_quarter_snapshots_owner ON quarter_snapshots (owner_uuid, snapshot_ts);
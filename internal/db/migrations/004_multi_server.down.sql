@@ -0,0 +1,25 @@
+-- Reverts 004_multi_server. Fails (and rolls back) if the same UUID
+-- exists on more than one server; delete the other servers' rows first.
+
+DROP INDEX IF EXISTS idx_schema_drift_key;
+ALTER TABLE schema_drift DROP COLUMN IF EXISTS server_id;
+ALTER TABLE schema_drift ADD CONSTRAINT schema_drift_entity_path_change_key UNIQUE (entity, path, change);
+
+ALTER TABLE quarter_snapshots DROP COLUMN IF EXISTS server_id;
+ALTER TABLE nation_snapshots  DROP COLUMN IF EXISTS server_id;
+ALTER TABLE town_snapshots    DROP COLUMN IF EXISTS server_id;
+ALTER TABLE player_snapshots  DROP COLUMN IF EXISTS server_id;
+ALTER TABLE server_snapshots  DROP COLUMN IF EXISTS server_id;
+ALTER TABLE player_activity   DROP COLUMN IF EXISTS server_id;
+
+ALTER TABLE players DROP CONSTRAINT players_pkey;
+ALTER TABLE players DROP COLUMN server_id;
+ALTER TABLE players ADD PRIMARY KEY (uuid);
+
+ALTER TABLE towns DROP CONSTRAINT towns_pkey;
+ALTER TABLE towns DROP COLUMN server_id;
+ALTER TABLE towns ADD PRIMARY KEY (uuid);
+
+ALTER TABLE nations DROP CONSTRAINT nations_pkey;
+ALTER TABLE nations DROP COLUMN server_id;
+ALTER TABLE nations ADD PRIMARY KEY (uuid);
@@ -0,0 +1,56 @@
+-- ============================================================
+-- Multi-server support: every row carries the EarthMC server
+-- (map) it was scraped from, e.g. 'aurora' or 'nova'.
+-- Rows written before this migration all came from Aurora, so
+-- the column defaults to 'aurora' to backfill them in place.
+-- ============================================================
+
+-- Dimension tables: the same UUID can exist on several servers,
+-- so the primary key becomes (server_id, uuid).
+ALTER TABLE players ADD COLUMN IF NOT EXISTS server_id TEXT NOT NULL DEFAULT 'aurora';
+ALTER TABLE towns   ADD COLUMN IF NOT EXISTS server_id TEXT NOT NULL DEFAULT 'aurora';
+ALTER TABLE nations ADD COLUMN IF NOT EXISTS server_id TEXT NOT NULL DEFAULT 'aurora';
+
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['players', 'towns', 'nations'] LOOP
+        IF NOT EXISTS (
+            SELECT 1
+            FROM pg_index i
+            JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY (i.indkey)
+            WHERE i.indrelid = t::regclass AND i.indisprimary AND a.attname = 'server_id'
+        ) THEN
+            EXECUTE FORMAT('ALTER TABLE %I DROP CONSTRAINT %I', t, t || '_pkey');
+            EXECUTE FORMAT('ALTER TABLE %I ADD PRIMARY KEY (server_id, uuid)', t);
+        END IF;
+    END LOOP;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_players_server_name ON players (server_id, name);
+CREATE INDEX IF NOT EXISTS idx_towns_server_name ON towns (server_id, name);
+CREATE INDEX IF NOT EXISTS idx_nations_server_name ON nations (server_id, name);
+
+-- High-frequency activity (propagates to every hourly partition)
+ALTER TABLE player_activity ADD COLUMN IF NOT EXISTS server_id TEXT NOT NULL DEFAULT 'aurora';
+CREATE INDEX IF NOT EXISTS idx_player_activity_server_player ON player_activity (server_id, player_uuid, snapshot_ts);
+
+-- Low-frequency snapshots
+ALTER TABLE server_snapshots  ADD COLUMN IF NOT EXISTS server_id TEXT NOT NULL DEFAULT 'aurora';
+ALTER TABLE player_snapshots  ADD COLUMN IF NOT EXISTS server_id TEXT NOT NULL DEFAULT 'aurora';
+ALTER TABLE town_snapshots    ADD COLUMN IF NOT EXISTS server_id TEXT NOT NULL DEFAULT 'aurora';
+ALTER TABLE nation_snapshots  ADD COLUMN IF NOT EXISTS server_id TEXT NOT NULL DEFAULT 'aurora';
+ALTER TABLE quarter_snapshots ADD COLUMN IF NOT EXISTS server_id TEXT NOT NULL DEFAULT 'aurora';
+
+CREATE INDEX IF NOT EXISTS idx_server_snapshots_server_ts ON server_snapshots (server_id, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_player_snapshots_server_player ON player_snapshots (server_id, player_uuid, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_town_snapshots_server_town ON town_snapshots (server_id, town_uuid, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_nation_snapshots_server_nation ON nation_snapshots (server_id, nation_uuid, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_quarter_snapshots_server_quarter ON quarter_snapshots (server_id, quarter_uuid, snapshot_ts);
+
+-- Schema drift is tracked per server, since maps can run different
+-- API versions.
+ALTER TABLE schema_drift ADD COLUMN IF NOT EXISTS server_id TEXT NOT NULL DEFAULT 'aurora';
+ALTER TABLE schema_drift DROP CONSTRAINT IF EXISTS schema_drift_entity_path_change_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_schema_drift_key ON schema_drift (server_id, entity, path, change);
@@ -0,0 +1,14 @@
+-- Reverts 005_snapshot_dedup. Snapshots already deduplicated stay
+-- sparse; only the bookkeeping is removed.
+
+DROP VIEW IF EXISTS player_snapshots_filled;
+DROP VIEW IF EXISTS nation_snapshots_filled;
+DROP VIEW IF EXISTS town_snapshots_filled;
+DROP TABLE IF EXISTS snapshot_ticks;
+
+ALTER TABLE player_snapshots DROP COLUMN IF EXISTS observed_until;
+ALTER TABLE player_snapshots DROP COLUMN IF EXISTS content_hash;
+ALTER TABLE nation_snapshots DROP COLUMN IF EXISTS observed_until;
+ALTER TABLE nation_snapshots DROP COLUMN IF EXISTS content_hash;
+ALTER TABLE town_snapshots   DROP COLUMN IF EXISTS observed_until;
+ALTER TABLE town_snapshots   DROP COLUMN IF EXISTS content_hash;
@@ -0,0 +1,63 @@
+-- ============================================================
+-- Change-only snapshots: the low-freq loop writes a new town,
+-- nation or player snapshot only when the entity's content hash
+-- changes. Unchanged entities just move observed_until forward.
+-- Rows written before this migration have no hash and are their
+-- own single observation (observed_until NULL = snapshot_ts).
+-- ============================================================
+
+ALTER TABLE town_snapshots   ADD COLUMN IF NOT EXISTS content_hash TEXT;
+ALTER TABLE town_snapshots   ADD COLUMN IF NOT EXISTS observed_until TIMESTAMPTZ;
+ALTER TABLE nation_snapshots ADD COLUMN IF NOT EXISTS content_hash TEXT;
+ALTER TABLE nation_snapshots ADD COLUMN IF NOT EXISTS observed_until TIMESTAMPTZ;
+ALTER TABLE player_snapshots ADD COLUMN IF NOT EXISTS content_hash TEXT;
+ALTER TABLE player_snapshots ADD COLUMN IF NOT EXISTS observed_until TIMESTAMPTZ;
+
+-- Every completed low-freq scrape per server and kind
+-- ('town', 'nation', 'player'), so the views below know which
+-- ticks to fill.
+CREATE TABLE IF NOT EXISTS snapshot_ticks (
+    server_id   TEXT NOT NULL,
+    kind        TEXT NOT NULL,
+    snapshot_ts TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (server_id, kind, snapshot_ts)
+);
+
+-- One-time backfill of ticks from the full snapshots taken so far
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM snapshot_ticks) THEN
+        INSERT INTO snapshot_ticks (server_id, kind, snapshot_ts)
+        SELECT DISTINCT server_id, 'town', snapshot_ts FROM town_snapshots
+        UNION
+        SELECT DISTINCT server_id, 'nation', snapshot_ts FROM nation_snapshots
+        UNION
+        SELECT DISTINCT server_id, 'player', snapshot_ts FROM player_snapshots;
+    END IF;
+END $$;
+
+-- Dense views with the original one-row-per-entity-per-tick
+-- semantics. changed_ts is when this content was first seen.
+CREATE OR REPLACE VIEW town_snapshots_filled AS
+SELECT s.id, s.server_id, t.snapshot_ts, s.town_uuid, s.town_name, s.data, s.snapshot_ts AS changed_ts
+FROM town_snapshots s
+JOIN snapshot_ticks t
+  ON t.server_id = s.server_id
+ AND t.kind = 'town'
+ AND t.snapshot_ts BETWEEN s.snapshot_ts AND COALESCE(s.observed_until, s.snapshot_ts);
+
+CREATE OR REPLACE VIEW nation_snapshots_filled AS
+SELECT s.id, s.server_id, t.snapshot_ts, s.nation_uuid, s.nation_name, s.data, s.snapshot_ts AS changed_ts
+FROM nation_snapshots s
+JOIN snapshot_ticks t
+  ON t.server_id = s.server_id
+ AND t.kind = 'nation'
+ AND t.snapshot_ts BETWEEN s.snapshot_ts AND COALESCE(s.observed_until, s.snapshot_ts);
+
+CREATE OR REPLACE VIEW player_snapshots_filled AS
+SELECT s.id, s.server_id, t.snapshot_ts, s.player_uuid, s.player_name, s.data, s.snapshot_ts AS changed_ts
+FROM player_snapshots s
+JOIN snapshot_ticks t
+  ON t.server_id = s.server_id
+ AND t.kind = 'player'
+ AND t.snapshot_ts BETWEEN s.snapshot_ts AND COALESCE(s.observed_until, s.snapshot_ts);
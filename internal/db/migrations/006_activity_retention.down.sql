@@ -0,0 +1,17 @@
+-- Reverts 006_activity_retention. Rolled-up history is lost.
+
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_cron') THEN
+        PERFORM cron.unschedule(jobid) FROM cron.job WHERE jobname = 'activity_retention_job';
+    END IF;
+EXCEPTION
+    WHEN OTHERS THEN
+        RAISE NOTICE 'Skipping pg_cron cleanup due to environment restrictions.';
+END $$;
+
+DROP FUNCTION IF EXISTS enforce_activity_retention(INTERVAL, INT);
+DROP FUNCTION IF EXISTS rollup_activity_hour(TIMESTAMPTZ, INT);
+DROP TABLE IF EXISTS activity_rollups;
+DROP TABLE IF EXISTS player_activity_hourly;
+DROP TABLE IF EXISTS player_activity_minutely;
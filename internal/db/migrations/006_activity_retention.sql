@@ -0,0 +1,160 @@
+-- ============================================================
+-- Retention for player_activity: completed hours are summarised
+-- into per-minute and per-hour tables, then hourly partitions
+-- older than the raw retention window are detached and dropped.
+-- The worker drives this (ACTIVITY_RAW_RETENTION); where pg_cron
+-- is available it also schedules enforce_activity_retention.
+-- ============================================================
+
+-- One row per player per minute. x/y/z/world are the last visible
+-- position in the minute; min/max x/z bound all visible positions.
+CREATE TABLE IF NOT EXISTS player_activity_minutely (
+    server_id       TEXT NOT NULL,
+    player_uuid     TEXT NOT NULL,
+    bucket          TIMESTAMPTZ NOT NULL,
+    player_name     TEXT NOT NULL,
+    samples         INTEGER NOT NULL,
+    visible_samples INTEGER NOT NULL,
+    online_seconds  INTEGER NOT NULL,
+    x               INTEGER,
+    y               INTEGER,
+    z               INTEGER,
+    world           TEXT,
+    min_x           INTEGER,
+    max_x           INTEGER,
+    min_z           INTEGER,
+    max_z           INTEGER,
+    worlds          TEXT[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (server_id, player_uuid, bucket)
+);
+CREATE INDEX IF NOT EXISTS idx_player_activity_minutely_bucket ON player_activity_minutely (server_id, bucket);
+
+-- One row per player per hour, aggregated from the minutely rows.
+CREATE TABLE IF NOT EXISTS player_activity_hourly (
+    server_id       TEXT NOT NULL,
+    player_uuid     TEXT NOT NULL,
+    bucket          TIMESTAMPTZ NOT NULL,
+    player_name     TEXT NOT NULL,
+    samples         INTEGER NOT NULL,
+    visible_samples INTEGER NOT NULL,
+    online_seconds  INTEGER NOT NULL,
+    min_x           INTEGER,
+    max_x           INTEGER,
+    min_z           INTEGER,
+    max_z           INTEGER,
+    worlds          TEXT[] NOT NULL DEFAULT '{}',
+    PRIMARY KEY (server_id, player_uuid, bucket)
+);
+CREATE INDEX IF NOT EXISTS idx_player_activity_hourly_bucket ON player_activity_hourly (server_id, bucket);
+
+-- Hours of raw activity that have been rolled up.
+CREATE TABLE IF NOT EXISTS activity_rollups (
+    hour         TIMESTAMPTZ PRIMARY KEY,
+    raw_rows     BIGINT NOT NULL,
+    rolled_up_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Summarises one hour of raw activity, replacing any earlier
+-- rollup of it. Each sample counts for the time until the server's
+-- next tick, capped at max_gap_seconds so scraper outages are not
+-- counted as online time. Returns the number of raw rows read.
+CREATE OR REPLACE FUNCTION rollup_activity_hour(hour_start TIMESTAMPTZ, max_gap_seconds INT DEFAULT 30)
+RETURNS BIGINT AS $$
+DECLARE
+    hour_end  TIMESTAMPTZ := hour_start + INTERVAL '1 hour';
+    raw_count BIGINT;
+BEGIN
+    DELETE FROM player_activity_minutely WHERE bucket >= hour_start AND bucket < hour_end;
+    DELETE FROM player_activity_hourly WHERE bucket = hour_start;
+
+    INSERT INTO player_activity_minutely (
+        server_id, player_uuid, bucket, player_name, samples, visible_samples, online_seconds,
+        x, y, z, world, min_x, max_x, min_z, max_z, worlds
+    )
+    WITH ticks AS (
+        SELECT server_id, snapshot_ts,
+               LEAST(COALESCE(
+                   EXTRACT(EPOCH FROM LEAD(snapshot_ts) OVER w - snapshot_ts),
+                   EXTRACT(EPOCH FROM snapshot_ts - LAG(snapshot_ts) OVER w),
+                   0), max_gap_seconds) AS seconds
+        FROM (
+            SELECT DISTINCT server_id, snapshot_ts
+            FROM player_activity
+            WHERE snapshot_ts >= hour_start AND snapshot_ts < hour_end
+        ) d
+        WINDOW w AS (PARTITION BY server_id ORDER BY snapshot_ts)
+    )
+    SELECT a.server_id, a.player_uuid, DATE_TRUNC('minute', a.snapshot_ts),
+           (ARRAY_AGG(a.player_name ORDER BY a.snapshot_ts DESC))[1],
+           COUNT(*),
+           COUNT(*) FILTER (WHERE a.is_visible),
+           COALESCE(ROUND(SUM(t.seconds) FILTER (WHERE a.is_online)), 0),
+           (ARRAY_AGG(a.x ORDER BY a.snapshot_ts DESC) FILTER (WHERE a.is_visible))[1],
+           (ARRAY_AGG(a.y ORDER BY a.snapshot_ts DESC) FILTER (WHERE a.is_visible))[1],
+           (ARRAY_AGG(a.z ORDER BY a.snapshot_ts DESC) FILTER (WHERE a.is_visible))[1],
+           (ARRAY_AGG(a.world ORDER BY a.snapshot_ts DESC) FILTER (WHERE a.is_visible))[1],
+           MIN(a.x), MAX(a.x), MIN(a.z), MAX(a.z),
+           COALESCE(ARRAY_AGG(DISTINCT a.world) FILTER (WHERE a.world IS NOT NULL), '{}')
+    FROM player_activity a
+    JOIN ticks t ON t.server_id = a.server_id AND t.snapshot_ts = a.snapshot_ts
+    WHERE a.snapshot_ts >= hour_start AND a.snapshot_ts < hour_end
+    GROUP BY a.server_id, a.player_uuid, DATE_TRUNC('minute', a.snapshot_ts);
+
+    INSERT INTO player_activity_hourly (
+        server_id, player_uuid, bucket, player_name, samples, visible_samples, online_seconds,
+        min_x, max_x, min_z, max_z, worlds
+    )
+    SELECT m.server_id, m.player_uuid, hour_start,
+           (ARRAY_AGG(m.player_name ORDER BY m.bucket DESC))[1],
+           SUM(m.samples), SUM(m.visible_samples), SUM(m.online_seconds),
+           MIN(m.min_x), MAX(m.max_x), MIN(m.min_z), MAX(m.max_z),
+           ARRAY(
+               SELECT DISTINCT w
+               FROM player_activity_minutely m2, UNNEST(m2.worlds) w
+               WHERE m2.server_id = m.server_id AND m2.player_uuid = m.player_uuid
+                 AND m2.bucket >= hour_start AND m2.bucket < hour_end
+           )
+    FROM player_activity_minutely m
+    WHERE m.bucket >= hour_start AND m.bucket < hour_end
+    GROUP BY m.server_id, m.player_uuid;
+
+    SELECT COALESCE(SUM(samples), 0) INTO raw_count
+    FROM player_activity_hourly WHERE bucket = hour_start;
+
+    INSERT INTO activity_rollups (hour, raw_rows) VALUES (hour_start, raw_count)
+    ON CONFLICT (hour) DO UPDATE SET raw_rows = EXCLUDED.raw_rows, rolled_up_at = NOW();
+
+    RETURN raw_count;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Rolls up any unsummarised hour older than raw_retention, then
+-- detaches and drops its partition. Returns the partitions dropped.
+-- This is what pg_cron runs; the worker does the same from Go.
+CREATE OR REPLACE FUNCTION enforce_activity_retention(raw_retention INTERVAL DEFAULT INTERVAL '14 days', max_gap_seconds INT DEFAULT 30)
+RETURNS INT AS $$
+DECLARE
+    part    RECORD;
+    dropped INT := 0;
+BEGIN
+    FOR part IN
+        SELECT c.relname AS name,
+               TO_TIMESTAMP(SUBSTRING(c.relname FROM '\d{8}_\d{6}$'), 'YYYYMMDD_HH24MISS') AS start_ts
+        FROM pg_inherits i
+        JOIN pg_class c ON c.oid = i.inhrelid
+        WHERE i.inhparent = 'player_activity'::regclass
+          AND c.relname ~ '^player_activity_\d{8}_\d{6}$'
+        ORDER BY 2
+    LOOP
+        EXIT WHEN part.start_ts + INTERVAL '1 hour' > NOW() - raw_retention;
+
+        IF NOT EXISTS (SELECT 1 FROM activity_rollups WHERE hour = part.start_ts) THEN
+            PERFORM rollup_activity_hour(part.start_ts, max_gap_seconds);
+        END IF;
+        EXECUTE FORMAT('ALTER TABLE player_activity DETACH PARTITION %I', part.name);
+        EXECUTE FORMAT('DROP TABLE %I', part.name);
+        dropped := dropped + 1;
+    END LOOP;
+    RETURN dropped;
+END;
+$$ LANGUAGE plpgsql;
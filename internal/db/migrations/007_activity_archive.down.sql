@@ -0,0 +1,3 @@
+-- Reverts 007_activity_archive. The archive files themselves are kept.
+
+DROP TABLE IF EXISTS activity_archives;
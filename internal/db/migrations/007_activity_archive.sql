@@ -0,0 +1,20 @@
+-- ============================================================
+-- Archive manifest: one row per hourly player_activity partition
+-- exported to zstd-compressed CSV before being dropped. location is
+-- relative to the archive sink (ACTIVITY_ARCHIVE_DIR).
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS activity_archives (
+    partition_name TEXT PRIMARY KEY,
+    hour           TIMESTAMPTZ NOT NULL UNIQUE,
+    location       TEXT NOT NULL,
+    format         TEXT NOT NULL,
+    row_count      BIGINT NOT NULL,
+    bytes          BIGINT NOT NULL,
+    sha256         TEXT NOT NULL,
+    archived_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Set by `worker restore`; retention leaves the re-attached
+    -- partition alone until keep_until.
+    restored_at    TIMESTAMPTZ,
+    keep_until     TIMESTAMPTZ
+);
@@ -0,0 +1,3 @@
+-- Reverts 008_player_sessions.
+
+DROP TABLE IF EXISTS player_sessions;
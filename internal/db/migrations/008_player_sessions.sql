@@ -0,0 +1,33 @@
+-- ============================================================
+-- Play sessions, maintained incrementally by the high-frequency
+-- loop. A session opens when a player appears in /online and
+-- closes once they have been absent for longer than the grace
+-- period (SESSION_GRACE). When the scraper itself was not running,
+-- the boundary is recorded as 'unknown' instead of a login/logout.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS player_sessions (
+    id               BIGSERIAL PRIMARY KEY,
+    server_id        TEXT NOT NULL,
+    player_uuid      TEXT NOT NULL,
+    player_name      TEXT NOT NULL,
+    started_at       TIMESTAMPTZ NOT NULL,  -- first sample seen online
+    start_reason     TEXT NOT NULL,         -- 'login' | 'unknown'
+    last_seen_at     TIMESTAMPTZ NOT NULL,  -- latest sample seen online
+    ended_at         TIMESTAMPTZ,           -- NULL while the session is open
+    end_reason       TEXT,                  -- 'logout' | 'unknown'
+    duration_seconds INTEGER GENERATED ALWAYS AS (EXTRACT(EPOCH FROM last_seen_at - started_at)::INTEGER) STORED,
+    samples          INTEGER NOT NULL,
+    visible_samples  INTEGER NOT NULL,
+    visible_ratio    REAL GENERATED ALWAYS AS (
+                         CASE WHEN samples > 0 THEN visible_samples::REAL / samples END
+                     ) STORED,
+    worlds           TEXT[] NOT NULL DEFAULT '{}',
+    min_x            INTEGER,
+    max_x            INTEGER,
+    min_z            INTEGER,
+    max_z            INTEGER
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_player_sessions_open ON player_sessions (server_id, player_uuid) WHERE ended_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_player_sessions_player ON player_sessions (server_id, player_uuid, started_at);
+CREATE INDEX IF NOT EXISTS idx_player_sessions_started ON player_sessions (server_id, started_at);
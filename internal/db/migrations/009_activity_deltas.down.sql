@@ -0,0 +1,77 @@
+-- Reverts 009_activity_deltas. Delta-written hours cannot be read
+-- densely afterwards; roll them up before reverting.
+
+-- Restore the 006 rollup, which reads raw rows directly.
+CREATE OR REPLACE FUNCTION rollup_activity_hour(hour_start TIMESTAMPTZ, max_gap_seconds INT DEFAULT 30)
+RETURNS BIGINT AS $$
+DECLARE
+    hour_end  TIMESTAMPTZ := hour_start + INTERVAL '1 hour';
+    raw_count BIGINT;
+BEGIN
+    DELETE FROM player_activity_minutely WHERE bucket >= hour_start AND bucket < hour_end;
+    DELETE FROM player_activity_hourly WHERE bucket = hour_start;
+
+    INSERT INTO player_activity_minutely (
+        server_id, player_uuid, bucket, player_name, samples, visible_samples, online_seconds,
+        x, y, z, world, min_x, max_x, min_z, max_z, worlds
+    )
+    WITH ticks AS (
+        SELECT server_id, snapshot_ts,
+               LEAST(COALESCE(
+                   EXTRACT(EPOCH FROM LEAD(snapshot_ts) OVER w - snapshot_ts),
+                   EXTRACT(EPOCH FROM snapshot_ts - LAG(snapshot_ts) OVER w),
+                   0), max_gap_seconds) AS seconds
+        FROM (
+            SELECT DISTINCT server_id, snapshot_ts
+            FROM player_activity
+            WHERE snapshot_ts >= hour_start AND snapshot_ts < hour_end
+        ) d
+        WINDOW w AS (PARTITION BY server_id ORDER BY snapshot_ts)
+    )
+    SELECT a.server_id, a.player_uuid, DATE_TRUNC('minute', a.snapshot_ts),
+           (ARRAY_AGG(a.player_name ORDER BY a.snapshot_ts DESC))[1],
+           COUNT(*),
+           COUNT(*) FILTER (WHERE a.is_visible),
+           COALESCE(ROUND(SUM(t.seconds) FILTER (WHERE a.is_online)), 0),
+           (ARRAY_AGG(a.x ORDER BY a.snapshot_ts DESC) FILTER (WHERE a.is_visible))[1],
+           (ARRAY_AGG(a.y ORDER BY a.snapshot_ts DESC) FILTER (WHERE a.is_visible))[1],
+           (ARRAY_AGG(a.z ORDER BY a.snapshot_ts DESC) FILTER (WHERE a.is_visible))[1],
+           (ARRAY_AGG(a.world ORDER BY a.snapshot_ts DESC) FILTER (WHERE a.is_visible))[1],
+           MIN(a.x), MAX(a.x), MIN(a.z), MAX(a.z),
+           COALESCE(ARRAY_AGG(DISTINCT a.world) FILTER (WHERE a.world IS NOT NULL), '{}')
+    FROM player_activity a
+    JOIN ticks t ON t.server_id = a.server_id AND t.snapshot_ts = a.snapshot_ts
+    WHERE a.snapshot_ts >= hour_start AND a.snapshot_ts < hour_end
+    GROUP BY a.server_id, a.player_uuid, DATE_TRUNC('minute', a.snapshot_ts);
+
+    INSERT INTO player_activity_hourly (
+        server_id, player_uuid, bucket, player_name, samples, visible_samples, online_seconds,
+        min_x, max_x, min_z, max_z, worlds
+    )
+    SELECT m.server_id, m.player_uuid, hour_start,
+           (ARRAY_AGG(m.player_name ORDER BY m.bucket DESC))[1],
+           SUM(m.samples), SUM(m.visible_samples), SUM(m.online_seconds),
+           MIN(m.min_x), MAX(m.max_x), MIN(m.min_z), MAX(m.max_z),
+           ARRAY(
+               SELECT DISTINCT w
+               FROM player_activity_minutely m2, UNNEST(m2.worlds) w
+               WHERE m2.server_id = m.server_id AND m2.player_uuid = m.player_uuid
+                 AND m2.bucket >= hour_start AND m2.bucket < hour_end
+           )
+    FROM player_activity_minutely m
+    WHERE m.bucket >= hour_start AND m.bucket < hour_end
+    GROUP BY m.server_id, m.player_uuid;
+
+    SELECT COALESCE(SUM(samples), 0) INTO raw_count
+    FROM player_activity_hourly WHERE bucket = hour_start;
+
+    INSERT INTO activity_rollups (hour, raw_rows) VALUES (hour_start, raw_count)
+    ON CONFLICT (hour) DO UPDATE SET raw_rows = EXCLUDED.raw_rows, rolled_up_at = NOW();
+
+    RETURN raw_count;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS player_activity_dense(TEXT, TIMESTAMPTZ, TIMESTAMPTZ);
+DROP TABLE IF EXISTS activity_ticks;
+ALTER TABLE player_activity DROP COLUMN IF EXISTS is_keyframe;
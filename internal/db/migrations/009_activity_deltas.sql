@@ -0,0 +1,146 @@
+-- ============================================================
+-- Delta writes for player_activity: the high-frequency loop
+-- writes a row only when a player's position, world, visibility
+-- or online status changes (an is_online = FALSE row marks them
+-- leaving), plus a keyframe with every online player every
+-- KEYFRAME_INTERVAL and on the first tick of each hour, so every
+-- hourly partition can be reconstructed on its own.
+-- Rows written before this migration were one per player per
+-- tick, so they count as keyframes.
+-- ============================================================
+
+ALTER TABLE player_activity ADD COLUMN IF NOT EXISTS is_keyframe BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Every successful high-frequency tick, including ones where
+-- nothing changed.
+CREATE TABLE IF NOT EXISTS activity_ticks (
+    server_id   TEXT NOT NULL,
+    snapshot_ts TIMESTAMPTZ NOT NULL,
+    is_keyframe BOOLEAN NOT NULL,
+    PRIMARY KEY (server_id, snapshot_ts)
+);
+CREATE INDEX IF NOT EXISTS idx_activity_ticks_keyframes ON activity_ticks (server_id, snapshot_ts) WHERE is_keyframe;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM activity_ticks) THEN
+        INSERT INTO activity_ticks (server_id, snapshot_ts, is_keyframe)
+        SELECT DISTINCT server_id, snapshot_ts, TRUE FROM player_activity;
+    END IF;
+END $$;
+
+-- Dense timeline: one row per online player per tick between
+-- p_from and p_to, as if every tick had been written in full.
+-- A change row holds until the player's next row or the next
+-- keyframe, whichever comes first. changed_ts is when the state
+-- was written.
+CREATE OR REPLACE FUNCTION player_activity_dense(p_server TEXT, p_from TIMESTAMPTZ, p_to TIMESTAMPTZ)
+RETURNS TABLE (
+    snapshot_ts TIMESTAMPTZ,
+    player_uuid TEXT,
+    player_name TEXT,
+    is_visible  BOOLEAN,
+    x           INTEGER,
+    y           INTEGER,
+    z           INTEGER,
+    yaw         INTEGER,
+    world       TEXT,
+    changed_ts  TIMESTAMPTZ
+) AS $$
+    WITH bounds AS (
+        SELECT COALESCE(MAX(k.snapshot_ts), p_from) AS since
+        FROM activity_ticks k
+        WHERE k.server_id = p_server AND k.is_keyframe AND k.snapshot_ts <= p_from
+    ),
+    changes AS (
+        SELECT a.snapshot_ts, a.player_uuid, a.player_name, a.is_online, a.is_visible,
+               a.x, a.y, a.z, a.yaw, a.world,
+               LEAD(a.snapshot_ts) OVER (PARTITION BY a.player_uuid ORDER BY a.snapshot_ts) AS next_ts,
+               (SELECT MIN(k.snapshot_ts) FROM activity_ticks k
+                WHERE k.server_id = p_server AND k.is_keyframe AND k.snapshot_ts > a.snapshot_ts) AS next_keyframe
+        FROM player_activity a, bounds b
+        WHERE a.server_id = p_server AND a.snapshot_ts >= b.since AND a.snapshot_ts <= p_to
+    )
+    SELECT t.snapshot_ts, c.player_uuid, c.player_name, c.is_visible,
+           c.x, c.y, c.z, c.yaw, c.world, c.snapshot_ts
+    FROM changes c
+    JOIN activity_ticks t
+      ON t.server_id = p_server
+     AND t.snapshot_ts >= GREATEST(c.snapshot_ts, p_from)
+     AND t.snapshot_ts <= p_to
+     AND t.snapshot_ts < LEAST(COALESCE(c.next_ts, 'infinity'), COALESCE(c.next_keyframe, 'infinity'))
+    WHERE c.is_online
+$$ LANGUAGE sql STABLE;
+
+-- Rollups now read the dense timeline, so samples still count
+-- online ticks rather than written rows.
+CREATE OR REPLACE FUNCTION rollup_activity_hour(hour_start TIMESTAMPTZ, max_gap_seconds INT DEFAULT 30)
+RETURNS BIGINT AS $$
+DECLARE
+    hour_end  TIMESTAMPTZ := hour_start + INTERVAL '1 hour';
+    raw_count BIGINT;
+BEGIN
+    DELETE FROM player_activity_minutely WHERE bucket >= hour_start AND bucket < hour_end;
+    DELETE FROM player_activity_hourly WHERE bucket = hour_start;
+
+    INSERT INTO player_activity_minutely (
+        server_id, player_uuid, bucket, player_name, samples, visible_samples, online_seconds,
+        x, y, z, world, min_x, max_x, min_z, max_z, worlds
+    )
+    WITH ticks AS (
+        SELECT k.server_id, k.snapshot_ts,
+               LEAST(COALESCE(
+                   EXTRACT(EPOCH FROM LEAD(k.snapshot_ts) OVER w - k.snapshot_ts),
+                   EXTRACT(EPOCH FROM k.snapshot_ts - LAG(k.snapshot_ts) OVER w),
+                   0), max_gap_seconds) AS seconds
+        FROM activity_ticks k
+        WHERE k.snapshot_ts >= hour_start AND k.snapshot_ts < hour_end
+        WINDOW w AS (PARTITION BY k.server_id ORDER BY k.snapshot_ts)
+    ),
+    dense AS (
+        SELECT s.server_id, d.*
+        FROM (SELECT DISTINCT server_id FROM ticks) s
+        CROSS JOIN LATERAL player_activity_dense(s.server_id, hour_start, hour_end - INTERVAL '1 microsecond') d
+    )
+    SELECT a.server_id, a.player_uuid, DATE_TRUNC('minute', a.snapshot_ts),
+           (ARRAY_AGG(a.player_name ORDER BY a.snapshot_ts DESC))[1],
+           COUNT(*),
+           COUNT(*) FILTER (WHERE a.is_visible),
+           COALESCE(ROUND(SUM(t.seconds)), 0),
+           (ARRAY_AGG(a.x ORDER BY a.snapshot_ts DESC) FILTER (WHERE a.is_visible))[1],
+           (ARRAY_AGG(a.y ORDER BY a.snapshot_ts DESC) FILTER (WHERE a.is_visible))[1],
+           (ARRAY_AGG(a.z ORDER BY a.snapshot_ts DESC) FILTER (WHERE a.is_visible))[1],
+           (ARRAY_AGG(a.world ORDER BY a.snapshot_ts DESC) FILTER (WHERE a.is_visible))[1],
+           MIN(a.x), MAX(a.x), MIN(a.z), MAX(a.z),
+           COALESCE(ARRAY_AGG(DISTINCT a.world) FILTER (WHERE a.world IS NOT NULL), '{}')
+    FROM dense a
+    JOIN ticks t ON t.server_id = a.server_id AND t.snapshot_ts = a.snapshot_ts
+    GROUP BY a.server_id, a.player_uuid, DATE_TRUNC('minute', a.snapshot_ts);
+
+    INSERT INTO player_activity_hourly (
+        server_id, player_uuid, bucket, player_name, samples, visible_samples, online_seconds,
+        min_x, max_x, min_z, max_z, worlds
+    )
+    SELECT m.server_id, m.player_uuid, hour_start,
+           (ARRAY_AGG(m.player_name ORDER BY m.bucket DESC))[1],
+           SUM(m.samples), SUM(m.visible_samples), SUM(m.online_seconds),
+           MIN(m.min_x), MAX(m.max_x), MIN(m.min_z), MAX(m.max_z),
+           ARRAY(
+               SELECT DISTINCT w
+               FROM player_activity_minutely m2, UNNEST(m2.worlds) w
+               WHERE m2.server_id = m.server_id AND m2.player_uuid = m.player_uuid
+                 AND m2.bucket >= hour_start AND m2.bucket < hour_end
+           )
+    FROM player_activity_minutely m
+    WHERE m.bucket >= hour_start AND m.bucket < hour_end
+    GROUP BY m.server_id, m.player_uuid;
+
+    SELECT COALESCE(SUM(samples), 0) INTO raw_count
+    FROM player_activity_hourly WHERE bucket = hour_start;
+
+    INSERT INTO activity_rollups (hour, raw_rows) VALUES (hour_start, raw_count)
+    ON CONFLICT (hour) DO UPDATE SET raw_rows = EXCLUDED.raw_rows, rolled_up_at = NOW();
+
+    RETURN raw_count;
+END;
+$$ LANGUAGE plpgsql;
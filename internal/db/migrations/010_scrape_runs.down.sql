@@ -0,0 +1,10 @@
+-- Reverts 010_scrape_runs.
+
+ALTER TABLE activity_ticks    DROP COLUMN IF EXISTS run_id;
+ALTER TABLE quarter_snapshots DROP COLUMN IF EXISTS run_id;
+ALTER TABLE player_snapshots  DROP COLUMN IF EXISTS run_id;
+ALTER TABLE nation_snapshots  DROP COLUMN IF EXISTS run_id;
+ALTER TABLE town_snapshots    DROP COLUMN IF EXISTS run_id;
+ALTER TABLE server_snapshots  DROP COLUMN IF EXISTS run_id;
+
+DROP TABLE IF EXISTS scrape_runs;
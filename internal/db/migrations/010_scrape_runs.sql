@@ -0,0 +1,37 @@
+-- ============================================================
+-- scrape_runs: one row per high- or low-frequency tick, so a
+-- gap in the data can be told apart from an empty server.
+-- Run ids are generated by the worker, and every write upserts
+-- its run first, so rows replayed from the spool still satisfy
+-- the foreign keys below. Change-only snapshot rows point at
+-- the run that first saw that content.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS scrape_runs (
+    id                UUID PRIMARY KEY,
+    server_id         TEXT NOT NULL,
+    loop              TEXT NOT NULL,                 -- 'high' or 'low'
+    snapshot_ts       TIMESTAMPTZ NOT NULL,          -- timestamp on the rows the run wrote
+    started_at        TIMESTAMPTZ NOT NULL,
+    finished_at       TIMESTAMPTZ,                   -- NULL while running (or if it never reported back)
+    status            TEXT NOT NULL DEFAULT 'running', -- running, ok, partial, failed, skipped
+    skipped           BOOLEAN NOT NULL DEFAULT FALSE, -- the previous tick was still running
+    spooled           BOOLEAN NOT NULL DEFAULT FALSE, -- some writes went through the disk spool
+    steps             JSONB NOT NULL DEFAULT '{}',   -- per step: fetched, inserted, spooled, error, duration_ms
+    http_requests     INTEGER,
+    http_retries      INTEGER,
+    http_errors       INTEGER,
+    http_rate_limited INTEGER,
+    http_not_modified INTEGER,
+    http_bytes        BIGINT,
+    http_wait_ms      BIGINT
+);
+CREATE INDEX IF NOT EXISTS idx_scrape_runs_started ON scrape_runs (server_id, loop, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_scrape_runs_snapshot ON scrape_runs (server_id, snapshot_ts);
+
+ALTER TABLE server_snapshots  ADD COLUMN IF NOT EXISTS run_id UUID REFERENCES scrape_runs (id);
+ALTER TABLE town_snapshots    ADD COLUMN IF NOT EXISTS run_id UUID REFERENCES scrape_runs (id);
+ALTER TABLE nation_snapshots  ADD COLUMN IF NOT EXISTS run_id UUID REFERENCES scrape_runs (id);
+ALTER TABLE player_snapshots  ADD COLUMN IF NOT EXISTS run_id UUID REFERENCES scrape_runs (id);
+ALTER TABLE quarter_snapshots ADD COLUMN IF NOT EXISTS run_id UUID REFERENCES scrape_runs (id);
+ALTER TABLE activity_ticks    ADD COLUMN IF NOT EXISTS run_id UUID REFERENCES scrape_runs (id);
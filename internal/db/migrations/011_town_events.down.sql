@@ -0,0 +1,3 @@
+-- Reverts 011_town_events.
+
+DROP TABLE IF EXISTS town_events;
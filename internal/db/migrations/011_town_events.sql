@@ -0,0 +1,32 @@
+-- ============================================================
+-- town_events: typed changes between consecutive town snapshots,
+-- written by the low-freq loop in the same transaction as the
+-- snapshot that revealed them. The change happened somewhere
+-- between prev_ts (the last tick the old state was seen) and
+-- snapshot_ts.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS town_events (
+    id           BIGSERIAL PRIMARY KEY,
+    server_id    TEXT NOT NULL,
+    snapshot_ts  TIMESTAMPTZ NOT NULL,
+    prev_ts      TIMESTAMPTZ NOT NULL,
+    town_uuid    TEXT NOT NULL,
+    town_name    TEXT NOT NULL,
+    event_type   TEXT NOT NULL,
+    -- The resident, nation, mayor, outlaw or trusted player involved
+    related_uuid TEXT,
+    related_name TEXT,
+    -- The status flag for status_changed
+    attribute    TEXT,
+    old_value    TEXT,
+    new_value    TEXT,
+    delta        DOUBLE PRECISION,
+    -- The chunks for claims_gained and claims_lost, as [[x, z], ...]
+    detail       JSONB,
+    run_id       UUID REFERENCES scrape_runs (id)
+);
+CREATE INDEX IF NOT EXISTS idx_town_events_ts ON town_events (server_id, snapshot_ts DESC);
+CREATE INDEX IF NOT EXISTS idx_town_events_town ON town_events (town_uuid, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_town_events_type ON town_events (event_type, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_town_events_related ON town_events (related_uuid, snapshot_ts) WHERE related_uuid IS NOT NULL;
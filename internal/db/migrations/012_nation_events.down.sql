@@ -0,0 +1,3 @@
+-- Reverts 012_nation_events.
+
+DROP TABLE IF EXISTS nation_events;
@@ -0,0 +1,29 @@
+-- ============================================================
+-- nation_events: typed changes between consecutive nation
+-- snapshots, laid out like town_events.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS nation_events (
+    id           BIGSERIAL PRIMARY KEY,
+    server_id    TEXT NOT NULL,
+    snapshot_ts  TIMESTAMPTZ NOT NULL,
+    prev_ts      TIMESTAMPTZ NOT NULL,
+    nation_uuid  TEXT NOT NULL,
+    nation_name  TEXT NOT NULL,
+    event_type   TEXT NOT NULL,
+    -- The town, king, capital, nation or resident involved
+    related_uuid TEXT,
+    related_name TEXT,
+    -- The rank for rank_assigned/rank_removed, the colour for
+    -- colour_changed
+    attribute    TEXT,
+    old_value    TEXT,
+    new_value    TEXT,
+    delta        DOUBLE PRECISION,
+    detail       JSONB,
+    run_id       UUID REFERENCES scrape_runs (id)
+);
+CREATE INDEX IF NOT EXISTS idx_nation_events_ts ON nation_events (server_id, snapshot_ts DESC);
+CREATE INDEX IF NOT EXISTS idx_nation_events_nation ON nation_events (nation_uuid, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_nation_events_type ON nation_events (event_type, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_nation_events_related ON nation_events (related_uuid, snapshot_ts) WHERE related_uuid IS NOT NULL;
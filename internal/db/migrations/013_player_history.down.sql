@@ -0,0 +1,4 @@
+-- Reverts 013_player_history.
+
+DROP TABLE IF EXISTS player_events;
+DROP TABLE IF EXISTS player_name_history;
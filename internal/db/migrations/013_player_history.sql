@@ -0,0 +1,60 @@
+-- ============================================================
+-- player_name_history: every name a player uuid has been seen
+-- with, since players.name only holds the latest one. Backfilled
+-- from player_snapshots, then from players for uuids that were
+-- never snapshotted.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS player_name_history (
+    server_id   TEXT NOT NULL,
+    player_uuid TEXT NOT NULL,
+    name        TEXT NOT NULL,
+    first_seen  TIMESTAMPTZ NOT NULL,
+    last_seen   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (server_id, player_uuid, name)
+);
+CREATE INDEX IF NOT EXISTS idx_player_name_history_name ON player_name_history (LOWER(name));
+
+INSERT INTO player_name_history (server_id, player_uuid, name, first_seen, last_seen)
+SELECT server_id, player_uuid, player_name, MIN(snapshot_ts), MAX(COALESCE(observed_until, snapshot_ts))
+FROM player_snapshots
+GROUP BY server_id, player_uuid, player_name
+ON CONFLICT DO NOTHING;
+
+INSERT INTO player_name_history (server_id, player_uuid, name, first_seen, last_seen)
+SELECT p.server_id, p.uuid, p.name, p.first_seen, p.last_seen
+FROM players p
+WHERE NOT EXISTS (
+    SELECT 1 FROM player_name_history h
+    WHERE h.server_id = p.server_id AND h.player_uuid = p.uuid
+)
+ON CONFLICT DO NOTHING;
+
+-- ============================================================
+-- player_events: typed changes between consecutive player
+-- snapshots, laid out like town_events.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS player_events (
+    id           BIGSERIAL PRIMARY KEY,
+    server_id    TEXT NOT NULL,
+    snapshot_ts  TIMESTAMPTZ NOT NULL,
+    prev_ts      TIMESTAMPTZ NOT NULL,
+    player_uuid  TEXT NOT NULL,
+    player_name  TEXT NOT NULL,
+    event_type   TEXT NOT NULL,
+    -- The town, nation or friend involved
+    related_uuid TEXT,
+    related_name TEXT,
+    -- The rank for *_rank_added/removed, the flag for status_changed
+    attribute    TEXT,
+    old_value    TEXT,
+    new_value    TEXT,
+    delta        DOUBLE PRECISION,
+    detail       JSONB,
+    run_id       UUID REFERENCES scrape_runs (id)
+);
+CREATE INDEX IF NOT EXISTS idx_player_events_ts ON player_events (server_id, snapshot_ts DESC);
+CREATE INDEX IF NOT EXISTS idx_player_events_player ON player_events (player_uuid, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_player_events_type ON player_events (event_type, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_player_events_related ON player_events (related_uuid, snapshot_ts) WHERE related_uuid IS NOT NULL;
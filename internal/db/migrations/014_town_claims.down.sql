@@ -0,0 +1,7 @@
+-- Reverts 014_town_claims.
+
+DROP FUNCTION IF EXISTS town_borders(TEXT, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS town_neighbours(TEXT, TEXT, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS town_at(TEXT, INTEGER, INTEGER, TIMESTAMPTZ);
+DROP FUNCTION IF EXISTS town_claims_at(TEXT, TIMESTAMPTZ);
+DROP TABLE IF EXISTS town_claims;
@@ -0,0 +1,93 @@
+-- ============================================================
+-- town_claims: one row per chunk per stretch of ownership,
+-- maintained by the low-freq loop from each changed town's
+-- TownBlocks. valid_to is NULL while the town still holds the
+-- chunk. History starts with the first tick after this
+-- migration; older claims are only in town_snapshots.data.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS town_claims (
+    id         BIGSERIAL PRIMARY KEY,
+    server_id  TEXT NOT NULL,
+    town_uuid  TEXT NOT NULL,
+    chunk_x    INTEGER NOT NULL,
+    chunk_z    INTEGER NOT NULL,
+    valid_from TIMESTAMPTZ NOT NULL,
+    valid_to   TIMESTAMPTZ,
+    run_id     UUID REFERENCES scrape_runs (id)
+);
+-- Current owner of a chunk, and a town's current claims
+CREATE INDEX IF NOT EXISTS idx_town_claims_current ON town_claims (server_id, chunk_x, chunk_z) WHERE valid_to IS NULL;
+CREATE INDEX IF NOT EXISTS idx_town_claims_town_current ON town_claims (server_id, town_uuid) WHERE valid_to IS NULL;
+-- Ownership at a point in time
+CREATE INDEX IF NOT EXISTS idx_town_claims_chunk ON town_claims (server_id, chunk_x, chunk_z, valid_from);
+CREATE INDEX IF NOT EXISTS idx_town_claims_town ON town_claims (town_uuid, valid_from);
+
+-- The claims in force at p_at, or now when p_at is NULL.
+CREATE OR REPLACE FUNCTION town_claims_at(p_server TEXT, p_at TIMESTAMPTZ DEFAULT NULL)
+RETURNS SETOF town_claims AS $$
+    SELECT * FROM town_claims c
+    WHERE c.server_id = p_server
+      AND CASE WHEN p_at IS NULL THEN c.valid_to IS NULL
+               ELSE c.valid_from <= p_at AND (c.valid_to IS NULL OR c.valid_to > p_at) END
+$$ LANGUAGE sql STABLE;
+
+-- The town owning block coordinate (p_x, p_z) at p_at (now when NULL).
+-- Chunks are 16 blocks wide; no row means wilderness.
+CREATE OR REPLACE FUNCTION town_at(p_server TEXT, p_x INTEGER, p_z INTEGER, p_at TIMESTAMPTZ DEFAULT NULL)
+RETURNS TABLE (
+    town_uuid TEXT,
+    town_name TEXT,
+    chunk_x   INTEGER,
+    chunk_z   INTEGER
+) AS $$
+    SELECT c.town_uuid, t.name, c.chunk_x, c.chunk_z
+    FROM town_claims_at(p_server, p_at) c
+    LEFT JOIN towns t ON t.server_id = c.server_id AND t.uuid = c.town_uuid
+    WHERE c.chunk_x = FLOOR(p_x / 16.0)::int AND c.chunk_z = FLOOR(p_z / 16.0)::int
+$$ LANGUAGE sql STABLE;
+
+-- Towns sharing at least one chunk edge with p_town at p_at (now when
+-- NULL), with the number of shared edges.
+CREATE OR REPLACE FUNCTION town_neighbours(p_server TEXT, p_town TEXT, p_at TIMESTAMPTZ DEFAULT NULL)
+RETURNS TABLE (
+    town_uuid    TEXT,
+    town_name    TEXT,
+    shared_edges BIGINT
+) AS $$
+    WITH claims AS (SELECT * FROM town_claims_at(p_server, p_at))
+    SELECT n.town_uuid, t.name, COUNT(*)
+    FROM claims c
+    CROSS JOIN (VALUES (1, 0), (-1, 0), (0, 1), (0, -1)) d (dx, dz)
+    JOIN claims n
+      ON n.chunk_x = c.chunk_x + d.dx
+     AND n.chunk_z = c.chunk_z + d.dz
+     AND n.town_uuid <> c.town_uuid
+    LEFT JOIN towns t ON t.server_id = p_server AND t.uuid = n.town_uuid
+    WHERE c.town_uuid = p_town
+    GROUP BY n.town_uuid, t.name
+    ORDER BY COUNT(*) DESC
+$$ LANGUAGE sql STABLE;
+
+-- Every pair of bordering towns at p_at (now when NULL), each pair once.
+CREATE OR REPLACE FUNCTION town_borders(p_server TEXT, p_at TIMESTAMPTZ DEFAULT NULL)
+RETURNS TABLE (
+    town_a       TEXT,
+    town_b       TEXT,
+    shared_edges BIGINT
+) AS $$
+    WITH claims AS (SELECT * FROM town_claims_at(p_server, p_at)),
+    edges AS (
+        SELECT a.town_uuid AS a, b.town_uuid AS b
+        FROM claims a
+        JOIN claims b ON b.chunk_x = a.chunk_x + 1 AND b.chunk_z = a.chunk_z
+        UNION ALL
+        SELECT a.town_uuid, b.town_uuid
+        FROM claims a
+        JOIN claims b ON b.chunk_x = a.chunk_x AND b.chunk_z = a.chunk_z + 1
+    )
+    SELECT LEAST(a, b), GREATEST(a, b), COUNT(*)
+    FROM edges
+    WHERE a <> b
+    GROUP BY 1, 2
+$$ LANGUAGE sql STABLE;
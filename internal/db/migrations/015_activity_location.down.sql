@@ -0,0 +1,45 @@
+-- Reverts 015_activity_location.
+
+DROP FUNCTION IF EXISTS player_activity_dense(TEXT, TIMESTAMPTZ, TIMESTAMPTZ);
+CREATE OR REPLACE FUNCTION player_activity_dense(p_server TEXT, p_from TIMESTAMPTZ, p_to TIMESTAMPTZ)
+RETURNS TABLE (
+    snapshot_ts TIMESTAMPTZ,
+    player_uuid TEXT,
+    player_name TEXT,
+    is_visible  BOOLEAN,
+    x           INTEGER,
+    y           INTEGER,
+    z           INTEGER,
+    yaw         INTEGER,
+    world       TEXT,
+    changed_ts  TIMESTAMPTZ
+) AS $$
+    WITH bounds AS (
+        SELECT COALESCE(MAX(k.snapshot_ts), p_from) AS since
+        FROM activity_ticks k
+        WHERE k.server_id = p_server AND k.is_keyframe AND k.snapshot_ts <= p_from
+    ),
+    changes AS (
+        SELECT a.snapshot_ts, a.player_uuid, a.player_name, a.is_online, a.is_visible,
+               a.x, a.y, a.z, a.yaw, a.world,
+               LEAD(a.snapshot_ts) OVER (PARTITION BY a.player_uuid ORDER BY a.snapshot_ts) AS next_ts,
+               (SELECT MIN(k.snapshot_ts) FROM activity_ticks k
+                WHERE k.server_id = p_server AND k.is_keyframe AND k.snapshot_ts > a.snapshot_ts) AS next_keyframe
+        FROM player_activity a, bounds b
+        WHERE a.server_id = p_server AND a.snapshot_ts >= b.since AND a.snapshot_ts <= p_to
+    )
+    SELECT t.snapshot_ts, c.player_uuid, c.player_name, c.is_visible,
+           c.x, c.y, c.z, c.yaw, c.world, c.snapshot_ts
+    FROM changes c
+    JOIN activity_ticks t
+      ON t.server_id = p_server
+     AND t.snapshot_ts >= GREATEST(c.snapshot_ts, p_from)
+     AND t.snapshot_ts <= p_to
+     AND t.snapshot_ts < LEAST(COALESCE(c.next_ts, 'infinity'), COALESCE(c.next_keyframe, 'infinity'))
+    WHERE c.is_online
+$$ LANGUAGE sql STABLE;
+
+DROP INDEX IF EXISTS idx_player_activity_town;
+ALTER TABLE player_activity DROP COLUMN IF EXISTS is_wilderness;
+ALTER TABLE player_activity DROP COLUMN IF EXISTS in_nation_uuid;
+ALTER TABLE player_activity DROP COLUMN IF EXISTS in_town_uuid;
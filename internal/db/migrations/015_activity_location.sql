@@ -0,0 +1,57 @@
+-- ============================================================
+-- Where each visible player_activity row was: the town and
+-- nation owning the chunk, from the worker's in-memory claim
+-- index. is_wilderness is TRUE outside any town, and all three
+-- are NULL for hidden players and for rows written before the
+-- index was loaded.
+-- ============================================================
+
+ALTER TABLE player_activity ADD COLUMN IF NOT EXISTS in_town_uuid TEXT;
+ALTER TABLE player_activity ADD COLUMN IF NOT EXISTS in_nation_uuid TEXT;
+ALTER TABLE player_activity ADD COLUMN IF NOT EXISTS is_wilderness BOOLEAN;
+CREATE INDEX IF NOT EXISTS idx_player_activity_town ON player_activity (in_town_uuid, snapshot_ts) WHERE in_town_uuid IS NOT NULL;
+
+-- The dense timeline carries the new columns. Its return type
+-- changes, so it has to be dropped first.
+DROP FUNCTION IF EXISTS player_activity_dense(TEXT, TIMESTAMPTZ, TIMESTAMPTZ);
+CREATE FUNCTION player_activity_dense(p_server TEXT, p_from TIMESTAMPTZ, p_to TIMESTAMPTZ)
+RETURNS TABLE (
+    snapshot_ts    TIMESTAMPTZ,
+    player_uuid    TEXT,
+    player_name    TEXT,
+    is_visible     BOOLEAN,
+    x              INTEGER,
+    y              INTEGER,
+    z              INTEGER,
+    yaw            INTEGER,
+    world          TEXT,
+    changed_ts     TIMESTAMPTZ,
+    in_town_uuid   TEXT,
+    in_nation_uuid TEXT,
+    is_wilderness  BOOLEAN
+) AS $$
+    WITH bounds AS (
+        SELECT COALESCE(MAX(k.snapshot_ts), p_from) AS since
+        FROM activity_ticks k
+        WHERE k.server_id = p_server AND k.is_keyframe AND k.snapshot_ts <= p_from
+    ),
+    changes AS (
+        SELECT a.snapshot_ts, a.player_uuid, a.player_name, a.is_online, a.is_visible,
+               a.x, a.y, a.z, a.yaw, a.world, a.in_town_uuid, a.in_nation_uuid, a.is_wilderness,
+               LEAD(a.snapshot_ts) OVER (PARTITION BY a.player_uuid ORDER BY a.snapshot_ts) AS next_ts,
+               (SELECT MIN(k.snapshot_ts) FROM activity_ticks k
+                WHERE k.server_id = p_server AND k.is_keyframe AND k.snapshot_ts > a.snapshot_ts) AS next_keyframe
+        FROM player_activity a, bounds b
+        WHERE a.server_id = p_server AND a.snapshot_ts >= b.since AND a.snapshot_ts <= p_to
+    )
+    SELECT t.snapshot_ts, c.player_uuid, c.player_name, c.is_visible,
+           c.x, c.y, c.z, c.yaw, c.world, c.snapshot_ts,
+           c.in_town_uuid, c.in_nation_uuid, c.is_wilderness
+    FROM changes c
+    JOIN activity_ticks t
+      ON t.server_id = p_server
+     AND t.snapshot_ts >= GREATEST(c.snapshot_ts, p_from)
+     AND t.snapshot_ts <= p_to
+     AND t.snapshot_ts < LEAST(COALESCE(c.next_ts, 'infinity'), COALESCE(c.next_keyframe, 'infinity'))
+    WHERE c.is_online
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,3 @@
+-- Reverts 016_border_events.
+
+DROP TABLE IF EXISTS border_events;
@@ -0,0 +1,34 @@
+-- ============================================================
+-- border_events: a visible player entering or leaving a town's
+-- claims, detected by the high-freq loop from map positions and
+-- the in-memory claim index, and written with the activity tick.
+-- The flags say how the player relates to that town when the
+-- event happened.
+-- ============================================================
+
+CREATE TABLE IF NOT EXISTS border_events (
+    id               BIGSERIAL PRIMARY KEY,
+    server_id        TEXT NOT NULL,
+    snapshot_ts      TIMESTAMPTZ NOT NULL,
+    player_uuid      TEXT NOT NULL,
+    player_name      TEXT NOT NULL,
+    event_type       TEXT NOT NULL,          -- 'enter' | 'leave'
+    town_uuid        TEXT NOT NULL,
+    town_name        TEXT NOT NULL,
+    nation_uuid      TEXT,                   -- the town's nation
+    x                INTEGER NOT NULL,       -- where the player was seen
+    z                INTEGER NOT NULL,
+    world            TEXT NOT NULL,
+    is_resident      BOOLEAN NOT NULL,
+    is_trusted       BOOLEAN NOT NULL,
+    is_outlaw        BOOLEAN NOT NULL,
+    is_nation_member BOOLEAN NOT NULL,
+    is_ally          BOOLEAN NOT NULL,       -- the player's nation is allied with the town's
+    is_enemy         BOOLEAN NOT NULL,
+    run_id           UUID REFERENCES scrape_runs (id)
+);
+CREATE INDEX IF NOT EXISTS idx_border_events_ts ON border_events (server_id, snapshot_ts DESC);
+CREATE INDEX IF NOT EXISTS idx_border_events_town ON border_events (town_uuid, snapshot_ts);
+CREATE INDEX IF NOT EXISTS idx_border_events_player ON border_events (player_uuid, snapshot_ts);
+-- Alerts for town owners
+CREATE INDEX IF NOT EXISTS idx_border_events_hostile ON border_events (town_uuid, snapshot_ts) WHERE is_outlaw OR is_enemy;
@@ -0,0 +1,107 @@
+-- ============================================================
+-- activity_ticks follows player_activity out of retention: when
+-- an hour's partition is dropped without an archive, its ticks
+-- are deleted too. Archived hours keep theirs so a restored
+-- partition still reads back through player_activity_dense.
+-- ============================================================
+
+CREATE OR REPLACE FUNCTION enforce_activity_retention(raw_retention INTERVAL DEFAULT INTERVAL '14 days', max_gap_seconds INT DEFAULT 30)
+RETURNS INT AS $$
+DECLARE
+    part    RECORD;
+    dropped INT := 0;
+BEGIN
+    FOR part IN
+        SELECT c.relname AS name,
+               TO_TIMESTAMP(SUBSTRING(c.relname FROM '\d{8}_\d{6}$'), 'YYYYMMDD_HH24MISS') AS start_ts
+        FROM pg_inherits i
+        JOIN pg_class c ON c.oid = i.inhrelid
+        WHERE i.inhparent = 'player_activity'::regclass
+          AND c.relname ~ '^player_activity_\d{8}_\d{6}$'
+        ORDER BY 2
+    LOOP
+        EXIT WHEN part.start_ts + INTERVAL '1 hour' > NOW() - raw_retention;
+
+        IF NOT EXISTS (SELECT 1 FROM activity_rollups WHERE hour = part.start_ts) THEN
+            PERFORM rollup_activity_hour(part.start_ts, max_gap_seconds);
+        END IF;
+        EXECUTE FORMAT('ALTER TABLE player_activity DETACH PARTITION %I', part.name);
+        EXECUTE FORMAT('DROP TABLE %I', part.name);
+        IF NOT EXISTS (SELECT 1 FROM activity_archives WHERE partition_name = part.name) THEN
+            DELETE FROM activity_ticks
+            WHERE snapshot_ts >= part.start_ts AND snapshot_ts < part.start_ts + INTERVAL '1 hour';
+        END IF;
+        dropped := dropped + 1;
+    END LOOP;
+    RETURN dropped;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Ticks already orphaned by earlier retention passes
+DELETE FROM activity_ticks t
+WHERE t.snapshot_ts < COALESCE((
+        SELECT MIN(TO_TIMESTAMP(SUBSTRING(c.relname FROM '\d{8}_\d{6}$'), 'YYYYMMDD_HH24MISS'))
+        FROM pg_inherits i
+        JOIN pg_class c ON c.oid = i.inhrelid
+        WHERE i.inhparent = 'player_activity'::regclass
+          AND c.relname ~ '^player_activity_\d{8}_\d{6}$'
+      ), '-infinity')
+  AND NOT EXISTS (
+        SELECT 1 FROM activity_archives r
+        WHERE t.snapshot_ts >= r.hour AND t.snapshot_ts < r.hour + INTERVAL '1 hour'
+      );
+
+-- The dense timeline finds each change row's next keyframe from
+-- one pass over the ticks in range, rather than a subquery per
+-- row: scanning the ticks newest first, the smallest keyframe
+-- seen so far is the next one after the current tick.
+CREATE OR REPLACE FUNCTION player_activity_dense(p_server TEXT, p_from TIMESTAMPTZ, p_to TIMESTAMPTZ)
+RETURNS TABLE (
+    snapshot_ts    TIMESTAMPTZ,
+    player_uuid    TEXT,
+    player_name    TEXT,
+    is_visible     BOOLEAN,
+    x              INTEGER,
+    y              INTEGER,
+    z              INTEGER,
+    yaw            INTEGER,
+    world          TEXT,
+    changed_ts     TIMESTAMPTZ,
+    in_town_uuid   TEXT,
+    in_nation_uuid TEXT,
+    is_wilderness  BOOLEAN
+) AS $$
+    WITH bounds AS (
+        SELECT COALESCE(MAX(k.snapshot_ts), p_from) AS since
+        FROM activity_ticks k
+        WHERE k.server_id = p_server AND k.is_keyframe AND k.snapshot_ts <= p_from
+    ),
+    ticks AS (
+        SELECT k.snapshot_ts,
+               MIN(k.snapshot_ts) FILTER (WHERE k.is_keyframe) OVER (
+                   ORDER BY k.snapshot_ts DESC ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING
+               ) AS next_keyframe
+        FROM activity_ticks k, bounds b
+        WHERE k.server_id = p_server AND k.snapshot_ts >= b.since AND k.snapshot_ts <= p_to
+    ),
+    changes AS (
+        SELECT a.snapshot_ts, a.player_uuid, a.player_name, a.is_online, a.is_visible,
+               a.x, a.y, a.z, a.yaw, a.world, a.in_town_uuid, a.in_nation_uuid, a.is_wilderness,
+               LEAD(a.snapshot_ts) OVER (PARTITION BY a.player_uuid ORDER BY a.snapshot_ts) AS next_ts,
+               k.next_keyframe
+        FROM player_activity a
+        CROSS JOIN bounds b
+        LEFT JOIN ticks k ON k.snapshot_ts = a.snapshot_ts
+        WHERE a.server_id = p_server AND a.snapshot_ts >= b.since AND a.snapshot_ts <= p_to
+    )
+    SELECT t.snapshot_ts, c.player_uuid, c.player_name, c.is_visible,
+           c.x, c.y, c.z, c.yaw, c.world, c.snapshot_ts,
+           c.in_town_uuid, c.in_nation_uuid, c.is_wilderness
+    FROM changes c
+    JOIN activity_ticks t
+      ON t.server_id = p_server
+     AND t.snapshot_ts >= GREATEST(c.snapshot_ts, p_from)
+     AND t.snapshot_ts <= p_to
+     AND t.snapshot_ts < LEAST(COALESCE(c.next_ts, 'infinity'), COALESCE(c.next_keyframe, 'infinity'))
+    WHERE c.is_online
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,280 @@
+package drift
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is the kind of difference between an API payload and its Go type.
+type Change string
+
+const (
+	// ChangeNew is a field the API sends that the Go type does not declare.
+	ChangeNew Change = "new"
+	// ChangeMissing is a declared field that no sampled payload contained.
+	ChangeMissing Change = "missing"
+	// ChangeTypeChanged is a field whose JSON type no longer matches.
+	ChangeTypeChanged Change = "type_changed"
+)
+
+// Finding is one detected difference at a JSON path such as "stats.balance"
+// or "residents[].uuid".
+type Finding struct {
+	Entity   string
+	Path     string
+	Change   Change
+	Expected string
+	Observed string
+}
+
+// pathStats accumulates what was seen at one path across all samples.
+type pathStats struct {
+	expected   string // JSON kind the Go type wants, "" if undeclared
+	parentSeen int    // times the enclosing object was present
+	present    int    // times the key itself was present
+	observed   map[string]bool
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+type checker struct {
+	paths map[string]*pathStats
+}
+
+// Check decodes each sample against model (a struct value or pointer, e.g.
+// api.TownDetail{}) and reports fields that are new, missing from every
+// sample, or of a different JSON type. Nulls never count as a type change.
+func Check(entity string, samples []json.RawMessage, model interface{}) []Finding {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	c := &checker{paths: make(map[string]*pathStats)}
+	for _, raw := range samples {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			continue
+		}
+		c.walk("", v, t)
+	}
+
+	var findings []Finding
+	for path, ps := range c.paths {
+		switch {
+		case ps.expected == "":
+			findings = append(findings, Finding{
+				Entity:   entity,
+				Path:     path,
+				Change:   ChangeNew,
+				Observed: joinKinds(ps.observed),
+			})
+		case ps.parentSeen > 0 && ps.present == 0:
+			findings = append(findings, Finding{
+				Entity:   entity,
+				Path:     path,
+				Change:   ChangeMissing,
+				Expected: ps.expected,
+			})
+		default:
+			for kind := range ps.observed {
+				if !compatible(ps.expected, kind) {
+					findings = append(findings, Finding{
+						Entity:   entity,
+						Path:     path,
+						Change:   ChangeTypeChanged,
+						Expected: ps.expected,
+						Observed: joinKinds(ps.observed),
+					})
+					break
+				}
+			}
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Path != findings[j].Path {
+			return findings[i].Path < findings[j].Path
+		}
+		return findings[i].Change < findings[j].Change
+	})
+	return findings
+}
+
+func (c *checker) stats(path string) *pathStats {
+	ps, ok := c.paths[path]
+	if !ok {
+		ps = &pathStats{observed: make(map[string]bool)}
+		c.paths[path] = ps
+	}
+	return ps
+}
+
+// walk compares the decoded value v at path with Go type t.
+func (c *checker) walk(path string, v interface{}, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if v == nil {
+		return
+	}
+
+	if path != "" {
+		kind := jsonKind(v)
+		c.stats(path).observed[kind] = true
+		if !compatible(expectedKind(t), kind) {
+			return
+		}
+	}
+	if t == rawMessageType {
+		// Any JSON fits, and nothing inside it is declared.
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		declared := make(map[string]bool)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := jsonName(f)
+			if name == "" {
+				continue
+			}
+			declared[name] = true
+			child := join(path, name)
+			ps := c.stats(child)
+			ps.expected = expectedKind(f.Type)
+			ps.parentSeen++
+			if val, ok := obj[name]; ok {
+				ps.present++
+				c.walk(child, val, f.Type)
+			}
+		}
+		for key, val := range obj {
+			if declared[key] {
+				continue
+			}
+			c.stats(join(path, key)).observed[jsonKind(val)] = true
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return
+		}
+		child := path + "[]"
+		ps := c.stats(child)
+		ps.expected = expectedKind(t.Elem())
+		for _, el := range arr {
+			ps.parentSeen++
+			ps.present++
+			c.walk(child, el, t.Elem())
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		child := join(path, "*")
+		ps := c.stats(child)
+		ps.expected = expectedKind(t.Elem())
+		for _, val := range obj {
+			ps.parentSeen++
+			ps.present++
+			c.walk(child, val, t.Elem())
+		}
+	}
+}
+
+func jsonName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// jsonKind names the JSON type of a value decoded with UseNumber.
+func jsonKind(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if strings.ContainsAny(x.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+// expectedKind names the JSON type a Go type decodes from.
+func expectedKind(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == rawMessageType {
+		return "any"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return "any"
+}
+
+// compatible reports whether a value of JSON kind got decodes into a Go type
+// expecting want. Integers are valid wherever a float is expected.
+func compatible(want, got string) bool {
+	return want == "any" || want == got || (want == "number" && got == "integer")
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func joinKinds(kinds map[string]bool) string {
+	out := make([]string, 0, len(kinds))
+	for k := range kinds {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return strings.Join(out, "|")
+}
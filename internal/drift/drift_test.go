@@ -0,0 +1,127 @@
+package drift
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+type testInner struct {
+	ID string `json:"id"`
+}
+
+type testModel struct {
+	Name    string          `json:"name"`
+	Count   int             `json:"count"`
+	Score   float64         `json:"score"`
+	Tags    []string        `json:"tags"`
+	Inner   *testInner      `json:"inner"`
+	Ranks   map[string]int  `json:"ranks"`
+	Extra   json.RawMessage `json:"extra"`
+	Skipped string          `json:"-"`
+}
+
+const clean = `{"name":"a","count":1,"score":2.5,"tags":["x"],"inner":{"id":"i"},"ranks":{"r":1},"extra":[1,"two"]}`
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []string
+		want    []Finding
+	}{
+		{
+			name:    "matching payload",
+			samples: []string{clean},
+		},
+		{
+			name:    "integer where a float is expected",
+			samples: []string{`{"name":"a","count":1,"score":2,"tags":[],"inner":{"id":"i"},"ranks":{},"extra":null}`},
+		},
+		{
+			name:    "nulls are not type changes",
+			samples: []string{`{"name":null,"count":null,"score":null,"tags":null,"inner":null,"ranks":null,"extra":null}`},
+		},
+		{
+			name:    "new top-level field",
+			samples: []string{`{"name":"a","count":1,"score":2.5,"tags":[],"inner":{"id":"i"},"ranks":{},"extra":0,"town":{"uuid":"u"}}`},
+			want:    []Finding{{Entity: "test", Path: "town", Change: ChangeNew, Observed: "object"}},
+		},
+		{
+			name:    "new nested field",
+			samples: []string{`{"name":"a","count":1,"score":2.5,"tags":[],"inner":{"id":"i","colour":"red"},"ranks":{},"extra":0}`},
+			want:    []Finding{{Entity: "test", Path: "inner.colour", Change: ChangeNew, Observed: "string"}},
+		},
+		{
+			name: "missing from every sample",
+			samples: []string{
+				`{"name":"a","count":1,"tags":[],"inner":{"id":"i"},"ranks":{},"extra":0}`,
+				`{"name":"b","count":2,"tags":[],"inner":{"id":"j"},"ranks":{},"extra":0}`,
+			},
+			want: []Finding{{Entity: "test", Path: "score", Change: ChangeMissing, Expected: "number"}},
+		},
+		{
+			name: "present in one sample is not missing",
+			samples: []string{
+				`{"name":"a","count":1,"tags":[],"inner":{"id":"i"},"ranks":{},"extra":0}`,
+				clean,
+			},
+		},
+		{
+			name:    "nested field missing only when its parent was seen",
+			samples: []string{`{"name":"a","count":1,"score":1,"tags":[],"inner":{},"ranks":{},"extra":0}`},
+			want:    []Finding{{Entity: "test", Path: "inner.id", Change: ChangeMissing, Expected: "string"}},
+		},
+		{
+			name: "type changed",
+			samples: []string{
+				clean,
+				`{"name":"a","count":"1","score":2.5,"tags":[],"inner":{"id":"i"},"ranks":{},"extra":0}`,
+			},
+			want: []Finding{{Entity: "test", Path: "count", Change: ChangeTypeChanged, Expected: "integer", Observed: "integer|string"}},
+		},
+		{
+			name:    "float where an integer is expected",
+			samples: []string{`{"name":"a","count":1.5,"score":2.5,"tags":[],"inner":{"id":"i"},"ranks":{},"extra":0}`},
+			want:    []Finding{{Entity: "test", Path: "count", Change: ChangeTypeChanged, Expected: "integer", Observed: "number"}},
+		},
+		{
+			name:    "array element type changed",
+			samples: []string{`{"name":"a","count":1,"score":2.5,"tags":["x",7],"inner":{"id":"i"},"ranks":{},"extra":0}`},
+			want:    []Finding{{Entity: "test", Path: "tags[]", Change: ChangeTypeChanged, Expected: "string", Observed: "integer|string"}},
+		},
+		{
+			name:    "map value type changed",
+			samples: []string{`{"name":"a","count":1,"score":2.5,"tags":[],"inner":{"id":"i"},"ranks":{"r":"one"},"extra":0}`},
+			want:    []Finding{{Entity: "test", Path: "ranks.*", Change: ChangeTypeChanged, Expected: "integer", Observed: "string"}},
+		},
+		{
+			name:    "object replaced by a scalar",
+			samples: []string{`{"name":"a","count":1,"score":2.5,"tags":[],"inner":"i","ranks":{},"extra":0}`},
+			want:    []Finding{{Entity: "test", Path: "inner", Change: ChangeTypeChanged, Expected: "object", Observed: "string"}},
+		},
+		{
+			name:    "invalid samples are skipped",
+			samples: []string{`{"name":`, clean},
+		},
+		{
+			name:    "findings are sorted by path",
+			samples: []string{`{"zeta":1,"name":"a","count":1,"score":2.5,"tags":[],"inner":{"id":"i"},"ranks":{},"extra":0,"alpha":true}`},
+			want: []Finding{
+				{Entity: "test", Path: "alpha", Change: ChangeNew, Observed: "boolean"},
+				{Entity: "test", Path: "zeta", Change: ChangeNew, Observed: "integer"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := make([]json.RawMessage, len(tt.samples))
+			for i, s := range tt.samples {
+				samples[i] = json.RawMessage(s)
+			}
+			got := Check("test", samples, &testModel{})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package fakeapi
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/0Mattias/earthmc-scraper/internal/api"
+)
+
+// Handler serves the world under prefix (e.g. "/v3/aurora") plus the map's
+// /tiles/players.json, mimicking the real EarthMC endpoints.
+func (w *World) Handler(prefix string) http.Handler {
+	prefix = strings.TrimRight(prefix, "/")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+prefix+"/{$}", w.handleServer)
+	mux.HandleFunc("GET "+prefix+"/online", w.handleOnline)
+	mux.HandleFunc("GET "+prefix+"/towns", w.listHandler(&w.towns))
+	mux.HandleFunc("GET "+prefix+"/nations", w.listHandler(&w.nations))
+	mux.HandleFunc("GET "+prefix+"/players", w.listHandler(&w.players))
+	mux.HandleFunc("POST "+prefix+"/towns", w.handleQuery)
+	mux.HandleFunc("POST "+prefix+"/nations", w.handleQuery)
+	mux.HandleFunc("POST "+prefix+"/players", w.handleQuery)
+	mux.HandleFunc("GET "+prefix+"/quarters", w.listHandler(&w.quarters))
+	mux.HandleFunc("POST "+prefix+"/quarters", w.handleQuery)
+	mux.HandleFunc("POST "+prefix+"/location", w.handleLocation)
+	mux.HandleFunc("POST "+prefix+"/nearby", w.handleNearby)
+	mux.HandleFunc("POST "+prefix+"/discord", w.handleDiscord)
+	mux.HandleFunc("GET /tiles/players.json", w.handleMap)
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		slog.Debug("fake request", "method", r.Method, "path", r.URL.Path)
+		mux.ServeHTTP(rw, r)
+	})
+}
+
+func (w *World) handleServer(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	data := w.server
+	w.mu.Unlock()
+	writeRaw(rw, data)
+}
+
+func (w *World) handleOnline(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	players := make([]api.ListEntry, 0, len(w.online))
+	for _, p := range w.online {
+		players = append(players, p)
+	}
+	w.mu.Unlock()
+
+	sort.Slice(players, func(i, j int) bool { return players[i].Name < players[j].Name })
+	writeJSON(rw, api.OnlineResponse{Count: len(players), Players: players})
+}
+
+func (w *World) handleMap(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	w.step()
+	players := make([]api.MapPlayer, 0, len(w.mapPlayers))
+	for _, p := range w.mapPlayers {
+		players = append(players, *p)
+	}
+	w.mu.Unlock()
+
+	sort.Slice(players, func(i, j int) bool { return players[i].Name < players[j].Name })
+	writeJSON(rw, api.MapPlayersResponse{Max: 500, Players: players})
+}
+
+func (w *World) listHandler(list *[]entity) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		w.mu.Lock()
+		entries := make([]api.ListEntry, len(*list))
+		for i, e := range *list {
+			entries[i] = api.ListEntry{Name: e.Name, UUID: e.UUID}
+		}
+		w.mu.Unlock()
+		writeJSON(rw, entries)
+	}
+}
+
+// handleQuery answers a batched POST with the details of every known UUID
+// in query order. Unknown UUIDs are dropped, like the real API.
+func (w *World) handleQuery(rw http.ResponseWriter, r *http.Request) {
+	var q api.PostQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(rw, "invalid query body", http.StatusBadRequest)
+		return
+	}
+
+	w.mu.Lock()
+	results := make([]json.RawMessage, 0, len(q.Query))
+	for _, id := range q.Query {
+		if raw, ok := w.byUUID[id]; ok {
+			results = append(results, raw)
+		}
+	}
+	w.mu.Unlock()
+
+	writeJSON(rw, results)
+}
+
+func (w *World) handleLocation(rw http.ResponseWriter, r *http.Request) {
+	var q api.LocationQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(rw, "invalid query body", http.StatusBadRequest)
+		return
+	}
+
+	w.mu.Lock()
+	results := make([]api.LocationResult, len(q.Query))
+	for i, c := range q.Query {
+		results[i].Location = api.LocationPoint{X: c[0], Z: c[1]}
+		owner, ok := w.claims[[2]int{floorDiv(c[0], 16), floorDiv(c[1], 16)}]
+		if !ok {
+			results[i].IsWilderness = true
+			continue
+		}
+		town := owner.Town
+		results[i].Town = &town
+		results[i].Nation = owner.Nation
+	}
+	w.mu.Unlock()
+
+	writeJSON(rw, results)
+}
+
+// handleNearby supports TOWN and COORDINATE targets searching for towns,
+// measuring distance between home blocks in blocks.
+func (w *World) handleNearby(rw http.ResponseWriter, r *http.Request) {
+	var q api.NearbyRequest
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(rw, "invalid query body", http.StatusBadRequest)
+		return
+	}
+
+	w.mu.Lock()
+	homes := make(map[string]claim)
+	for _, c := range w.claims {
+		homes[c.Town.UUID] = c
+	}
+	results := make([][]api.ListEntry, len(q.Query))
+	for i, nq := range q.Query {
+		results[i] = []api.ListEntry{}
+		var x, z int
+		switch nq.TargetType {
+		case "TOWN":
+			name, _ := nq.Target.(string)
+			found := false
+			for _, c := range homes {
+				if strings.EqualFold(c.Town.Name, name) || c.Town.UUID == name {
+					x, z, found = c.Home[0]*16, c.Home[1]*16, true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		case "COORDINATE":
+			pair, _ := nq.Target.([]interface{})
+			if len(pair) != 2 {
+				continue
+			}
+			fx, _ := pair[0].(float64)
+			fz, _ := pair[1].(float64)
+			x, z = int(fx), int(fz)
+		default:
+			continue
+		}
+		for _, c := range homes {
+			dx, dz := c.Home[0]*16-x, c.Home[1]*16-z
+			if (dx != 0 || dz != 0) && dx*dx+dz*dz <= nq.Radius*nq.Radius {
+				results[i] = append(results[i], c.Town)
+			}
+		}
+		sort.Slice(results[i], func(a, b int) bool { return results[i][a].Name < results[i][b].Name })
+	}
+	w.mu.Unlock()
+
+	writeJSON(rw, results)
+}
+
+// handleDiscord knows no links: every lookup echoes its target with the
+// other side null.
+func (w *World) handleDiscord(rw http.ResponseWriter, r *http.Request) {
+	var q api.DiscordRequest
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		http.Error(rw, "invalid query body", http.StatusBadRequest)
+		return
+	}
+
+	results := make([]api.DiscordLink, len(q.Query))
+	for i, dq := range q.Query {
+		target := dq.Target
+		if dq.Type == "discord" {
+			results[i].ID = &target
+		} else {
+			results[i].UUID = &target
+		}
+	}
+	writeJSON(rw, results)
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(v)
+}
+
+func writeRaw(rw http.ResponseWriter, data []byte) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Write(data)
+}
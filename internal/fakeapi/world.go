@@ -0,0 +1,384 @@
+package fakeapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/0Mattias/earthmc-scraper/internal/api"
+)
+
+// entity is a named API object listed by the GET endpoints.
+type entity struct {
+	Name string
+	UUID string
+}
+
+// claim is the owner of one chunk.
+type claim struct {
+	Town   api.ListEntry
+	Nation *api.ListEntry
+	Home   [2]int
+}
+
+// World is the in-memory state served by the fake EarthMC API.
+type World struct {
+	mu       sync.Mutex
+	rng      *rand.Rand
+	server   json.RawMessage
+	towns    []entity
+	nations  []entity
+	players  []entity
+	quarters []entity
+	byUUID   map[string]json.RawMessage
+	// claims maps a chunk to the town (and nation) that owns it.
+	claims     map[[2]int]claim
+	online     map[string]api.ListEntry
+	mapPlayers map[string]*api.MapPlayer
+}
+
+// GenerateOptions controls the size of a generated world.
+type GenerateOptions struct {
+	Seed       uint64
+	NumPlayers int
+	NumTowns   int
+	NumNations int
+	// OnlineRatio is the fraction of players online at any time.
+	OnlineRatio float64
+	// VisibleRatio is the fraction of online players shown on the map.
+	VisibleRatio float64
+}
+
+// Generate builds a random but internally consistent world: every player
+// belongs to at most one town, every town to at most one nation, and each
+// town owns a contiguous square of chunks.
+func Generate(opts GenerateOptions) *World {
+	rng := rand.New(rand.NewPCG(opts.Seed, opts.Seed^0x9e3779b97f4a7c15))
+	w := &World{
+		rng:        rng,
+		claims:     make(map[[2]int]claim),
+		byUUID:     make(map[string]json.RawMessage),
+		online:     make(map[string]api.ListEntry),
+		mapPlayers: make(map[string]*api.MapPlayer),
+	}
+
+	players := make([]*api.PlayerDetail, opts.NumPlayers)
+	for i := range players {
+		registered := int64(1_600_000_000_000 + rng.Int64N(100_000_000_000))
+		players[i] = &api.PlayerDetail{
+			Name:       fmt.Sprintf("Player%d", i),
+			UUID:       newUUID(rng),
+			Timestamps: &api.PlayerTimestamp{Registered: &registered},
+			Status:     &api.PlayerStatus{},
+			Stats:      &api.PlayerStats{Balance: float64(rng.IntN(5000))},
+			Ranks:      &api.PlayerRanks{TownRanks: []string{}, NationRanks: []string{}},
+			Friends:    []api.ListEntry{},
+		}
+	}
+
+	nations := make([]*api.NationDetail, opts.NumNations)
+	for i := range nations {
+		colour := fmt.Sprintf("%06X", rng.IntN(0xFFFFFF))
+		nations[i] = &api.NationDetail{
+			Name:         fmt.Sprintf("Nation%d", i),
+			UUID:         newUUID(rng),
+			DynmapColour: &colour,
+			Status:       &api.NationStatus{IsPublic: rng.IntN(2) == 0, IsOpen: rng.IntN(2) == 0},
+			Stats:        &api.NationStats{Balance: float64(rng.IntN(100_000))},
+			Residents:    []api.ListEntry{},
+			Towns:        []api.ListEntry{},
+			Allies:       []api.ListEntry{},
+			Enemies:      []api.ListEntry{},
+			Sanctioned:   []api.ListEntry{},
+			Ranks:        map[string][]string{},
+		}
+	}
+
+	towns := make([]*api.TownDetail, opts.NumTowns)
+	next := 0
+	for i := range towns {
+		t := &api.TownDetail{
+			Name:      fmt.Sprintf("Town%d", i),
+			UUID:      newUUID(rng),
+			Status:    &api.TownStatus{IsOpen: rng.IntN(2) == 0, IsPublic: rng.IntN(2) == 0},
+			Stats:     &api.TownStats{Balance: float64(rng.IntN(50_000))},
+			Residents: []api.ListEntry{},
+			Trusted:   []api.ListEntry{},
+			Outlaws:   []api.ListEntry{},
+			Quarters:  []string{},
+			Ranks:     map[string][]string{},
+		}
+
+		// Square of claims on a grid so towns never overlap.
+		side := 2 + rng.IntN(5)
+		cx, cz := (i%50)*16-400, (i/50)*16-400
+		blocks := make([][]int, 0, side*side)
+		for dx := 0; dx < side; dx++ {
+			for dz := 0; dz < side; dz++ {
+				blocks = append(blocks, []int{cx + dx, cz + dz})
+			}
+		}
+		t.Coordinates = &api.TownCoordinates{
+			Spawn:      &api.SpawnCoord{World: "world", X: float64(cx*16 + 8), Y: 64, Z: float64(cz*16 + 8)},
+			HomeBlock:  []int{cx, cz},
+			TownBlocks: blocks,
+		}
+		t.Stats.NumTownBlocks = len(blocks)
+		t.Stats.MaxTownBlocks = len(blocks) * 2
+
+		// Hand out residents in order; the first becomes mayor.
+		size := 1 + rng.IntN(8)
+		for j := 0; j < size && next < len(players); j++ {
+			p := players[next]
+			next++
+			entry := api.ListEntry{Name: p.Name, UUID: p.UUID}
+			t.Residents = append(t.Residents, entry)
+			p.Town = &api.ListEntry{Name: t.Name, UUID: t.UUID}
+			p.Status.HasTown = true
+			if j == 0 {
+				t.Mayor = &entry
+				p.Status.IsMayor = true
+				p.Ranks.TownRanks = append(p.Ranks.TownRanks, "Mayor")
+			}
+		}
+		t.Stats.NumResidents = len(t.Residents)
+
+		if len(nations) > 0 && rng.Float64() < 0.7 {
+			n := nations[rng.IntN(len(nations))]
+			t.Nation = &api.ListEntry{Name: n.Name, UUID: n.UUID}
+			t.Status.HasNation = true
+			n.Towns = append(n.Towns, api.ListEntry{Name: t.Name, UUID: t.UUID})
+			n.Residents = append(n.Residents, t.Residents...)
+			n.Stats.NumTownBlocks += len(blocks)
+			if n.Capital == nil {
+				n.Capital = &api.ListEntry{Name: t.Name, UUID: t.UUID}
+				n.King = t.Mayor
+				t.Status.IsCapital = true
+			}
+		}
+		towns[i] = t
+	}
+
+	playerByUUID := make(map[string]*api.PlayerDetail, len(players))
+	for _, p := range players {
+		playerByUUID[p.UUID] = p
+	}
+	for _, n := range nations {
+		n.Stats.NumTowns = len(n.Towns)
+		n.Stats.NumResidents = len(n.Residents)
+		for _, r := range n.Residents {
+			p := playerByUUID[r.UUID]
+			p.Nation = &api.ListEntry{Name: n.Name, UUID: n.UUID}
+			p.Status.HasNation = true
+			if n.King != nil && n.King.UUID == p.UUID {
+				p.Status.IsKing = true
+			}
+		}
+	}
+
+	for _, p := range players {
+		w.players = append(w.players, w.add(p.Name, p.UUID, p))
+	}
+	for _, t := range towns {
+		owner := claim{Town: api.ListEntry{Name: t.Name, UUID: t.UUID}, Nation: t.Nation}
+		owner.Home = [2]int{t.Coordinates.HomeBlock[0], t.Coordinates.HomeBlock[1]}
+		for _, b := range t.Coordinates.TownBlocks {
+			w.claims[[2]int{b[0], b[1]}] = owner
+		}
+
+		// A quarter in some towns, owned by a resident.
+		if len(t.Residents) > 1 && rng.IntN(3) == 0 {
+			owner := t.Residents[len(t.Residents)-1]
+			x, z := t.Coordinates.HomeBlock[0]*16, t.Coordinates.HomeBlock[1]*16
+			price := float64(rng.IntN(500))
+			q := &api.QuarterDetail{
+				UUID:    newUUID(rng),
+				Type:    "APARTMENT",
+				Owner:   &owner,
+				Town:    &api.ListEntry{Name: t.Name, UUID: t.UUID},
+				Nation:  t.Nation,
+				Status:  &api.QuarterStatus{IsForSale: price > 250},
+				Stats:   &api.QuarterStats{Price: &price, Volume: 16 * 16 * 8, NumCuboids: 1},
+				Colour:  []int{rng.IntN(256), rng.IntN(256), rng.IntN(256)},
+				Trusted: []api.ListEntry{},
+				Cuboids: []api.Cuboid{{Pos1: []int{x, 64, z}, Pos2: []int{x + 15, 71, z + 15}}},
+			}
+			t.Quarters = append(t.Quarters, q.UUID)
+			w.quarters = append(w.quarters, w.add("", q.UUID, q))
+		}
+		w.towns = append(w.towns, w.add(t.Name, t.UUID, t))
+	}
+	for _, n := range nations {
+		w.nations = append(w.nations, w.add(n.Name, n.UUID, n))
+	}
+
+	srv := api.ServerResponse{
+		Version:   "1.21.4",
+		MoonPhase: "FULL_MOON",
+		Stats: api.ServerStats{
+			MaxPlayers:   500,
+			NumResidents: len(players),
+			NumTowns:     len(towns),
+			NumNations:   len(nations),
+			NumQuarters:  len(w.quarters),
+		},
+	}
+	w.server, _ = json.Marshal(srv)
+
+	for _, p := range w.players {
+		if rng.Float64() >= opts.OnlineRatio {
+			continue
+		}
+		w.online[p.UUID] = api.ListEntry{Name: p.Name, UUID: p.UUID}
+		if rng.Float64() < opts.VisibleRatio {
+			w.mapPlayers[p.UUID] = &api.MapPlayer{
+				World:       "world",
+				Name:        p.Name,
+				DisplayName: p.Name,
+				UUID:        strings.ReplaceAll(p.UUID, "-", ""),
+				X:           rng.IntN(16000) - 8000,
+				Y:           64,
+				Z:           rng.IntN(16000) - 8000,
+				Yaw:         rng.IntN(360),
+			}
+		}
+	}
+
+	return w
+}
+
+// LoadFixtures builds a world from JSON files in dir. Recognised files are
+// server.json (the / response), towns.json, nations.json, players.json and
+// quarters.json (arrays of full POST detail objects), online.json (the
+// /online response) and map.json (players.json from the map). Missing files
+// yield empty data. Town claims are indexed for /location and /nearby.
+func LoadFixtures(dir string) (*World, error) {
+	w := &World{
+		rng:        rand.New(rand.NewPCG(1, 2)),
+		server:     json.RawMessage(`{}`),
+		claims:     make(map[[2]int]claim),
+		byUUID:     make(map[string]json.RawMessage),
+		online:     make(map[string]api.ListEntry),
+		mapPlayers: make(map[string]*api.MapPlayer),
+	}
+
+	if data, err := readOptional(filepath.Join(dir, "server.json")); err != nil {
+		return nil, err
+	} else if data != nil {
+		w.server = data
+	}
+
+	for _, f := range []struct {
+		file string
+		dst  *[]entity
+	}{
+		{"towns.json", &w.towns},
+		{"nations.json", &w.nations},
+		{"players.json", &w.players},
+		{"quarters.json", &w.quarters},
+	} {
+		data, err := readOptional(filepath.Join(dir, f.file))
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		var raws []json.RawMessage
+		if err := json.Unmarshal(data, &raws); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", f.file, err)
+		}
+		for _, raw := range raws {
+			var e api.ListEntry
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return nil, fmt.Errorf("parse %s entry: %w", f.file, err)
+			}
+			w.byUUID[e.UUID] = raw
+			*f.dst = append(*f.dst, entity{Name: e.Name, UUID: e.UUID})
+		}
+	}
+
+	for _, t := range w.towns {
+		var detail api.TownDetail
+		if err := json.Unmarshal(w.byUUID[t.UUID], &detail); err != nil || detail.Coordinates == nil {
+			continue
+		}
+		owner := claim{Town: api.ListEntry{Name: detail.Name, UUID: detail.UUID}, Nation: detail.Nation}
+		if len(detail.Coordinates.HomeBlock) == 2 {
+			owner.Home = [2]int{detail.Coordinates.HomeBlock[0], detail.Coordinates.HomeBlock[1]}
+		}
+		for _, b := range detail.Coordinates.TownBlocks {
+			if len(b) == 2 {
+				w.claims[[2]int{b[0], b[1]}] = owner
+			}
+		}
+	}
+
+	if data, err := readOptional(filepath.Join(dir, "online.json")); err != nil {
+		return nil, err
+	} else if data != nil {
+		var resp api.OnlineResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("parse online.json: %w", err)
+		}
+		for _, p := range resp.Players {
+			w.online[p.UUID] = p
+		}
+	}
+
+	if data, err := readOptional(filepath.Join(dir, "map.json")); err != nil {
+		return nil, err
+	} else if data != nil {
+		var resp api.MapPlayersResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return nil, fmt.Errorf("parse map.json: %w", err)
+		}
+		for i := range resp.Players {
+			p := resp.Players[i]
+			w.mapPlayers[p.UUID] = &p
+		}
+	}
+
+	return w, nil
+}
+
+func (w *World) add(name, uuid string, v interface{}) entity {
+	raw, _ := json.Marshal(v)
+	w.byUUID[uuid] = raw
+	return entity{Name: name, UUID: uuid}
+}
+
+// step nudges visible players around the map so consecutive high-freq ticks
+// see movement. Callers must hold w.mu.
+func (w *World) step() {
+	for _, p := range w.mapPlayers {
+		p.X += w.rng.IntN(21) - 10
+		p.Z += w.rng.IntN(21) - 10
+		p.Yaw = (p.Yaw + w.rng.IntN(31) - 15 + 360) % 360
+	}
+}
+
+func readOptional(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return data, nil
+}
+
+func newUUID(rng *rand.Rand) string {
+	var b [16]byte
+	for i := range b {
+		b[i] = byte(rng.IntN(256))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
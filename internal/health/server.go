@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0Mattias/earthmc-scraper/internal/spool"
 )
 
 // Server provides HTTP health check endpoints for Cloud Run.
@@ -18,6 +20,7 @@ type Server struct {
 	port             int
 	highFreqLastTick atomic.Value // time.Time
 	lowFreqLastTick  atomic.Value // time.Time
+	spool            atomic.Pointer[spool.Spool]
 	srv              *http.Server
 }
 
@@ -51,6 +54,11 @@ func (s *Server) SetLowFreqTick(t time.Time) {
 	s.lowFreqLastTick.Store(t)
 }
 
+// SetSpool reports the write spool's depth on /metrics.
+func (s *Server) SetSpool(sp *spool.Spool) {
+	s.spool.Store(sp)
+}
+
 // Start begins serving. Blocks until context is cancelled.
 func (s *Server) Start(ctx context.Context) error {
 	slog.Info("health server starting", "port", s.port)
@@ -98,6 +106,54 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 		metrics["low_freq_last_tick"] = v.(time.Time).Format(time.RFC3339)
 	}
 
+	if sp := s.spool.Load(); sp != nil {
+		metrics["spool"] = sp.Stats()
+	}
+
+	if drift, err := s.recentDrift(r.Context()); err != nil {
+		metrics["schema_drift_error"] = err.Error()
+	} else {
+		metrics["schema_drift"] = drift
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(metrics)
 }
+
+// driftEntry is a schema_drift row as reported on /metrics.
+type driftEntry struct {
+	Server    string    `json:"server"`
+	Entity    string    `json:"entity"`
+	Path      string    `json:"path"`
+	Change    string    `json:"change"`
+	Expected  *string   `json:"expected,omitempty"`
+	Observed  *string   `json:"observed,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// recentDrift returns schema drift still being observed in the last day.
+func (s *Server) recentDrift(ctx context.Context) ([]driftEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT server_id, entity, path, change, expected_type, observed_type, first_seen, last_seen
+		FROM schema_drift
+		WHERE last_seen > NOW() - INTERVAL '1 day'
+		ORDER BY server_id, entity, path`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []driftEntry{}
+	for rows.Next() {
+		var e driftEntry
+		if err := rows.Scan(&e.Server, &e.Entity, &e.Path, &e.Change, &e.Expected, &e.Observed, &e.FirstSeen, &e.LastSeen); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,359 @@
+// Package httpapi serves the scraped data as a read-only, versioned JSON
+// API for the frontend.
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0Mattias/earthmc-scraper/internal/query"
+)
+
+// Page sizes and the default time range when a request gives none.
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+	defaultRange = 24 * time.Hour
+)
+
+// Server is the HTTP API. Every request runs under its own query timeout.
+type Server struct {
+	store   *query.Store
+	servers []string // the first is the default
+	port    int
+	timeout time.Duration
+	srv     *http.Server
+}
+
+// NewServer creates the API server for the named EarthMC servers.
+func NewServer(pool *pgxpool.Pool, port int, servers []string, timeout time.Duration) *Server {
+	s := &Server{
+		store:   query.NewStore(pool),
+		servers: servers,
+		port:    port,
+		timeout: timeout,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	mux.Handle("GET /v1/players/{uuid}", s.handle(s.player))
+	mux.Handle("GET /v1/players/{uuid}/trail", s.handle(s.trail))
+	mux.Handle("GET /v1/towns/{uuid}/history", s.handle(s.townHistory))
+	mux.Handle("GET /v1/nations", s.handle(s.nations))
+	mux.Handle("GET /v1/server/history", s.handle(s.serverHistory))
+	mux.Handle("GET /v1/online", s.handle(s.online))
+
+	s.srv = &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Start begins serving. Blocks until context is cancelled.
+func (s *Server) Start(ctx context.Context) error {
+	slog.Info("api server starting", "port", s.port, "servers", s.servers, "query_timeout", s.timeout)
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = s.srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// ---- Endpoints ----
+
+func (s *Server) player(ctx context.Context, q *request) (any, error) {
+	return s.store.Player(ctx, q.server, q.r.PathValue("uuid"))
+}
+
+func (s *Server) trail(ctx context.Context, q *request) (any, error) {
+	rng, err := q.timeRange()
+	if err != nil {
+		return nil, err
+	}
+	p, err := q.page()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.store.Trail(ctx, q.server, q.r.PathValue("uuid"), rng, fetch(p))
+	return pagedTo(rows, p, rng.To), err
+}
+
+func (s *Server) townHistory(ctx context.Context, q *request) (any, error) {
+	rng, err := q.timeRange()
+	if err != nil {
+		return nil, err
+	}
+	p, err := q.page()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.store.TownHistory(ctx, q.server, q.r.PathValue("uuid"), rng, fetch(p))
+	return pagedTo(rows, p, rng.To), err
+}
+
+func (s *Server) nations(ctx context.Context, q *request) (any, error) {
+	p, err := q.page()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.store.Nations(ctx, q.server, fetch(p))
+	return paged(rows, p), err
+}
+
+func (s *Server) serverHistory(ctx context.Context, q *request) (any, error) {
+	rng, err := q.timeRange()
+	if err != nil {
+		return nil, err
+	}
+	p, err := q.page()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.store.ServerHistory(ctx, q.server, rng, fetch(p))
+	return pagedTo(rows, p, rng.To), err
+}
+
+// onlineResult is the /v1/online response. Tick is the high-freq tick the
+// list is from, nil when the scraper was not running at the time.
+type onlineResult struct {
+	Tick *time.Time `json:"tick"`
+	result[query.OnlinePlayer]
+}
+
+func (s *Server) online(ctx context.Context, q *request) (any, error) {
+	at := time.Now()
+	if v := q.r.URL.Query().Get("at"); v != "" {
+		t, err := query.ParseTime(v)
+		if err != nil {
+			return nil, badRequest("at: %v", err)
+		}
+		at = t
+	}
+	p, err := q.page()
+	if err != nil {
+		return nil, err
+	}
+
+	tick, err := s.store.OnlineTick(ctx, q.server, at)
+	if err != nil || tick.IsZero() {
+		return onlineResult{result: result[query.OnlinePlayer]{Data: []query.OnlinePlayer{}}}, err
+	}
+	rows, err := s.store.Online(ctx, q.server, tick, fetch(p))
+	return onlineResult{Tick: &tick, result: paged(rows, p)}, err
+}
+
+// ---- Requests ----
+
+// request is an API request with its server resolved.
+type request struct {
+	r      *http.Request
+	server string
+}
+
+// endpoint answers one request with a value to encode as JSON.
+type endpoint func(ctx context.Context, q *request) (any, error)
+
+// handle wraps an endpoint with server selection, the query timeout, JSON
+// encoding, ETags and error responses.
+func (s *Server) handle(fn endpoint) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := &request{r: r, server: s.servers[0]}
+		if v := r.URL.Query().Get("server"); v != "" {
+			q.server = strings.ToLower(v)
+		}
+		if !s.knownServer(q.server) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("unknown server %q", q.server))
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+		defer cancel()
+		v, err := fn(ctx, q)
+		if err != nil {
+			s.fail(ctx, w, r, err)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(v); err != nil {
+			s.fail(ctx, w, r, err)
+			return
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "no-cache")
+		if matchETag(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf.Bytes())
+	})
+}
+
+func (s *Server) knownServer(name string) bool {
+	for _, srv := range s.servers {
+		if srv == name {
+			return true
+		}
+	}
+	return false
+}
+
+// fail writes the error response for err. ctx is the request's query
+// context: a cancelled query does not always surface as its deadline.
+func (s *Server) fail(ctx context.Context, w http.ResponseWriter, r *http.Request, err error) {
+	var bad badRequestError
+	switch {
+	case errors.As(err, &bad):
+		writeError(w, http.StatusBadRequest, bad.msg)
+	case errors.Is(err, query.ErrNotFound):
+		writeError(w, http.StatusNotFound, "not found")
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, fmt.Sprintf("query took longer than %s", s.timeout))
+	case r.Context().Err() != nil:
+		// The client went away; nobody is listening.
+	default:
+		slog.Error("api request failed", "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// matchETag reports whether an If-None-Match header lists etag.
+func matchETag(header, etag string) bool {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == etag || v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+type badRequestError struct{ msg string }
+
+func (e badRequestError) Error() string { return e.msg }
+
+func badRequest(format string, args ...any) error {
+	return badRequestError{fmt.Sprintf(format, args...)}
+}
+
+// ---- Parameters ----
+
+// timeRange reads from and to. To defaults to now and from to a day
+// before to.
+func (q *request) timeRange() (query.Range, error) {
+	v := q.r.URL.Query()
+	rng := query.Range{To: time.Now()}
+	if s := v.Get("to"); s != "" {
+		t, err := query.ParseTime(s)
+		if err != nil {
+			return rng, badRequest("to: %v", err)
+		}
+		rng.To = t
+	}
+	rng.From = rng.To.Add(-defaultRange)
+	if s := v.Get("from"); s != "" {
+		t, err := query.ParseTime(s)
+		if err != nil {
+			return rng, badRequest("from: %v", err)
+		}
+		rng.From = t
+	}
+	if !rng.From.Before(rng.To) {
+		return rng, badRequest("from must be before to")
+	}
+	return rng, nil
+}
+
+// page reads limit and offset.
+func (q *request) page() (query.Page, error) {
+	v := q.r.URL.Query()
+	p := query.Page{Limit: defaultLimit}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxLimit {
+			return p, badRequest("limit must be between 1 and %d", maxLimit)
+		}
+		p.Limit = n
+	}
+	if s := v.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return p, badRequest("offset must not be negative")
+		}
+		p.Offset = n
+	}
+	return p, nil
+}
+
+// ---- Pagination ----
+
+// result is a page of a list. NextOffset is set when there are more rows.
+// For lists over a time range, To is set with it: the end of the range the
+// page was read over, which the client passes back with the offset so a
+// defaulted to does not move between pages.
+type result[T any] struct {
+	Data       []T        `json:"data"`
+	NextOffset *int       `json:"next_offset,omitempty"`
+	To         *time.Time `json:"to,omitempty"`
+}
+
+// fetch asks for one row more than the page holds, to tell whether there
+// is a next page.
+func fetch(p query.Page) query.Page {
+	return query.Page{Limit: p.Limit + 1, Offset: p.Offset}
+}
+
+func paged[T any](rows []T, p query.Page) result[T] {
+	res := result[T]{Data: rows}
+	if res.Data == nil {
+		res.Data = []T{}
+	}
+	if len(rows) > p.Limit {
+		res.Data = rows[:p.Limit]
+		next := p.Offset + p.Limit
+		res.NextOffset = &next
+	}
+	return res
+}
+
+// pagedTo is paged for a list over a time range ending at to.
+func pagedTo[T any](rows []T, p query.Page, to time.Time) result[T] {
+	res := paged(rows, p)
+	if res.NextOffset != nil {
+		to = to.UTC()
+		res.To = &to
+	}
+	return res
+}
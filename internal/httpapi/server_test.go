@@ -0,0 +1,258 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/0Mattias/earthmc-scraper/internal/query"
+)
+
+// testServer has no database: endpoints are given to handle directly.
+func testServer() *Server {
+	return NewServer(nil, 0, []string{"aurora", "nova"}, time.Second)
+}
+
+// get serves one request to fn and returns the recorded response.
+func get(s *Server, fn endpoint, target string, header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	s.handle(fn).ServeHTTP(w, r)
+	return w
+}
+
+func TestHandleErrors(t *testing.T) {
+	// params reads every parameter the endpoints take.
+	params := func(ctx context.Context, q *request) (any, error) {
+		if _, err := q.timeRange(); err != nil {
+			return nil, err
+		}
+		if _, err := q.page(); err != nil {
+			return nil, err
+		}
+		return q.server, nil
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		fn     endpoint
+		status int
+		body   string
+	}{
+		{"default server", "/v1/x", params, http.StatusOK, `"aurora"`},
+		{"server ignores case", "/v1/x?server=NOVA", params, http.StatusOK, `"nova"`},
+		{"unknown server", "/v1/x?server=mars", params, http.StatusNotFound, `{"error":"unknown server \"mars\""}`},
+		{"limit not a number", "/v1/x?limit=ten", params, http.StatusBadRequest, `{"error":"limit must be between 1 and 1000"}`},
+		{"limit zero", "/v1/x?limit=0", params, http.StatusBadRequest, `{"error":"limit must be between 1 and 1000"}`},
+		{"limit too large", "/v1/x?limit=1001", params, http.StatusBadRequest, `{"error":"limit must be between 1 and 1000"}`},
+		{"negative offset", "/v1/x?offset=-1", params, http.StatusBadRequest, `{"error":"offset must not be negative"}`},
+		{"bad from", "/v1/x?from=yesterday", params, http.StatusBadRequest, ""},
+		{"bad to", "/v1/x?to=soon", params, http.StatusBadRequest, ""},
+		{"empty range", "/v1/x?from=2026-03-02&to=2026-03-01", params, http.StatusBadRequest, `{"error":"from must be before to"}`},
+		{
+			"not found", "/v1/x",
+			func(context.Context, *request) (any, error) { return nil, fmt.Errorf("player: %w", query.ErrNotFound) },
+			http.StatusNotFound, `{"error":"not found"}`,
+		},
+		{
+			"query timeout", "/v1/x",
+			func(context.Context, *request) (any, error) { return nil, context.DeadlineExceeded },
+			http.StatusGatewayTimeout, `{"error":"query took longer than 1s"}`,
+		},
+		{
+			"internal error", "/v1/x",
+			func(context.Context, *request) (any, error) { return nil, fmt.Errorf("connection reset") },
+			http.StatusInternalServerError, `{"error":"internal error"}`,
+		},
+	}
+	s := testServer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(s, tt.fn, tt.target, nil)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.status, w.Body)
+			}
+			if tt.body != "" {
+				if got := w.Body.String(); got != tt.body+"\n" {
+					t.Errorf("body = %s, want %s", got, tt.body)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleETag(t *testing.T) {
+	s := testServer()
+	fn := func(context.Context, *request) (any, error) { return map[string]int{"n": 1}, nil }
+
+	first := get(s, fn, "/v1/x", nil)
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag == "" {
+		t.Fatalf("first response %d with ETag %q", first.Code, etag)
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        int
+	}{
+		{"matching", etag, http.StatusNotModified},
+		{"weak", "W/" + etag, http.StatusNotModified},
+		{"in a list", `"stale", ` + etag, http.StatusNotModified},
+		{"any", "*", http.StatusNotModified},
+		{"stale", `"stale"`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(s, fn, "/v1/x", http.Header{"If-None-Match": {tt.ifNoneMatch}})
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 with a body: %s", w.Body)
+			}
+			if w.Header().Get("ETag") != etag {
+				t.Errorf("ETag = %q, want %q", w.Header().Get("ETag"), etag)
+			}
+		})
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{"", false},
+		{`"abc"`, true},
+		{`W/"abc"`, true},
+		{` "x" , "abc" `, true},
+		{"*", true},
+		{`"abcd"`, false},
+		{`abc`, false},
+	}
+	for _, tt := range tests {
+		if got := matchETag(tt.header, `"abc"`); got != tt.want {
+			t.Errorf("matchETag(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestPaged(t *testing.T) {
+	to := time.Date(2026, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	utc := to.UTC()
+
+	tests := []struct {
+		name     string
+		rows     []int
+		page     query.Page
+		wantData []int
+		wantNext *int
+	}{
+		{"empty", nil, query.Page{Limit: 2}, []int{}, nil},
+		{"last page", []int{1, 2}, query.Page{Limit: 2}, []int{1, 2}, nil},
+		{"more rows", []int{1, 2, 3}, query.Page{Limit: 2}, []int{1, 2}, ptr(2)},
+		{"later page", []int{5, 6, 7}, query.Page{Limit: 2, Offset: 4}, []int{5, 6}, ptr(6)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := paged(tt.rows, tt.page)
+			if !reflect.DeepEqual(res.Data, tt.wantData) || !reflect.DeepEqual(res.NextOffset, tt.wantNext) {
+				t.Errorf("paged = %v next %v, want %v next %v", res.Data, res.NextOffset, tt.wantData, tt.wantNext)
+			}
+			if res.To != nil {
+				t.Errorf("paged set to = %v", res.To)
+			}
+
+			res = pagedTo(tt.rows, tt.page, to)
+			switch {
+			case tt.wantNext == nil && res.To != nil:
+				t.Errorf("pagedTo on the last page set to = %v", res.To)
+			case tt.wantNext != nil && (res.To == nil || !res.To.Equal(utc) || res.To.Location() != time.UTC):
+				t.Errorf("pagedTo to = %v, want %v", res.To, utc)
+			}
+		})
+	}
+}
+
+// TestPageRoundTrip follows next_offset and to through a list over a
+// defaulted time range that gains rows between requests. Passing to back
+// keeps every later page on the range the first was read over.
+func TestPageRoundTrip(t *testing.T) {
+	var (
+		start = time.Now().Add(-time.Hour).Truncate(time.Second)
+		rows  []time.Time
+	)
+	for i := range 5 {
+		rows = append(rows, start.Add(time.Duration(i)*time.Minute))
+	}
+	list := func(ctx context.Context, q *request) (any, error) {
+		rng, err := q.timeRange()
+		if err != nil {
+			return nil, err
+		}
+		p, err := q.page()
+		if err != nil {
+			return nil, err
+		}
+		var in []time.Time
+		for _, ts := range rows {
+			if !ts.Before(rng.From) && ts.Before(rng.To) {
+				in = append(in, ts)
+			}
+		}
+		in = in[min(p.Offset, len(in)):]
+		in = in[:min(fetch(p).Limit, len(in))]
+		return pagedTo(in, p, rng.To), nil
+	}
+
+	s := testServer()
+	params := url.Values{"limit": {"2"}}
+	var got []time.Time
+	for range 10 {
+		w := get(s, list, "/v1/x?"+params.Encode(), nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var res result[time.Time]
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, res.Data...)
+		if res.NextOffset == nil {
+			break
+		}
+		if res.To == nil {
+			t.Fatal("next_offset without to")
+		}
+		params.Set("offset", strconv.Itoa(*res.NextOffset))
+		params.Set("to", res.To.Format(time.RFC3339Nano))
+
+		// A row newer than the first page's to must not shift later pages.
+		rows = append(rows, time.Now())
+	}
+
+	if len(got) != 5 {
+		t.Fatalf("read %d rows, want the 5 in range", len(got))
+	}
+	for i, ts := range got {
+		if !ts.Equal(start.Add(time.Duration(i) * time.Minute)) {
+			t.Errorf("row %d = %v, want %v", i, ts, start.Add(time.Duration(i)*time.Minute))
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
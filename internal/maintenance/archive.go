@@ -0,0 +1,267 @@
+package maintenance
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/klauspost/compress/zstd"
+)
+
+// archiveFormat is recorded in activity_archives.format.
+const archiveFormat = "csv.zst"
+
+// Sink stores archive files under slash-separated names.
+type Sink interface {
+	// Put stores r under name, replacing any existing file only once r has
+	// been read completely, and returns the bytes written.
+	Put(ctx context.Context, name string, r io.Reader) (int64, error)
+	// Open reads back a stored file.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// DirSink stores archives in a local directory. Object stores can be used by
+// mounting the bucket there (e.g. a Cloud Storage volume on Cloud Run).
+type DirSink struct {
+	root string
+}
+
+// NewDirSink returns a sink rooted at dir, creating it if needed.
+func NewDirSink(dir string) (*DirSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create archive dir: %w", err)
+	}
+	return &DirSink{root: dir}, nil
+}
+
+func (s *DirSink) Put(ctx context.Context, name string, r io.Reader) (int64, error) {
+	dst := filepath.Join(s.root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".archive-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, err
+	}
+	return n, os.Rename(tmp.Name(), dst)
+}
+
+func (s *DirSink) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.root, filepath.FromSlash(name)))
+}
+
+// Archive is one row of the activity_archives manifest.
+type Archive struct {
+	Partition string
+	Hour      time.Time
+	Location  string
+	Format    string
+	Rows      int64
+	Bytes     int64
+	SHA256    string
+}
+
+// Archiver exports hourly player_activity partitions to a Sink before
+// retention drops them, and restores them on request.
+type Archiver struct {
+	pool *pgxpool.Pool
+	sink Sink
+}
+
+// NewArchiver creates an archiver writing to sink.
+func NewArchiver(pool *pgxpool.Pool, sink Sink) *Archiver {
+	return &Archiver{pool: pool, sink: sink}
+}
+
+// archiveName lays files out by day, e.g.
+// player_activity/2026/02/28/player_activity_20260228_150000.csv.zst.
+func archiveName(p Partition) string {
+	return path.Join("player_activity", p.Start.UTC().Format("2006/01/02"), p.Name+"."+archiveFormat)
+}
+
+// ArchivePartition streams a partition as zstd-compressed CSV (with a header
+// row) to the sink and records it in activity_archives.
+func (a *Archiver) ArchivePartition(ctx context.Context, p Partition) (*Archive, error) {
+	conn, err := a.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	pr, pw := io.Pipe()
+	hash := sha256.New()
+	var rows int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		enc, err := zstd.NewWriter(pw)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		tag, err := conn.Conn().PgConn().CopyTo(ctx, enc,
+			"COPY (SELECT * FROM "+pgx.Identifier{p.Name}.Sanitize()+") TO STDOUT WITH (FORMAT csv, HEADER)")
+		if cerr := enc.Close(); err == nil {
+			err = cerr
+		}
+		rows = tag.RowsAffected()
+		pw.CloseWithError(err)
+	}()
+
+	arc := &Archive{Partition: p.Name, Hour: p.Start, Location: archiveName(p), Format: archiveFormat}
+	arc.Bytes, err = a.sink.Put(ctx, arc.Location, io.TeeReader(pr, hash))
+	pr.CloseWithError(err) // unblocks the writer if Put gave up early
+	<-done
+	if err != nil {
+		return nil, fmt.Errorf("archive %s: %w", p.Name, err)
+	}
+	arc.Rows = rows
+	arc.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	_, err = a.pool.Exec(ctx, `
+		INSERT INTO activity_archives (partition_name, hour, location, format, row_count, bytes, sha256)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (partition_name) DO UPDATE SET
+			location = EXCLUDED.location, format = EXCLUDED.format, row_count = EXCLUDED.row_count,
+			bytes = EXCLUDED.bytes, sha256 = EXCLUDED.sha256, archived_at = NOW(),
+			restored_at = NULL, keep_until = NULL`,
+		arc.Partition, arc.Hour, arc.Location, arc.Format, arc.Rows, arc.Bytes, arc.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("record archive %s: %w", p.Name, err)
+	}
+	slog.Info("archived partition", "partition", p.Name, "rows", arc.Rows, "bytes", arc.Bytes, "location", arc.Location)
+	return arc, nil
+}
+
+// Restore re-creates an archived hour as a player_activity partition. The
+// partition is kept by retention until keepUntil.
+func (a *Archiver) Restore(ctx context.Context, hour time.Time, keepUntil time.Time) (*Archive, error) {
+	arc := &Archive{}
+	err := a.pool.QueryRow(ctx, `
+		SELECT partition_name, hour, location, format, row_count, bytes, sha256
+		FROM activity_archives WHERE hour = $1`, hour).
+		Scan(&arc.Partition, &arc.Hour, &arc.Location, &arc.Format, &arc.Rows, &arc.Bytes, &arc.SHA256)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("no archive for %s", hour.UTC().Format(time.RFC3339))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("look up archive: %w", err)
+	}
+	if arc.Format != archiveFormat {
+		return nil, fmt.Errorf("archive %s has unsupported format %q", arc.Partition, arc.Format)
+	}
+
+	f, err := a.sink.Open(ctx, arc.Location)
+	if err != nil {
+		return nil, fmt.Errorf("open archive: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	raw := io.TeeReader(f, hash)
+	dec, err := zstd.NewReader(raw)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+
+	// The header row names the columns, so the file loads correctly even if
+	// player_activity has gained columns since it was written.
+	br := bufio.NewReader(dec)
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read archive header: %w", err)
+	}
+	cols := strings.Split(strings.TrimSpace(header), ",")
+	for i, c := range cols {
+		cols[i] = pgx.Identifier{c}.Sanitize()
+	}
+
+	tx, err := a.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	table := pgx.Identifier{arc.Partition}.Sanitize()
+	if _, err := tx.Exec(ctx, "CREATE TABLE "+table+" (LIKE player_activity INCLUDING DEFAULTS)"); err != nil {
+		return nil, fmt.Errorf("create %s: %w", arc.Partition, err)
+	}
+	tag, err := tx.Conn().PgConn().CopyFrom(ctx, br,
+		"COPY "+table+" ("+strings.Join(cols, ", ")+") FROM STDIN WITH (FORMAT csv)")
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", arc.Partition, err)
+	}
+	// Drain so the checksum covers the whole file.
+	if _, err := io.Copy(io.Discard, raw); err != nil {
+		return nil, err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != arc.SHA256 {
+		return nil, fmt.Errorf("archive %s is corrupt: checksum %s, manifest %s", arc.Location, sum, arc.SHA256)
+	}
+	if tag.RowsAffected() != arc.Rows {
+		return nil, fmt.Errorf("archive %s: loaded %d rows, manifest says %d", arc.Location, tag.RowsAffected(), arc.Rows)
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("ALTER TABLE player_activity ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')",
+		table, arc.Hour.UTC().Format(time.RFC3339), arc.Hour.Add(time.Hour).UTC().Format(time.RFC3339))); err != nil {
+		return nil, fmt.Errorf("attach %s: %w", arc.Partition, err)
+	}
+	if _, err := tx.Exec(ctx,
+		"UPDATE activity_archives SET restored_at = NOW(), keep_until = $2 WHERE partition_name = $1",
+		arc.Partition, keepUntil); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	slog.Info("restored partition", "partition", arc.Partition, "rows", arc.Rows, "keep_until", keepUntil)
+	return arc, nil
+}
+
+// archivedPartitions returns the manifest state of archived partitions:
+// whether each is archived, and until when a restored one must be kept.
+func archivedPartitions(ctx context.Context, pool *pgxpool.Pool) (map[string]*time.Time, error) {
+	rows, err := pool.Query(ctx, "SELECT partition_name, keep_until FROM activity_archives")
+	if err != nil {
+		return nil, fmt.Errorf("query activity_archives: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]*time.Time)
+	for rows.Next() {
+		var (
+			name string
+			keep *time.Time
+		)
+		if err := rows.Scan(&name, &keep); err != nil {
+			return nil, err
+		}
+		out[name] = keep
+	}
+	return out, rows.Err()
+}
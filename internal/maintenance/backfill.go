@@ -0,0 +1,53 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// dimensionSources maps each dimension table to the snapshot table it can be
+// rebuilt from.
+var dimensionSources = []struct {
+	table, snapshots, uuidCol, nameCol string
+}{
+	{"players", "player_snapshots", "player_uuid", "player_name"},
+	{"towns", "town_snapshots", "town_uuid", "town_name"},
+	{"nations", "nation_snapshots", "nation_uuid", "nation_name"},
+}
+
+// BackfillDimensions rebuilds the players, towns and nations tables for a
+// server from snapshot history: first_seen moves back to the earliest
+// snapshot, last_seen forward to the latest observation, and the name is
+// taken from the latest snapshot when it is newer than the row. It returns
+// the number of rows written per table.
+func BackfillDimensions(ctx context.Context, pool *pgxpool.Pool, server string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(dimensionSources))
+	for _, d := range dimensionSources {
+		sql := fmt.Sprintf(`
+			INSERT INTO %[1]s (server_id, uuid, name, first_seen, last_seen)
+			SELECT DISTINCT ON (%[3]s)
+			       server_id, %[3]s, %[4]s,
+			       MIN(snapshot_ts) OVER w,
+			       MAX(COALESCE(observed_until, snapshot_ts)) OVER w
+			FROM %[2]s
+			WHERE server_id = $1
+			WINDOW w AS (PARTITION BY %[3]s)
+			ORDER BY %[3]s, snapshot_ts DESC
+			ON CONFLICT (server_id, uuid) DO UPDATE SET
+				name       = CASE WHEN EXCLUDED.last_seen >= %[1]s.last_seen THEN EXCLUDED.name ELSE %[1]s.name END,
+				first_seen = LEAST(%[1]s.first_seen, EXCLUDED.first_seen),
+				last_seen  = GREATEST(%[1]s.last_seen, EXCLUDED.last_seen)`,
+			d.table, d.snapshots, d.uuidCol, d.nameCol)
+
+		tag, err := pool.Exec(ctx, sql, server)
+		if err != nil {
+			return counts, fmt.Errorf("backfill %s: %w", d.table, err)
+		}
+		counts[d.table] = tag.RowsAffected()
+		slog.Info("backfilled dimension", "server", server, "table", d.table, "rows", tag.RowsAffected())
+	}
+	return counts, nil
+}
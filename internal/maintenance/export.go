@@ -0,0 +1,117 @@
+package maintenance
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// exportTables lists the tables and views that can be exported, with the
+// timestamp column used for --from/--to filtering.
+var exportTables = map[string]string{
+	"player_activity":         "snapshot_ts",
+	"server_snapshots":        "snapshot_ts",
+	"player_snapshots":        "snapshot_ts",
+	"town_snapshots":          "snapshot_ts",
+	"nation_snapshots":        "snapshot_ts",
+	"quarter_snapshots":       "snapshot_ts",
+	"player_snapshots_filled": "snapshot_ts",
+	"town_snapshots_filled":   "snapshot_ts",
+	"nation_snapshots_filled": "snapshot_ts",
+	"players":                 "last_seen",
+	"towns":                   "last_seen",
+	"nations":                 "last_seen",
+	"schema_drift":            "last_seen",
+}
+
+// ExportTables returns the names accepted by Export, sorted.
+func ExportTables() []string {
+	names := make([]string, 0, len(exportTables))
+	for name := range exportTables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExportQuery selects the rows to export. Zero From/To and an empty Server
+// leave that filter off.
+type ExportQuery struct {
+	Table  string
+	Server string
+	From   time.Time
+	To     time.Time
+	Format string // "csv" (with header) or "jsonl"
+}
+
+// Export streams the selected rows to w, ordered by the table's timestamp
+// column.
+func Export(ctx context.Context, pool *pgxpool.Pool, w io.Writer, q ExportQuery) error {
+	tsCol, ok := exportTables[q.Table]
+	if !ok {
+		return fmt.Errorf("cannot export %q (choose from %s)", q.Table, strings.Join(ExportTables(), ", "))
+	}
+
+	// COPY takes no bind parameters, so the filters are inlined as quoted
+	// literals.
+	var where []string
+	if q.Server != "" {
+		where = append(where, "server_id = "+quoteLiteral(q.Server))
+	}
+	if !q.From.IsZero() {
+		where = append(where, fmt.Sprintf("%s >= %s", tsCol, quoteLiteral(q.From.Format(time.RFC3339Nano))))
+	}
+	if !q.To.IsZero() {
+		where = append(where, fmt.Sprintf("%s < %s", tsCol, quoteLiteral(q.To.Format(time.RFC3339Nano))))
+	}
+	sql := "SELECT * FROM " + q.Table
+	if len(where) > 0 {
+		sql += " WHERE " + strings.Join(where, " AND ")
+	}
+	sql += " ORDER BY " + tsCol
+
+	switch q.Format {
+	case "", "csv":
+		conn, err := pool.Acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("acquire connection: %w", err)
+		}
+		defer conn.Release()
+		_, err = conn.Conn().PgConn().CopyTo(ctx, w, "COPY ("+sql+") TO STDOUT WITH (FORMAT csv, HEADER)")
+		return err
+
+	case "jsonl":
+		rows, err := pool.Query(ctx, "SELECT row_to_json(t)::text FROM ("+sql+") t")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		bw := bufio.NewWriter(w)
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				return err
+			}
+			bw.WriteString(line)
+			bw.WriteByte('\n')
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return bw.Flush()
+
+	default:
+		return fmt.Errorf("unknown export format %q (csv or jsonl)", q.Format)
+	}
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
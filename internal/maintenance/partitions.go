@@ -0,0 +1,144 @@
+// Package maintenance holds the one-off database jobs run from the worker's
+// subcommands: partition management, backfills and exports.
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Partition is one hourly child table of player_activity.
+type Partition struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+// EnsurePartitions creates the hourly player_activity partitions for the
+// current hour and the next aheadHours.
+func EnsurePartitions(ctx context.Context, pool *pgxpool.Pool, aheadHours int) error {
+	if _, err := pool.Exec(ctx, "SELECT create_activity_partitions(NOW(), $1)", aheadHours); err != nil {
+		return fmt.Errorf("create partitions: %w", err)
+	}
+	return nil
+}
+
+// ListPartitions returns the attached hourly partitions, oldest first. The
+// hour is read back from the partition name, which create_activity_partitions
+// derives from the range start.
+func ListPartitions(ctx context.Context, pool *pgxpool.Pool) ([]Partition, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT c.relname,
+		       TO_TIMESTAMP(SUBSTRING(c.relname FROM '\d{8}_\d{6}$'), 'YYYYMMDD_HH24MISS') AS start_ts
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'player_activity'::regclass
+		  AND c.relname ~ '^player_activity_\d{8}_\d{6}$'
+		ORDER BY start_ts`)
+	if err != nil {
+		return nil, fmt.Errorf("list partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var parts []Partition
+	for rows.Next() {
+		var p Partition
+		if err := rows.Scan(&p.Name, &p.Start); err != nil {
+			return nil, err
+		}
+		p.End = p.Start.Add(time.Hour)
+		parts = append(parts, p)
+	}
+	return parts, rows.Err()
+}
+
+// PrunePartitions drops every partition whose hour ended at or before
+// cutoff, rolling the hour up first if that has not happened yet and, with a
+// non-nil archive, exporting it unless it is already archived. Restored
+// partitions are skipped until their keep_until, and hours dropped without
+// an archive lose their activity_ticks too. It returns the partitions
+// affected; with dryRun it only reports them.
+func PrunePartitions(ctx context.Context, pool *pgxpool.Pool, cutoff time.Time, archive *Archiver, dryRun bool) ([]Partition, error) {
+	parts, err := ListPartitions(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+	rolled, err := rolledUpHours(ctx, pool, parts[0].Start)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := archivedPartitions(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var pruned []Partition
+	for _, p := range parts {
+		if p.End.After(cutoff) {
+			break
+		}
+		keep, isArchived := archived[p.Name]
+		if keep != nil && keep.After(now) {
+			continue
+		}
+		if dryRun {
+			pruned = append(pruned, p)
+			continue
+		}
+
+		if !rolled[p.Start.Unix()] {
+			if _, err := RollupHour(ctx, pool, p.Start); err != nil {
+				return pruned, err
+			}
+		}
+		if archive != nil && !isArchived {
+			if _, err := archive.ArchivePartition(ctx, p); err != nil {
+				return pruned, err
+			}
+		}
+		if err := DropPartition(ctx, pool, p.Name); err != nil {
+			return pruned, err
+		}
+		if archive == nil && !isArchived {
+			// Nothing can be restored for the hour, so its ticks go too.
+			if err := deleteActivityTicks(ctx, pool, p); err != nil {
+				return pruned, err
+			}
+		}
+		slog.Info("dropped partition", "partition", p.Name)
+		pruned = append(pruned, p)
+	}
+	return pruned, nil
+}
+
+// deleteActivityTicks removes the activity_ticks of a dropped partition's
+// hour. Archived hours keep theirs, so a restored partition can still be
+// read through player_activity_dense.
+func deleteActivityTicks(ctx context.Context, pool *pgxpool.Pool, p Partition) error {
+	if _, err := pool.Exec(ctx,
+		"DELETE FROM activity_ticks WHERE snapshot_ts >= $1 AND snapshot_ts < $2", p.Start, p.End); err != nil {
+		return fmt.Errorf("delete activity ticks of %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// DropPartition detaches a partition from player_activity and drops it.
+func DropPartition(ctx context.Context, pool *pgxpool.Pool, name string) error {
+	ident := pgx.Identifier{name}.Sanitize()
+	if _, err := pool.Exec(ctx, "ALTER TABLE player_activity DETACH PARTITION "+ident); err != nil {
+		return fmt.Errorf("detach %s: %w", name, err)
+	}
+	if _, err := pool.Exec(ctx, "DROP TABLE "+ident); err != nil {
+		return fmt.Errorf("drop %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package maintenance
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// retentionLockID keeps concurrent instances from rolling up or
+	// dropping the same hours.
+	retentionLockID = 0x6561727468_7274 // "earthrt"
+
+	// rollupDelay leaves a finished hour alone for a while so the last
+	// ticks have landed before it is summarised.
+	rollupDelay = 10 * time.Minute
+
+	// maxRollupsPerRun bounds how long one pass takes when there is a
+	// backlog, e.g. on the first run against an existing database.
+	maxRollupsPerRun = 48
+
+	retentionCronJob = "activity_retention_job"
+)
+
+// Retention rolls completed hours of player_activity up into the minutely and
+// hourly tables and drops raw partitions older than the retention window.
+type Retention struct {
+	pool     *pgxpool.Pool
+	raw      time.Duration // 0 keeps raw partitions forever
+	interval time.Duration
+	archive  *Archiver // nil drops partitions without exporting them
+	log      *slog.Logger
+}
+
+// NewRetention creates the retention job. raw is how long raw 3-second rows
+// are kept; 0 disables dropping but still rolls hours up. With a non-nil
+// archive, partitions are exported before they are dropped.
+func NewRetention(pool *pgxpool.Pool, raw, interval time.Duration, archive *Archiver) *Retention {
+	return &Retention{
+		pool:     pool,
+		raw:      raw,
+		interval: interval,
+		archive:  archive,
+		log:      slog.With("component", "retention"),
+	}
+}
+
+// Run keeps the pg_cron job in step with the configured window and then runs
+// a pass every interval. Blocks until context is cancelled.
+func (r *Retention) Run(ctx context.Context) {
+	r.log.Info("retention started", "raw_retention", r.raw, "interval", r.interval, "archive", r.archive != nil)
+
+	// pg_cron cannot archive, so it must not drop partitions the worker
+	// would export.
+	cronWindow := r.raw
+	if r.archive != nil {
+		cronWindow = 0
+	}
+	if err := SyncRetentionCron(ctx, r.pool, cronWindow); err != nil {
+		r.log.Warn("could not sync pg_cron retention job, worker will run it alone", "error", err)
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.RunOnce(ctx); err != nil {
+			r.log.Error("retention pass failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			r.log.Info("retention stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce rolls up pending hours and drops expired partitions. It does
+// nothing if another instance holds the retention lock.
+func (r *Retention) RunOnce(ctx context.Context) error {
+	conn, err := r.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", int64(retentionLockID)).Scan(&locked); err != nil {
+		return fmt.Errorf("take retention lock: %w", err)
+	}
+	if !locked {
+		r.log.Info("retention pass skipped: another instance is running it")
+		return nil
+	}
+	defer func() {
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.Exec(unlockCtx, "SELECT pg_advisory_unlock($1)", int64(retentionLockID)); err != nil {
+			r.log.Warn("failed to release retention lock", "error", err)
+		}
+	}()
+
+	start := time.Now()
+	rolled, err := RollupPending(ctx, r.pool, start.Add(-rollupDelay), maxRollupsPerRun)
+	if err != nil {
+		return err
+	}
+
+	var dropped []Partition
+	if r.raw > 0 {
+		dropped, err = PrunePartitions(ctx, r.pool, start.Add(-r.raw), r.archive, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.log.Info("retention pass complete",
+		"rolled_up_hours", rolled,
+		"dropped_partitions", len(dropped),
+		"duration", time.Since(start).Round(time.Millisecond),
+	)
+	return nil
+}
+
+// RollupHour summarises one hour of raw activity, replacing any earlier
+// rollup of it, and returns the number of raw rows read.
+func RollupHour(ctx context.Context, pool *pgxpool.Pool, hour time.Time) (int64, error) {
+	var rows int64
+	if err := pool.QueryRow(ctx, "SELECT rollup_activity_hour($1)", hour).Scan(&rows); err != nil {
+		return 0, fmt.Errorf("roll up %s: %w", hour.UTC().Format(time.RFC3339), err)
+	}
+	return rows, nil
+}
+
+// RollupPending rolls up, oldest first, up to limit partitions whose hour
+// ended before cutoff and has not been rolled up yet. It returns how many it
+// rolled up.
+func RollupPending(ctx context.Context, pool *pgxpool.Pool, cutoff time.Time, limit int) (int, error) {
+	parts, err := ListPartitions(ctx, pool)
+	if err != nil {
+		return 0, err
+	}
+	if len(parts) == 0 {
+		return 0, nil
+	}
+	rolled, err := rolledUpHours(ctx, pool, parts[0].Start)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, p := range parts {
+		if p.End.After(cutoff) || count >= limit {
+			break
+		}
+		if rolled[p.Start.Unix()] {
+			continue
+		}
+		rows, err := RollupHour(ctx, pool, p.Start)
+		if err != nil {
+			return count, err
+		}
+		slog.Debug("rolled up activity hour", "hour", p.Start, "raw_rows", rows)
+		count++
+	}
+	return count, nil
+}
+
+// rolledUpHours returns the start (as Unix seconds) of every hour since
+// `since` that has been rolled up.
+func rolledUpHours(ctx context.Context, pool *pgxpool.Pool, since time.Time) (map[int64]bool, error) {
+	rows, err := pool.Query(ctx, "SELECT hour FROM activity_rollups WHERE hour >= $1", since)
+	if err != nil {
+		return nil, fmt.Errorf("query activity_rollups: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[int64]bool)
+	for rows.Next() {
+		var h time.Time
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		done[h.Unix()] = true
+	}
+	return done, rows.Err()
+}
+
+// SyncRetentionCron schedules enforce_activity_retention hourly in pg_cron
+// with the given window, or unschedules it when raw is 0. It is a no-op
+// where pg_cron is not installed.
+func SyncRetentionCron(ctx context.Context, pool *pgxpool.Pool, raw time.Duration) error {
+	var installed bool
+	if err := pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_cron')").Scan(&installed); err != nil {
+		return err
+	}
+	if !installed {
+		return nil
+	}
+
+	if raw <= 0 {
+		_, err := pool.Exec(ctx,
+			"SELECT cron.unschedule(jobid) FROM cron.job WHERE jobname = $1", retentionCronJob)
+		return err
+	}
+
+	command := fmt.Sprintf("SELECT enforce_activity_retention(INTERVAL '%d seconds');", int64(raw.Seconds()))
+	_, err := pool.Exec(ctx, "SELECT cron.schedule($1, '20 * * * *', $2)", retentionCronJob, command)
+	return err
+}
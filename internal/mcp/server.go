@@ -0,0 +1,323 @@
+// Package mcp is a Model Context Protocol server that gives the site's AI
+// agent typed, read-only tools over the scraped data. It speaks JSON-RPC
+// 2.0 over stdio (one message per line) or over HTTP (one POST per message).
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0Mattias/earthmc-scraper/internal/query"
+)
+
+// protocolVersions are the MCP revisions this server speaks, newest first.
+var protocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// maxMessageBytes caps one incoming message.
+const maxMessageBytes = 4 << 20
+
+// Server answers MCP requests with the tools in tools.go.
+type Server struct {
+	store    *query.Store
+	servers  []string // the first is the default
+	timeout  time.Duration
+	rowLimit int
+	tools    []tool
+}
+
+// NewServer creates an MCP server for the named EarthMC servers. Every tool
+// call runs under timeout, and run_readonly_sql returns at most rowLimit
+// rows.
+func NewServer(pool *pgxpool.Pool, servers []string, timeout time.Duration, rowLimit int) *Server {
+	s := &Server{
+		store:    query.NewStore(pool),
+		servers:  servers,
+		timeout:  timeout,
+		rowLimit: rowLimit,
+	}
+	s.tools = s.newTools()
+	return s
+}
+
+// ---- Transports ----
+
+// RunStdio serves one client over in and out until in is closed or ctx is
+// cancelled. Logs must not go to out.
+func (s *Server) RunStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	slog.Info("mcp server starting", "transport", "stdio", "servers", s.servers)
+
+	lines := make(chan []byte)
+	errCh := make(chan error, 1)
+	go func() {
+		sc := bufio.NewScanner(in)
+		sc.Buffer(make([]byte, 64<<10), maxMessageBytes)
+		for sc.Scan() {
+			lines <- append([]byte(nil), sc.Bytes()...)
+		}
+		errCh <- sc.Err()
+	}()
+
+	w := bufio.NewWriter(out)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errCh:
+			return err
+		case line := <-lines:
+			if len(line) == 0 {
+				continue
+			}
+			resp := s.handle(ctx, line)
+			if resp == nil {
+				continue
+			}
+			w.Write(resp)
+			w.WriteByte('\n')
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RunHTTP serves clients on addr (host:port) at /mcp until ctx is
+// cancelled. Every request to /mcp must carry token as a bearer token. Each
+// POST carries one message and gets its response as JSON; server-sent event
+// streams are not offered.
+func (s *Server) RunHTTP(ctx context.Context, addr, token string) error {
+	if token == "" {
+		return errors.New("mcp over http needs a token")
+	}
+	slog.Info("mcp server starting", "transport", "http", "addr", addr, "servers", s.servers)
+
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", requireToken(token, http.HandlerFunc(s.handleHTTP)))
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// requireToken refuses requests without "Authorization: Bearer <token>".
+func requireToken(token string, next http.Handler) http.Handler {
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Browsers on other sites must not reach the server through the user's
+	// network (DNS rebinding), so a cross-origin request is refused.
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMessageBytes))
+	if err != nil {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	resp := s.handle(r.Context(), body)
+	if resp == nil {
+		// A notification or a response
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// ---- JSON-RPC ----
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// handle answers one message. It returns nil for notifications and for
+// responses, which need no answer.
+func (s *Server) handle(ctx context.Context, msg []byte) []byte {
+	var req rpcRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		if !json.Valid(msg) {
+			return encode(rpcResponse{ID: json.RawMessage("null"), Error: &rpcError{codeParseError, "parse error: " + err.Error()}})
+		}
+		// Batches are not part of MCP since 2025-06-18.
+		return encode(rpcResponse{ID: json.RawMessage("null"), Error: &rpcError{codeInvalidRequest, "invalid request: expected one JSON-RPC object"}})
+	}
+	if req.Method == "" {
+		return nil
+	}
+	notification := req.ID == nil
+	if req.JSONRPC != "2.0" {
+		if notification {
+			return nil
+		}
+		return encode(rpcResponse{ID: req.ID, Error: &rpcError{codeInvalidRequest, `jsonrpc must be "2.0"`}})
+	}
+
+	result, rerr := s.dispatch(ctx, req)
+	if notification {
+		return nil
+	}
+	if rerr != nil {
+		return encode(rpcResponse{ID: req.ID, Error: rerr})
+	}
+	return encode(rpcResponse{ID: req.ID, Result: result})
+}
+
+func encode(resp rpcResponse) []byte {
+	resp.JSONRPC = "2.0"
+	b, err := json.Marshal(resp)
+	if err != nil {
+		b, _ = json.Marshal(rpcResponse{JSONRPC: "2.0", ID: resp.ID, Error: &rpcError{codeInternalError, err.Error()}})
+	}
+	return b
+}
+
+func (s *Server) dispatch(ctx context.Context, req rpcRequest) (any, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &p)
+		version := protocolVersions[0]
+		for _, v := range protocolVersions {
+			if v == p.ProtocolVersion {
+				version = v
+			}
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "earthmc-scraper", "version": "1"},
+			"instructions": "Read-only access to scraped EarthMC data. Prefer the typed tools; " +
+				"run_readonly_sql is for questions they cannot answer.",
+		}, nil
+
+	case "ping":
+		return map[string]any{}, nil
+
+	case "tools/list":
+		return map[string]any{"tools": s.tools}, nil
+
+	case "tools/call":
+		var p struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, &rpcError{codeInvalidParams, "invalid params: " + err.Error()}
+		}
+		t := s.tool(p.Name)
+		if t == nil {
+			return nil, &rpcError{codeInvalidParams, fmt.Sprintf("unknown tool %q", p.Name)}
+		}
+		return s.call(ctx, t, p.Arguments), nil
+
+	default:
+		if strings.HasPrefix(req.Method, "notifications/") {
+			return nil, nil
+		}
+		return nil, &rpcError{codeMethodNotFound, fmt.Sprintf("method %q not found", req.Method)}
+	}
+}
+
+// toolResult is the result of tools/call. Failures are reported in it,
+// rather than as JSON-RPC errors, so the agent can read them and retry.
+type toolResult struct {
+	Content []toolContent `json:"content"`
+	IsError bool          `json:"isError"`
+}
+
+type toolContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func (s *Server) call(ctx context.Context, t *tool, args json.RawMessage) toolResult {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	v, err := t.call(ctx, args)
+	if err == nil {
+		var b []byte
+		if b, err = json.Marshal(v); err == nil {
+			slog.Info("mcp tool call", "tool", t.Name, "duration", time.Since(start).Round(time.Millisecond))
+			return toolResult{Content: []toolContent{{Type: "text", Text: string(b)}}}
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("query took longer than %s; narrow it down", s.timeout)
+	}
+	slog.Warn("mcp tool call failed", "tool", t.Name, "error", err)
+	return toolResult{Content: []toolContent{{Type: "text", Text: err.Error()}}, IsError: true}
+}
@@ -0,0 +1,264 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer has no database: only calls that fail before querying work.
+func testServer() *Server {
+	return NewServer(nil, []string{"aurora", "nova"}, time.Second, 50)
+}
+
+func TestHandle(t *testing.T) {
+	s := testServer()
+
+	tests := []struct {
+		name string
+		msg  string
+		// The response decoded to JSON, compared on the keys given; nil
+		// for no response
+		want map[string]any
+	}{
+		{
+			name: "initialize picks the client's version",
+			msg:  `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26"}}`,
+			want: map[string]any{"id": 1.0, "result.protocolVersion": "2025-03-26", "result.serverInfo.name": "earthmc-scraper"},
+		},
+		{
+			name: "initialize offers the newest version to unknown clients",
+			msg:  `{"jsonrpc":"2.0","id":"a","method":"initialize","params":{"protocolVersion":"1999-01-01"}}`,
+			want: map[string]any{"id": "a", "result.protocolVersion": protocolVersions[0]},
+		},
+		{
+			name: "ping",
+			msg:  `{"jsonrpc":"2.0","id":2,"method":"ping"}`,
+			want: map[string]any{"id": 2.0, "result": map[string]any{}},
+		},
+		{
+			name: "unknown method",
+			msg:  `{"jsonrpc":"2.0","id":3,"method":"resources/list"}`,
+			want: map[string]any{"error.code": float64(codeMethodNotFound)},
+		},
+		{
+			name: "unknown tool",
+			msg:  `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"drop_tables"}}`,
+			want: map[string]any{"error.code": float64(codeInvalidParams), "error.message": `unknown tool "drop_tables"`},
+		},
+		{
+			name: "invalid tools/call params",
+			msg:  `{"jsonrpc":"2.0","id":5,"method":"tools/call","params":[]}`,
+			want: map[string]any{"error.code": float64(codeInvalidParams)},
+		},
+		{
+			name: "notification",
+			msg:  `{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		},
+		{
+			name: "notification for an unknown method",
+			msg:  `{"jsonrpc":"2.0","method":"resources/list"}`,
+		},
+		{
+			name: "response from the client",
+			msg:  `{"jsonrpc":"2.0","id":6,"result":{}}`,
+		},
+		{
+			name: "parse error",
+			msg:  `{"jsonrpc":`,
+			want: map[string]any{"id": nil, "error.code": float64(codeParseError)},
+		},
+		{
+			name: "batch",
+			msg:  `[{"jsonrpc":"2.0","id":7,"method":"ping"}]`,
+			want: map[string]any{"id": nil, "error.code": float64(codeInvalidRequest)},
+		},
+		{
+			name: "wrong jsonrpc version",
+			msg:  `{"jsonrpc":"1.0","id":8,"method":"ping"}`,
+			want: map[string]any{"id": 8.0, "error.code": float64(codeInvalidRequest)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.handle(context.Background(), []byte(tt.msg))
+			if tt.want == nil {
+				if resp != nil {
+					t.Fatalf("response %s, want none", resp)
+				}
+				return
+			}
+			var got map[string]any
+			if err := json.Unmarshal(resp, &got); err != nil {
+				t.Fatalf("response %s: %v", resp, err)
+			}
+			if got["jsonrpc"] != "2.0" {
+				t.Errorf("jsonrpc = %v, want 2.0", got["jsonrpc"])
+			}
+			for path, want := range tt.want {
+				if v := lookup(got, path); !reflect.DeepEqual(v, want) {
+					t.Errorf("%s = %#v, want %#v in %s", path, v, want, resp)
+				}
+			}
+		})
+	}
+}
+
+// lookup follows a dotted path into decoded JSON.
+func lookup(v any, path string) any {
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+func TestToolsList(t *testing.T) {
+	resp := testServer().handle(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	var got struct {
+		Result struct {
+			Tools []struct {
+				Name        string          `json:"name"`
+				InputSchema map[string]any  `json:"inputSchema"`
+				Annotations map[string]bool `json:"annotations"`
+			} `json:"tools"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(resp, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, tl := range got.Result.Tools {
+		names = append(names, tl.Name)
+		if !tl.Annotations["readOnlyHint"] {
+			t.Errorf("%s is not marked read-only", tl.Name)
+		}
+		props, _ := tl.InputSchema["properties"].(map[string]any)
+		if _, ok := props["server"]; !ok {
+			t.Errorf("%s takes no server argument", tl.Name)
+		}
+	}
+	want := []string{"find_player", "player_trail", "town_history", "nation_relations", "who_was_online_at", "run_readonly_sql"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("tools = %v, want %v", names, want)
+	}
+}
+
+// TestToolCallErrors checks that bad arguments come back as tool errors the
+// agent can read, before any query runs.
+func TestToolCallErrors(t *testing.T) {
+	tests := []struct {
+		tool, args string
+		want       string
+	}{
+		{"find_player", `{}`, "name is required"},
+		{"find_player", `{"name":"Fix","server":"mars"}`, `unknown server "mars" (choose from aurora, nova)`},
+		{"find_player", `{"name":7}`, "invalid arguments"},
+		{"player_trail", `{"player":"Fix","from":"yesterday"}`, "from:"},
+		{"player_trail", `{"from":"2026-03-02","to":"2026-03-01"}`, "from must be before to"},
+		{"player_trail", `{}`, "player is required"},
+		{"town_history", `{}`, "town is required"},
+		{"nation_relations", `{}`, "nation is required"},
+		{"who_was_online_at", `{}`, "at is required"},
+		{"who_was_online_at", `{"at":"noon"}`, "at:"},
+		{"run_readonly_sql", `{"sql":"  "}`, "sql is required"},
+	}
+	s := testServer()
+	for _, tt := range tests {
+		t.Run(tt.tool+" "+tt.args, func(t *testing.T) {
+			msg := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"` + tt.tool + `","arguments":` + tt.args + `}}`
+			var got struct {
+				Result toolResult `json:"result"`
+			}
+			if err := json.Unmarshal(s.handle(context.Background(), []byte(msg)), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !got.Result.IsError || len(got.Result.Content) != 1 || !strings.Contains(got.Result.Content[0].Text, tt.want) {
+				t.Errorf("result = %+v, want an error containing %q", got.Result, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	h := requireToken("s3cret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"no header", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer guess", http.StatusUnauthorized},
+		{"token without scheme", "s3cret", http.StatusUnauthorized},
+		{"token prefix", "Bearer s3cre", http.StatusUnauthorized},
+		{"right token", "Bearer s3cret", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Error("401 without WWW-Authenticate: Bearer")
+			}
+		})
+	}
+}
+
+func TestRunHTTPNeedsToken(t *testing.T) {
+	if err := testServer().RunHTTP(context.Background(), "127.0.0.1:0", ""); err == nil {
+		t.Error("RunHTTP started without a token")
+	}
+}
+
+func TestHandleHTTP(t *testing.T) {
+	ping := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+
+	tests := []struct {
+		name   string
+		method string
+		origin string
+		body   string
+		want   int
+	}{
+		{"post", http.MethodPost, "", ping, http.StatusOK},
+		{"same origin", http.MethodPost, "http://localhost:8081", ping, http.StatusOK},
+		{"cross origin", http.MethodPost, "https://evil.example", ping, http.StatusForbidden},
+		{"origin on another port", http.MethodPost, "http://localhost:9999", ping, http.StatusForbidden},
+		{"notification", http.MethodPost, "", `{"jsonrpc":"2.0","method":"notifications/initialized"}`, http.StatusAccepted},
+		{"get", http.MethodGet, "", "", http.StatusMethodNotAllowed},
+		{"too large", http.MethodPost, "", strings.Repeat(" ", maxMessageBytes+1), http.StatusRequestEntityTooLarge},
+	}
+	s := testServer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "http://localhost:8081/mcp", strings.NewReader(tt.body))
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			s.handleHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/0Mattias/earthmc-scraper/internal/query"
+)
+
+// Default result sizes, and the time range when a tool is given none.
+const (
+	defaultTrailLimit   = 200
+	defaultHistoryLimit = 20
+	defaultOnlineLimit  = 200
+	defaultRange        = 24 * time.Hour
+)
+
+// tool is one MCP tool as listed by tools/list.
+type tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+	Annotations map[string]bool `json:"annotations"`
+
+	call func(ctx context.Context, args json.RawMessage) (any, error)
+}
+
+func (s *Server) tool(name string) *tool {
+	for i := range s.tools {
+		if s.tools[i].Name == name {
+			return &s.tools[i]
+		}
+	}
+	return nil
+}
+
+// newTools defines the tools. Every tool takes an optional server, and
+// none of them writes.
+func (s *Server) newTools() []tool {
+	tools := []tool{
+		{
+			Name:        "find_player",
+			Description: "Find players by current or former Minecraft name, ignoring case. Returns each matching player's uuid, current name and when they used the name.",
+			InputSchema: schema(
+				prop{"name", "string", "Minecraft name to look up", true},
+			),
+			call: s.findPlayer,
+		},
+		{
+			Name: "player_trail",
+			Description: "Positions a player was seen at on the live map, oldest first, with the town and nation whose land they stood on. " +
+				"Only changes are stored: the player stayed at each point until the next one. Hidden players have no trail.",
+			InputSchema: schema(
+				prop{"player", "string", "player uuid, or a current or former name", true},
+				prop{"from", "string", "start time, RFC 3339 (default: a day before to)", false},
+				prop{"to", "string", "end time, RFC 3339 (default: now)", false},
+				prop{"limit", "integer", fmt.Sprintf("most points to return (default %d, at most %d)", defaultTrailLimit, s.rowLimit), false},
+			),
+			call: s.playerTrail,
+		},
+		{
+			Name: "town_history",
+			Description: "Snapshots of a town that were current during a time range, oldest first, each with the full town payload " +
+				"(mayor, residents, nation, stats, status, claims). A new snapshot is only stored when something changed.",
+			InputSchema: schema(
+				prop{"town", "string", "town uuid or name", true},
+				prop{"from", "string", "start time, RFC 3339 (default: a day before to)", false},
+				prop{"to", "string", "end time, RFC 3339 (default: now)", false},
+				prop{"limit", "integer", fmt.Sprintf("most snapshots to return (default %d, at most %d)", defaultHistoryLimit, s.rowLimit), false},
+			),
+			call: s.townHistory,
+		},
+		{
+			Name:        "nation_relations",
+			Description: "A nation's current allies, enemies and sanctioned nations, and its most recent diplomatic changes.",
+			InputSchema: schema(
+				prop{"nation", "string", "nation uuid or name", true},
+			),
+			call: s.nationRelations,
+		},
+		{
+			Name:        "who_was_online_at",
+			Description: "Players online at a point in time, with their position and the town they stood in when visible on the map. Empty when the scraper was not running then.",
+			InputSchema: schema(
+				prop{"at", "string", "time, RFC 3339", true},
+				prop{"limit", "integer", fmt.Sprintf("most players to return (default %d, at most %d)", defaultOnlineLimit, s.rowLimit), false},
+			),
+			call: s.whoWasOnlineAt,
+		},
+		{
+			Name: "run_readonly_sql",
+			Description: fmt.Sprintf("Run one read-only SQL statement against the scraper's PostgreSQL database, for questions the other tools cannot answer. "+
+				"Returns at most %d rows, and the statement is cancelled after %s. "+
+				"player_activity is partitioned by hour and holds change rows only: always filter it on snapshot_ts, "+
+				"and use player_activity_dense(server, from, to) for one row per online player per tick.", s.rowLimit, s.timeout),
+			InputSchema: schema(
+				prop{"sql", "string", "a single SELECT statement", true},
+				prop{"limit", "integer", fmt.Sprintf("most rows to return (default and maximum %d)", s.rowLimit), false},
+			),
+			call: s.runReadonlySQL,
+		},
+	}
+	for i := range tools {
+		tools[i].Annotations = map[string]bool{"readOnlyHint": true}
+	}
+	return tools
+}
+
+// prop is one tool argument.
+type prop struct {
+	name, typ, description string
+	required               bool
+}
+
+// schema returns the JSON schema for a tool's arguments plus server.
+func schema(props ...prop) json.RawMessage {
+	props = append(props, prop{"server", "string", "EarthMC server (default: the first configured, usually aurora)", false})
+	properties := make(map[string]any, len(props))
+	required := []string{}
+	for _, p := range props {
+		properties[p.name] = map[string]string{"type": p.typ, "description": p.description}
+		if p.required {
+			required = append(required, p.name)
+		}
+	}
+	b, _ := json.Marshal(map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	})
+	return b
+}
+
+// ---- Tools ----
+
+// args are the arguments tools share.
+type args struct {
+	Server string `json:"server"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Limit  int    `json:"limit"`
+}
+
+func (s *Server) findPlayer(ctx context.Context, raw json.RawMessage) (any, error) {
+	var a struct {
+		args
+		Name string `json:"name"`
+	}
+	server, err := s.parse(raw, &a, &a.args)
+	if err != nil {
+		return nil, err
+	}
+	if a.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	return s.store.FindPlayers(ctx, server, a.Name)
+}
+
+func (s *Server) playerTrail(ctx context.Context, raw json.RawMessage) (any, error) {
+	var a struct {
+		args
+		Player string `json:"player"`
+	}
+	server, err := s.parse(raw, &a, &a.args)
+	if err != nil {
+		return nil, err
+	}
+	rng, err := a.timeRange()
+	if err != nil {
+		return nil, err
+	}
+	uuid, err := s.resolvePlayer(ctx, server, a.Player)
+	if err != nil {
+		return nil, err
+	}
+	limit := a.limit(defaultTrailLimit, s.rowLimit)
+	rows, err := s.store.Trail(ctx, server, uuid, rng, query.Page{Limit: limit + 1})
+	return truncate(rows, limit), err
+}
+
+func (s *Server) townHistory(ctx context.Context, raw json.RawMessage) (any, error) {
+	var a struct {
+		args
+		Town string `json:"town"`
+	}
+	server, err := s.parse(raw, &a, &a.args)
+	if err != nil {
+		return nil, err
+	}
+	rng, err := a.timeRange()
+	if err != nil {
+		return nil, err
+	}
+	if a.Town == "" {
+		return nil, errors.New("town is required")
+	}
+	uuid, err := s.store.ResolveTown(ctx, server, a.Town)
+	if err != nil {
+		return nil, notFound(err, "town", a.Town)
+	}
+	limit := a.limit(defaultHistoryLimit, s.rowLimit)
+	rows, err := s.store.TownHistory(ctx, server, uuid, rng, query.Page{Limit: limit + 1})
+	return truncate(rows, limit), err
+}
+
+func (s *Server) nationRelations(ctx context.Context, raw json.RawMessage) (any, error) {
+	var a struct {
+		args
+		Nation string `json:"nation"`
+	}
+	server, err := s.parse(raw, &a, &a.args)
+	if err != nil {
+		return nil, err
+	}
+	if a.Nation == "" {
+		return nil, errors.New("nation is required")
+	}
+	uuid, err := s.store.ResolveNation(ctx, server, a.Nation)
+	if err != nil {
+		return nil, notFound(err, "nation", a.Nation)
+	}
+	n, err := s.store.NationRelations(ctx, server, uuid)
+	return n, notFound(err, "nation", a.Nation)
+}
+
+func (s *Server) whoWasOnlineAt(ctx context.Context, raw json.RawMessage) (any, error) {
+	var a struct {
+		args
+		At string `json:"at"`
+	}
+	server, err := s.parse(raw, &a, &a.args)
+	if err != nil {
+		return nil, err
+	}
+	if a.At == "" {
+		return nil, errors.New("at is required")
+	}
+	at, err := query.ParseTime(a.At)
+	if err != nil {
+		return nil, fmt.Errorf("at: %w", err)
+	}
+
+	type online struct {
+		Tick *time.Time `json:"tick"`
+		truncated[query.OnlinePlayer]
+	}
+	tick, err := s.store.OnlineTick(ctx, server, at)
+	if err != nil || tick.IsZero() {
+		return online{truncated: truncate([]query.OnlinePlayer{}, 0)}, err
+	}
+	limit := a.limit(defaultOnlineLimit, s.rowLimit)
+	rows, err := s.store.Online(ctx, server, tick, query.Page{Limit: limit + 1})
+	return online{Tick: &tick, truncated: truncate(rows, limit)}, err
+}
+
+func (s *Server) runReadonlySQL(ctx context.Context, raw json.RawMessage) (any, error) {
+	var a struct {
+		args
+		SQL string `json:"sql"`
+	}
+	if _, err := s.parse(raw, &a, &a.args); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(a.SQL) == "" {
+		return nil, errors.New("sql is required")
+	}
+	return s.store.ReadOnly(ctx, a.SQL, a.limit(s.rowLimit, s.rowLimit), s.timeout)
+}
+
+// ---- Arguments ----
+
+// parse decodes raw into dst and returns the server the call is for. base
+// is the args embedded in dst.
+func (s *Server) parse(raw json.RawMessage, dst any, base *args) (string, error) {
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, dst); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+	}
+	if base.Server == "" {
+		return s.servers[0], nil
+	}
+	server := strings.ToLower(base.Server)
+	for _, name := range s.servers {
+		if name == server {
+			return server, nil
+		}
+	}
+	return "", fmt.Errorf("unknown server %q (choose from %s)", base.Server, strings.Join(s.servers, ", "))
+}
+
+// limit returns the requested limit, or def when none was given, capped
+// at most.
+func (a args) limit(def, most int) int {
+	n := a.Limit
+	if n <= 0 {
+		n = def
+	}
+	return min(n, most)
+}
+
+// timeRange reads from and to. To defaults to now and from to a day
+// before to.
+func (a args) timeRange() (query.Range, error) {
+	rng := query.Range{To: time.Now()}
+	if a.To != "" {
+		t, err := query.ParseTime(a.To)
+		if err != nil {
+			return rng, fmt.Errorf("to: %w", err)
+		}
+		rng.To = t
+	}
+	rng.From = rng.To.Add(-defaultRange)
+	if a.From != "" {
+		t, err := query.ParseTime(a.From)
+		if err != nil {
+			return rng, fmt.Errorf("from: %w", err)
+		}
+		rng.From = t
+	}
+	if !rng.From.Before(rng.To) {
+		return rng, errors.New("from must be before to")
+	}
+	return rng, nil
+}
+
+// resolvePlayer returns the uuid of the player with uuid or name ref.
+func (s *Server) resolvePlayer(ctx context.Context, server, ref string) (string, error) {
+	if ref == "" {
+		return "", errors.New("player is required")
+	}
+	if len(ref) == 36 && strings.Count(ref, "-") == 4 {
+		return ref, nil
+	}
+	matches, err := s.store.FindPlayers(ctx, server, ref)
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no player has been seen named %q", ref)
+	}
+	return matches[0].UUID, nil
+}
+
+func notFound(err error, kind, ref string) error {
+	if errors.Is(err, query.ErrNotFound) {
+		return fmt.Errorf("no %s has been seen with uuid or name %q", kind, ref)
+	}
+	return err
+}
+
+// truncated is a list cut to the requested limit.
+type truncated[T any] struct {
+	Rows      []T  `json:"rows"`
+	Truncated bool `json:"truncated"`
+}
+
+// truncate cuts rows, fetched with one row over limit, to limit.
+func truncate[T any](rows []T, limit int) truncated[T] {
+	if rows == nil {
+		rows = []T{}
+	}
+	if len(rows) > limit {
+		return truncated[T]{Rows: rows[:limit], Truncated: true}
+	}
+	return truncated[T]{Rows: rows}
+}
@@ -0,0 +1,105 @@
+package mcp
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr string
+	}{
+		{"no arguments", ``, "aurora", ""},
+		{"default server", `{}`, "aurora", ""},
+		{"named server", `{"server":"nova"}`, "nova", ""},
+		{"server ignores case", `{"server":"Nova"}`, "nova", ""},
+		{"unknown server", `{"server":"mars"}`, "", `unknown server "mars"`},
+		{"malformed", `{"server":1}`, "", "invalid arguments"},
+	}
+	s := testServer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a args
+			got, err := s.parse(json.RawMessage(tt.raw), &a, &a)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parse error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parse = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		requested int
+		want      int
+	}{
+		{"default", 0, 20},
+		{"negative takes the default", -5, 20},
+		{"requested", 7, 7},
+		{"capped", 10000, 50},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (args{Limit: tt.requested}).limit(20, 50); got != tt.want {
+				t.Errorf("limit = %d, want %d", got, tt.want)
+			}
+		})
+	}
+	if got := (args{}).limit(500, 50); got != 50 {
+		t.Errorf("default over the cap = %d, want 50", got)
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	day := 24 * time.Hour
+	to := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	rng, err := (args{To: "2026-03-02"}).timeRange()
+	if err != nil || !rng.To.Equal(to) || !rng.From.Equal(to.Add(-day)) {
+		t.Errorf("defaulted from = %v, %v; want a day before %v", rng, err, to)
+	}
+	rng, err = (args{From: "2026-03-01T12:00:00Z", To: "2026-03-02T00:00:00Z"}).timeRange()
+	if err != nil || rng.To.Sub(rng.From) != 12*time.Hour {
+		t.Errorf("explicit range = %v, %v", rng, err)
+	}
+	if rng, err := (args{}).timeRange(); err != nil || time.Since(rng.To) > time.Minute {
+		t.Errorf("defaulted to = %v, %v; want now", rng, err)
+	}
+	if _, err := (args{From: "2026-03-02", To: "2026-03-02"}).timeRange(); err == nil {
+		t.Error("empty range accepted")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rows  []int
+		limit int
+		want  truncated[int]
+	}{
+		{"nil", nil, 3, truncated[int]{Rows: []int{}}},
+		{"under the limit", []int{1, 2}, 3, truncated[int]{Rows: []int{1, 2}}},
+		{"at the limit", []int{1, 2, 3}, 3, truncated[int]{Rows: []int{1, 2, 3}}},
+		{"one over", []int{1, 2, 3, 4}, 3, truncated[int]{Rows: []int{1, 2, 3}, Truncated: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncate(tt.rows, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("truncate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,414 @@
+// Package query holds the read-only queries behind the HTTP API and the MCP
+// server, so every consumer of the scraped data reads it the same way.
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0Mattias/earthmc-scraper/internal/api"
+)
+
+// ErrNotFound is returned when the requested entity has never been seen.
+var ErrNotFound = errors.New("not found")
+
+// onlineTickWindow is how far before the requested time the nearest
+// high-freq tick may be. Older ticks mean the scraper was not running.
+const onlineTickWindow = time.Minute
+
+// Store runs the queries against the database pool.
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+// NewStore creates a Store on pool.
+func NewStore(pool *pgxpool.Pool) *Store {
+	return &Store{pool: pool}
+}
+
+// Range is a half-open time range [From, To).
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// Page selects a slice of an ordered result.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// ParseTime accepts RFC 3339 timestamps or bare UTC dates.
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+// ---- Players ----
+
+// Player is a player's profile: the dimension row, every name seen for the
+// uuid and the latest player snapshot.
+type Player struct {
+	UUID      string          `json:"uuid"`
+	Name      string          `json:"name"`
+	FirstSeen time.Time       `json:"first_seen"`
+	LastSeen  time.Time       `json:"last_seen"`
+	Names     []PlayerName    `json:"names"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// PlayerName is one name a player has been seen with.
+type PlayerName struct {
+	Name      string    `json:"name"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Player returns the profile of the player with uuid.
+func (s *Store) Player(ctx context.Context, server, uuid string) (*Player, error) {
+	p := Player{Names: []PlayerName{}}
+	err := s.pool.QueryRow(ctx, `
+		SELECT p.uuid, p.name, p.first_seen, p.last_seen,
+		       (SELECT data FROM player_snapshots s
+		        WHERE s.server_id = p.server_id AND s.player_uuid = p.uuid
+		        ORDER BY s.snapshot_ts DESC LIMIT 1)
+		FROM players p
+		WHERE p.server_id = $1 AND p.uuid = $2`, server, uuid).
+		Scan(&p.UUID, &p.Name, &p.FirstSeen, &p.LastSeen, &p.Data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT name, first_seen, last_seen FROM player_name_history
+		WHERE server_id = $1 AND player_uuid = $2
+		ORDER BY first_seen`, server, uuid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var n PlayerName
+		if err := rows.Scan(&n.Name, &n.FirstSeen, &n.LastSeen); err != nil {
+			return nil, err
+		}
+		p.Names = append(p.Names, n)
+	}
+	return &p, rows.Err()
+}
+
+// PlayerMatch is a player who has been seen with a searched name.
+type PlayerMatch struct {
+	UUID        string    `json:"uuid"`
+	CurrentName string    `json:"current_name"`
+	MatchedName string    `json:"matched_name"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+}
+
+// FindPlayers returns the players who have ever had name, ignoring case,
+// most recently seen with it first.
+func (s *Store) FindPlayers(ctx context.Context, server, name string) ([]PlayerMatch, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT h.player_uuid, COALESCE(p.name, h.name), h.name, h.first_seen, h.last_seen
+		FROM player_name_history h
+		LEFT JOIN players p ON p.server_id = h.server_id AND p.uuid = h.player_uuid
+		WHERE h.server_id = $1 AND LOWER(h.name) = LOWER($2)
+		ORDER BY h.last_seen DESC`, server, name)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (PlayerMatch, error) {
+		var m PlayerMatch
+		err := row.Scan(&m.UUID, &m.CurrentName, &m.MatchedName, &m.FirstSeen, &m.LastSeen)
+		return m, err
+	})
+}
+
+// TrailPoint is a position a player was seen at on the live map. Only
+// changes are stored, so a player keeps the last point until the next.
+type TrailPoint struct {
+	SnapshotTS   time.Time `json:"snapshot_ts"`
+	World        *string   `json:"world"`
+	X            *int      `json:"x"`
+	Y            *int      `json:"y"`
+	Z            *int      `json:"z"`
+	InTownUUID   *string   `json:"in_town_uuid"`
+	InNationUUID *string   `json:"in_nation_uuid"`
+	IsWilderness *bool     `json:"is_wilderness"`
+}
+
+// Trail returns the positions the player with uuid was seen at within r,
+// oldest first.
+func (s *Store) Trail(ctx context.Context, server, uuid string, r Range, p Page) ([]TrailPoint, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT snapshot_ts, world, x, y, z, in_town_uuid, in_nation_uuid, is_wilderness
+		FROM player_activity
+		WHERE server_id = $1 AND player_uuid = $2 AND is_visible
+		  AND snapshot_ts >= $3 AND snapshot_ts < $4
+		ORDER BY snapshot_ts
+		LIMIT $5 OFFSET $6`, server, uuid, r.From, r.To, p.Limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (TrailPoint, error) {
+		var t TrailPoint
+		err := row.Scan(&t.SnapshotTS, &t.World, &t.X, &t.Y, &t.Z, &t.InTownUUID, &t.InNationUUID, &t.IsWilderness)
+		return t, err
+	})
+}
+
+// ---- Towns and nations ----
+
+// ResolveTown returns the uuid of the town with uuid or name ref. A name
+// shared over time by several towns means the one seen most recently.
+func (s *Store) ResolveTown(ctx context.Context, server, ref string) (string, error) {
+	return s.resolve(ctx, "towns", server, ref)
+}
+
+// ResolveNation is ResolveTown for nations.
+func (s *Store) ResolveNation(ctx context.Context, server, ref string) (string, error) {
+	return s.resolve(ctx, "nations", server, ref)
+}
+
+func (s *Store) resolve(ctx context.Context, table, server, ref string) (string, error) {
+	var uuid string
+	err := s.pool.QueryRow(ctx, `
+		SELECT uuid FROM `+table+`
+		WHERE server_id = $1 AND (uuid = $2 OR LOWER(name) = LOWER($2))
+		ORDER BY uuid = $2 DESC, last_seen DESC
+		LIMIT 1`, server, ref).Scan(&uuid)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return uuid, err
+}
+
+// Snapshot is a stored town or nation payload, current from SnapshotTS
+// until ObservedUntil.
+type Snapshot struct {
+	UUID          string          `json:"uuid"`
+	Name          string          `json:"name"`
+	SnapshotTS    time.Time       `json:"snapshot_ts"`
+	ObservedUntil time.Time       `json:"observed_until"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// TownHistory returns the snapshots of the town with uuid that were
+// current at some point within r, oldest first. Snapshots are only written
+// when the town changes.
+func (s *Store) TownHistory(ctx context.Context, server, uuid string, r Range, p Page) ([]Snapshot, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT town_uuid, town_name, snapshot_ts, COALESCE(observed_until, snapshot_ts), data
+		FROM town_snapshots
+		WHERE server_id = $1 AND town_uuid = $2
+		  AND snapshot_ts < $4 AND COALESCE(observed_until, snapshot_ts) >= $3
+		ORDER BY snapshot_ts
+		LIMIT $5 OFFSET $6`, server, uuid, r.From, r.To, p.Limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return collectSnapshots(rows)
+}
+
+// Nations returns the latest snapshot of every nation seen at the last
+// nation scrape, by name.
+func (s *Store) Nations(ctx context.Context, server string, p Page) ([]Snapshot, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT * FROM (
+			SELECT DISTINCT ON (nation_uuid)
+			       nation_uuid, nation_name, snapshot_ts, COALESCE(observed_until, snapshot_ts), data
+			FROM nation_snapshots
+			WHERE server_id = $1
+			  AND COALESCE(observed_until, snapshot_ts) >= (
+			      SELECT MAX(snapshot_ts) FROM snapshot_ticks WHERE server_id = $1 AND kind = 'nation')
+			ORDER BY nation_uuid, snapshot_ts DESC
+		) n
+		ORDER BY nation_name, nation_uuid
+		LIMIT $2 OFFSET $3`, server, p.Limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return collectSnapshots(rows)
+}
+
+// NationRelations is a nation's diplomacy: its lists as of the latest
+// snapshot, and the recent changes to them.
+type NationRelations struct {
+	UUID       string          `json:"uuid"`
+	Name       string          `json:"name"`
+	SnapshotTS time.Time       `json:"snapshot_ts"`
+	Allies     []api.ListEntry `json:"allies"`
+	Enemies    []api.ListEntry `json:"enemies"`
+	Sanctioned []api.ListEntry `json:"sanctioned"`
+	Changes    []NationChange  `json:"recent_changes"`
+}
+
+// NationChange is a nation_events row for a diplomatic change.
+type NationChange struct {
+	SnapshotTS  time.Time `json:"snapshot_ts"`
+	EventType   string    `json:"event_type"`
+	RelatedUUID *string   `json:"related_uuid"`
+	RelatedName *string   `json:"related_name"`
+}
+
+// recentNationChanges is how many diplomatic changes NationRelations
+// returns.
+const recentNationChanges = 20
+
+// NationRelations returns the diplomacy of the nation with uuid.
+func (s *Store) NationRelations(ctx context.Context, server, uuid string) (*NationRelations, error) {
+	var (
+		n    NationRelations
+		data json.RawMessage
+	)
+	err := s.pool.QueryRow(ctx, `
+		SELECT nation_uuid, nation_name, snapshot_ts, data FROM nation_snapshots
+		WHERE server_id = $1 AND nation_uuid = $2
+		ORDER BY snapshot_ts DESC LIMIT 1`, server, uuid).Scan(&n.UUID, &n.Name, &n.SnapshotTS, &data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var detail api.NationDetail
+	if err := json.Unmarshal(data, &detail); err != nil {
+		return nil, fmt.Errorf("parse nation snapshot: %w", err)
+	}
+	n.Allies, n.Enemies, n.Sanctioned = entries(detail.Allies), entries(detail.Enemies), entries(detail.Sanctioned)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT snapshot_ts, event_type, related_uuid, related_name FROM nation_events
+		WHERE server_id = $1 AND nation_uuid = $2
+		  AND event_type IN ('ally_added', 'ally_removed', 'enemy_added', 'enemy_removed',
+		                     'sanctioned_added', 'sanctioned_removed')
+		ORDER BY snapshot_ts DESC, id DESC
+		LIMIT $3`, server, uuid, recentNationChanges)
+	if err != nil {
+		return nil, err
+	}
+	n.Changes, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (NationChange, error) {
+		var c NationChange
+		err := row.Scan(&c.SnapshotTS, &c.EventType, &c.RelatedUUID, &c.RelatedName)
+		return c, err
+	})
+	return &n, err
+}
+
+func entries(list []api.ListEntry) []api.ListEntry {
+	if list == nil {
+		return []api.ListEntry{}
+	}
+	return list
+}
+
+func collectSnapshots(rows pgx.Rows) ([]Snapshot, error) {
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Snapshot, error) {
+		var s Snapshot
+		err := row.Scan(&s.UUID, &s.Name, &s.SnapshotTS, &s.ObservedUntil, &s.Data)
+		return s, err
+	})
+}
+
+// ---- Server ----
+
+// ServerStats is one server_snapshots row.
+type ServerStats struct {
+	SnapshotTS         time.Time `json:"snapshot_ts"`
+	Version            *string   `json:"version"`
+	MaxPlayers         *int      `json:"max_players"`
+	NumOnlinePlayers   *int      `json:"num_online_players"`
+	NumOnlineNomads    *int      `json:"num_online_nomads"`
+	NumResidents       *int      `json:"num_residents"`
+	NumNomads          *int      `json:"num_nomads"`
+	NumTowns           *int      `json:"num_towns"`
+	NumTownBlocks      *int      `json:"num_town_blocks"`
+	NumNations         *int      `json:"num_nations"`
+	NumQuarters        *int      `json:"num_quarters"`
+	VotePartyRemaining *int      `json:"vote_party_remaining"`
+}
+
+// ServerHistory returns the server-wide stats recorded within r, oldest
+// first.
+func (s *Store) ServerHistory(ctx context.Context, server string, r Range, p Page) ([]ServerStats, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT snapshot_ts, version, max_players, num_online_players, num_online_nomads,
+		       num_residents, num_nomads, num_towns, num_town_blocks, num_nations,
+		       num_quarters, vote_party_remaining
+		FROM server_snapshots
+		WHERE server_id = $1 AND snapshot_ts >= $2 AND snapshot_ts < $3
+		ORDER BY snapshot_ts
+		LIMIT $4 OFFSET $5`, server, r.From, r.To, p.Limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (ServerStats, error) {
+		var st ServerStats
+		err := row.Scan(&st.SnapshotTS, &st.Version, &st.MaxPlayers, &st.NumOnlinePlayers, &st.NumOnlineNomads,
+			&st.NumResidents, &st.NumNomads, &st.NumTowns, &st.NumTownBlocks, &st.NumNations,
+			&st.NumQuarters, &st.VotePartyRemaining)
+		return st, err
+	})
+}
+
+// ---- Online ----
+
+// OnlinePlayer is a player online at a high-freq tick. Position fields are
+// nil for players hidden from the map.
+type OnlinePlayer struct {
+	UUID         string  `json:"uuid"`
+	Name         string  `json:"name"`
+	IsVisible    bool    `json:"is_visible"`
+	World        *string `json:"world"`
+	X            *int    `json:"x"`
+	Y            *int    `json:"y"`
+	Z            *int    `json:"z"`
+	InTownUUID   *string `json:"in_town_uuid"`
+	InNationUUID *string `json:"in_nation_uuid"`
+	IsWilderness *bool   `json:"is_wilderness"`
+}
+
+// OnlineTick returns the last high-freq tick at or before at, or the zero
+// time when there was none shortly before it (the scraper was down).
+func (s *Store) OnlineTick(ctx context.Context, server string, at time.Time) (time.Time, error) {
+	var tick *time.Time
+	err := s.pool.QueryRow(ctx, `
+		SELECT MAX(snapshot_ts) FROM activity_ticks
+		WHERE server_id = $1 AND snapshot_ts <= $2 AND snapshot_ts > $3`,
+		server, at, at.Add(-onlineTickWindow)).Scan(&tick)
+	if err != nil || tick == nil {
+		return time.Time{}, err
+	}
+	return *tick, nil
+}
+
+// Online returns the players online at the high-freq tick, by name.
+func (s *Store) Online(ctx context.Context, server string, tick time.Time, p Page) ([]OnlinePlayer, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT player_uuid, player_name, is_visible, world, x, y, z,
+		       in_town_uuid, in_nation_uuid, is_wilderness
+		FROM player_activity_dense($1, $2, $2)
+		ORDER BY player_name, player_uuid
+		LIMIT $3 OFFSET $4`, server, tick, p.Limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (OnlinePlayer, error) {
+		var o OnlinePlayer
+		err := row.Scan(&o.UUID, &o.Name, &o.IsVisible, &o.World, &o.X, &o.Y, &o.Z,
+			&o.InTownUUID, &o.InNationUUID, &o.IsWilderness)
+		return o, err
+	})
+}
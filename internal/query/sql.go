@@ -0,0 +1,92 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SQLResult is what a read-only statement returned. Truncated is set when
+// it had more rows than the limit.
+type SQLResult struct {
+	Columns   []string `json:"columns"`
+	Rows      [][]any  `json:"rows"`
+	Truncated bool     `json:"truncated"`
+}
+
+// ReadOnly runs one statement in a read-only transaction that is always
+// rolled back, under a statement_timeout of timeout, and returns at most
+// limit rows. The statement is prepared, so several statements separated by
+// semicolons are rejected by the server.
+//
+// A read-only transaction does not undo session state such as advisory
+// locks or LISTEN, so the connection is closed afterwards instead of going
+// back to the pool.
+func (s *Store) ReadOnly(ctx context.Context, sql string, limit int, timeout time.Duration) (*SQLResult, error) {
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn.Hijack().Close(closeCtx)
+	}()
+
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())); err != nil {
+		return nil, fmt.Errorf("set statement timeout: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := &SQLResult{Rows: [][]any{}}
+	for _, f := range rows.FieldDescriptions() {
+		res.Columns = append(res.Columns, f.Name)
+	}
+	for rows.Next() {
+		if len(res.Rows) == limit {
+			res.Truncated = true
+			break
+		}
+		vals, err := rows.Values()
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range vals {
+			vals[i] = jsonValue(v)
+		}
+		res.Rows = append(res.Rows, vals)
+	}
+	rows.Close()
+	return res, rows.Err()
+}
+
+// jsonValue makes a decoded column value encodable as JSON: uuids become
+// strings, and values without a JSON form (NaN, say) fall back to their
+// text.
+func jsonValue(v any) any {
+	switch v := v.(type) {
+	case nil, bool, string, int16, int32, int64, time.Time, map[string]any, []any:
+		return v
+	case [16]byte:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", v[0:4], v[4:6], v[6:8], v[8:10], v[10:16])
+	default:
+		if b, err := json.Marshal(v); err == nil {
+			return json.RawMessage(b)
+		}
+		return fmt.Sprint(v)
+	}
+}
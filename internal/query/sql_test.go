@@ -0,0 +1,44 @@
+package query
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestJSONValue(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	uuid := [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0}
+
+	tests := []struct {
+		name string
+		in   any
+		want string // the value encoded as JSON
+	}{
+		{"null", nil, `null`},
+		{"bool", true, `true`},
+		{"text", "Tokyo", `"Tokyo"`},
+		{"int", int64(42), `42`},
+		{"timestamp", ts, `"2026-03-01T12:00:00Z"`},
+		{"jsonb", map[string]any{"a": 1.0}, `{"a":1}`},
+		{"uuid", uuid, `"12345678-9abc-def0-1234-56789abcdef0"`},
+		{"float", 2.5, `2.5`},
+		{"numeric", pgtype.Numeric{Int: big.NewInt(12345), Exp: -2, Valid: true}, `123.45`},
+		{"NaN", math.NaN(), `"NaN"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(jsonValue(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("jsonValue(%v) encodes as %s, want %s", tt.in, b, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package scraper
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/0Mattias/earthmc-scraper/internal/db"
+)
+
+// Border event types in border_events.event_type.
+const (
+	borderEnter = "enter"
+	borderLeave = "leave"
+)
+
+// borderEvent is a visible player crossing a town's border.
+type borderEvent struct {
+	Type       string   `json:"type"`
+	PlayerUUID string   `json:"player_uuid"`
+	PlayerName string   `json:"player_name"`
+	TownUUID   string   `json:"town_uuid"`
+	TownName   string   `json:"town_name"`
+	NationUUID *string  `json:"nation_uuid"`
+	X          int      `json:"x"`
+	Z          int      `json:"z"`
+	World      string   `json:"world"`
+	Relation   relation `json:"relation"`
+}
+
+// crossings compares the town each located row stands in with the last
+// tick's, and returns an event for every town left or entered along with
+// the new positions. A player who appears inside a town enters it; one who
+// disappears leaves nothing. The first located tick only records positions,
+// and while the claim index is not loaded there are none.
+func (h *HighFreq) crossings(rows []activityRow) ([]borderEvent, map[string]*claimTown) {
+	var (
+		events []borderEvent
+		next   map[string]*claimTown
+	)
+	for _, r := range rows {
+		if r.IsWilderness == nil {
+			// Hidden, or the index is not loaded yet
+			continue
+		}
+		if next == nil {
+			next = make(map[string]*claimTown, len(rows))
+		}
+		next[r.PlayerUUID] = r.town
+		if h.lastTown == nil {
+			continue
+		}
+
+		prev, seen := h.lastTown[r.PlayerUUID]
+		if seen && townUUID(prev) == townUUID(r.town) {
+			continue
+		}
+		if prev != nil {
+			events = append(events, h.borderEvent(borderLeave, r, prev))
+		}
+		if r.town != nil {
+			events = append(events, h.borderEvent(borderEnter, r, r.town))
+		}
+	}
+	return events, next
+}
+
+func (h *HighFreq) borderEvent(typ string, r activityRow, t *claimTown) borderEvent {
+	return borderEvent{
+		Type:       typ,
+		PlayerUUID: r.PlayerUUID,
+		PlayerName: r.PlayerName,
+		TownUUID:   t.uuid,
+		TownName:   t.name,
+		NationUUID: t.nation,
+		X:          *r.X,
+		Z:          *r.Z,
+		World:      *r.World,
+		Relation:   h.claims.relation(t, r.PlayerUUID),
+	}
+}
+
+func townUUID(t *claimTown) string {
+	if t == nil {
+		return ""
+	}
+	return t.uuid
+}
+
+var borderColumns = []string{
+	"server_id", "snapshot_ts", "player_uuid", "player_name", "event_type",
+	"town_uuid", "town_name", "nation_uuid", "x", "z", "world",
+	"is_resident", "is_trusted", "is_outlaw", "is_nation_member", "is_ally", "is_enemy", "run_id",
+}
+
+// writeBorders stores a tick's border events in its activity transaction.
+func (h *HighFreq) writeBorders(ctx context.Context, tx pgx.Tx, ts time.Time, b activityBatch) error {
+	rows := make([][]any, len(b.Borders))
+	for i, e := range b.Borders {
+		rel := e.Relation
+		rows[i] = []any{
+			h.server, ts, e.PlayerUUID, e.PlayerName, e.Type,
+			e.TownUUID, e.TownName, e.NationUUID, e.X, e.Z, e.World,
+			rel.Resident, rel.Trusted, rel.Outlaw, rel.NationMember, rel.Ally, rel.Enemy, b.Run.ID,
+		}
+	}
+	_, err := db.CopyRows(ctx, tx, "border_events", borderColumns, rows)
+	return err
+}
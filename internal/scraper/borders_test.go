@@ -0,0 +1,159 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/0Mattias/earthmc-scraper/internal/api"
+)
+
+// testClaims is Tokyo (nation Japan) on chunk (0, 0) with Fix as resident,
+// and Kyoto (nationless) on chunk (1, 0) with Owen3H as outlaw.
+func testClaims(t *testing.T) *ClaimIndex {
+	t.Helper()
+	var towns []api.TownDetail
+	err := json.Unmarshal([]byte(`[
+		{"name":"Tokyo","uuid":"t1","nation":{"name":"Japan","uuid":"n1"},
+		 "coordinates":{"townBlocks":[[0,0]]},"residents":[{"name":"Fix","uuid":"p1"}]},
+		{"name":"Kyoto","uuid":"t2",
+		 "coordinates":{"townBlocks":[[1,0]]},"outlaws":[{"name":"Owen3H","uuid":"p2"}]}
+	]`), &towns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := NewClaimIndex()
+	idx.update(towns, []string{"t1", "t2"})
+	return idx
+}
+
+func TestCrossings(t *testing.T) {
+	const (
+		tokyo = 8  // block x inside chunk 0
+		kyoto = 24 // block x inside chunk 1
+		wild  = 100
+	)
+	hidden := activityRow{PlayerUUID: "p1", PlayerName: "Fix", IsOnline: true}
+
+	tests := []struct {
+		name string
+		// Town uuid per player at the last tick, "" for wilderness; nil
+		// for no located tick yet
+		last     map[string]string
+		rows     []activityRow
+		want     []string
+		wantNext map[string]string
+	}{
+		{
+			name:     "first located tick only records positions",
+			rows:     []activityRow{visibleAt("p1", "Fix", tokyo, 0)},
+			wantNext: map[string]string{"p1": "t1"},
+		},
+		{
+			name:     "enter from wilderness",
+			last:     map[string]string{"p1": ""},
+			rows:     []activityRow{visibleAt("p1", "Fix", tokyo, 0)},
+			want:     []string{"enter Fix Tokyo x=8 resident"},
+			wantNext: map[string]string{"p1": "t1"},
+		},
+		{
+			name:     "leave into wilderness",
+			last:     map[string]string{"p1": "t1"},
+			rows:     []activityRow{visibleAt("p1", "Fix", wild, 0)},
+			want:     []string{"leave Fix Tokyo x=100 resident"},
+			wantNext: map[string]string{"p1": ""},
+		},
+		{
+			name:     "cross from one town into the next",
+			last:     map[string]string{"p2": "t1"},
+			rows:     []activityRow{visibleAt("p2", "Owen3H", kyoto, 0)},
+			want:     []string{"leave Owen3H Tokyo x=24", "enter Owen3H Kyoto x=24 outlaw"},
+			wantNext: map[string]string{"p2": "t2"},
+		},
+		{
+			name:     "moving inside a town",
+			last:     map[string]string{"p1": "t1"},
+			rows:     []activityRow{visibleAt("p1", "Fix", tokyo+4, 9)},
+			wantNext: map[string]string{"p1": "t1"},
+		},
+		{
+			name:     "appearing inside a town enters it",
+			last:     map[string]string{},
+			rows:     []activityRow{visibleAt("p2", "Owen3H", kyoto, 0), visibleAt("p1", "Fix", wild, 0)},
+			want:     []string{"enter Owen3H Kyoto x=24 outlaw"},
+			wantNext: map[string]string{"p2": "t2", "p1": ""},
+		},
+		{
+			name:     "disappearing leaves nothing",
+			last:     map[string]string{"p1": "t1", "p2": "t2"},
+			rows:     []activityRow{hidden, visibleAt("p2", "Owen3H", kyoto, 0)},
+			wantNext: map[string]string{"p2": "t2"},
+		},
+		{
+			name: "no located rows",
+			last: map[string]string{"p1": "t1"},
+			rows: []activityRow{hidden},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := testClaims(t)
+			towns := claims.cur.Load().towns
+			h := &HighFreq{claims: claims}
+			if tt.last != nil {
+				h.lastTown = make(map[string]*claimTown)
+				for player, town := range tt.last {
+					h.lastTown[player] = towns[town]
+				}
+			}
+			for i := range tt.rows {
+				if tt.rows[i].IsVisible {
+					h.locate(&tt.rows[i])
+				}
+			}
+
+			events, next := h.crossings(tt.rows)
+			var got []string
+			for _, e := range events {
+				got = append(got, describeBorder(e))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+			var gotNext map[string]string
+			if next != nil {
+				gotNext = make(map[string]string, len(next))
+				for player, town := range next {
+					gotNext[player] = townUUID(town)
+				}
+			}
+			if !reflect.DeepEqual(gotNext, tt.wantNext) {
+				t.Errorf("positions = %v, want %v", gotNext, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestCrossingsWithoutIndex(t *testing.T) {
+	h := &HighFreq{claims: NewClaimIndex(), lastTown: map[string]*claimTown{}}
+	r := visibleAt("p1", "Fix", 8, 0)
+	h.locate(&r)
+	if r.IsWilderness != nil {
+		t.Fatal("row located before the index was loaded")
+	}
+	if events, next := h.crossings([]activityRow{r}); events != nil || next != nil {
+		t.Errorf("crossings = %v, %v; want nothing", events, next)
+	}
+}
+
+func describeBorder(e borderEvent) string {
+	s := fmt.Sprintf("%s %s %s x=%d", e.Type, e.PlayerName, e.TownName, e.X)
+	if e.Relation.Resident {
+		s += " resident"
+	}
+	if e.Relation.Outlaw {
+		s += " outlaw"
+	}
+	return s
+}
@@ -0,0 +1,255 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0Mattias/earthmc-scraper/internal/api"
+)
+
+// ClaimIndex maps chunks to the towns claiming them, so the high-freq loop
+// can tell whose land a player stands on without a query, and keeps the town
+// and nation membership needed to say how the player relates to that town.
+// The low-freq loop rebuilds it after every town and nation scrape; readers
+// see either the old or the new map, never a mix. A nil *ClaimIndex is never
+// loaded.
+type ClaimIndex struct {
+	cur     atomic.Pointer[claimMap]
+	nations atomic.Pointer[map[string]*claimNation]
+}
+
+// claimMap is one immutable build of the index.
+type claimMap struct {
+	towns     map[string]*claimTown // by uuid
+	chunks    map[chunk]*claimTown
+	residents map[string]*claimTown // by player uuid
+}
+
+// claimTown is what the index knows about a town.
+type claimTown struct {
+	uuid   string
+	name   string
+	nation *string // uuid, nil for nationless towns
+	chunks []chunk
+
+	// Player uuids
+	residents map[string]bool
+	trusted   map[string]bool
+	outlaws   map[string]bool
+}
+
+// claimNation is what the index knows about a nation.
+type claimNation struct {
+	allies  map[string]bool // nation uuids
+	enemies map[string]bool
+}
+
+// relation is how a player relates to a town.
+type relation struct {
+	Resident     bool `json:"resident"`
+	Trusted      bool `json:"trusted"`
+	Outlaw       bool `json:"outlaw"`
+	NationMember bool `json:"nation_member"`
+	Ally         bool `json:"ally"`
+	Enemy        bool `json:"enemy"`
+}
+
+// NewClaimIndex returns an empty index, to be shared by one server's
+// high- and low-freq scrapers.
+func NewClaimIndex() *ClaimIndex {
+	return &ClaimIndex{}
+}
+
+// lookup returns the town owning block (x, z) in world, nil for wilderness.
+// ok is false until the index has been loaded. Towns only claim land in the
+// overworld.
+func (c *ClaimIndex) lookup(world string, x, z int) (t *claimTown, ok bool) {
+	if c == nil {
+		return nil, false
+	}
+	m := c.cur.Load()
+	if m == nil {
+		return nil, false
+	}
+	if strings.HasSuffix(world, "_nether") || strings.HasSuffix(world, "_the_end") {
+		return nil, true
+	}
+	// Chunks are 16 blocks; the shift floors negative coordinates too.
+	return m.chunks[chunk{x >> 4, z >> 4}], true
+}
+
+// update rebuilds the index from freshly scraped towns. Towns that are
+// still listed but whose details failed to fetch keep their previous
+// claims; towns no longer listed are dropped.
+func (c *ClaimIndex) update(towns []api.TownDetail, listed []string) {
+	if c == nil {
+		return
+	}
+	next := make(map[string]*claimTown, len(listed))
+	if prev := c.cur.Load(); prev != nil {
+		for _, uuid := range listed {
+			if t, ok := prev.towns[uuid]; ok {
+				next[uuid] = t
+			}
+		}
+	}
+	for _, t := range towns {
+		next[t.UUID] = newClaimTown(t)
+	}
+	c.cur.Store(buildClaimMap(next))
+}
+
+func newClaimTown(t api.TownDetail) *claimTown {
+	ct := &claimTown{
+		uuid:      t.UUID,
+		name:      t.Name,
+		residents: entrySet(t.Residents),
+		trusted:   entrySet(t.Trusted),
+		outlaws:   entrySet(t.Outlaws),
+	}
+	if t.Nation != nil {
+		ct.nation = &t.Nation.UUID
+	}
+	for ch := range townChunks(t.Coordinates) {
+		ct.chunks = append(ct.chunks, ch)
+	}
+	return ct
+}
+
+func buildClaimMap(towns map[string]*claimTown) *claimMap {
+	m := &claimMap{
+		towns:     towns,
+		chunks:    make(map[chunk]*claimTown),
+		residents: make(map[string]*claimTown),
+	}
+	for _, t := range towns {
+		for _, ch := range t.chunks {
+			m.chunks[ch] = t
+		}
+		for uuid := range t.residents {
+			m.residents[uuid] = t
+		}
+	}
+	return m
+}
+
+func entrySet(entries []api.ListEntry) map[string]bool {
+	set := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		set[e.UUID] = true
+	}
+	return set
+}
+
+// updateNations replaces the nation relations from freshly scraped nations,
+// keeping listed nations whose details failed to fetch.
+func (c *ClaimIndex) updateNations(nations []api.NationDetail, listed []string) {
+	if c == nil {
+		return
+	}
+	next := make(map[string]*claimNation, len(listed))
+	if prev := c.nations.Load(); prev != nil {
+		for _, uuid := range listed {
+			if n, ok := (*prev)[uuid]; ok {
+				next[uuid] = n
+			}
+		}
+	}
+	for _, n := range nations {
+		next[n.UUID] = &claimNation{allies: entrySet(n.Allies), enemies: entrySet(n.Enemies)}
+	}
+	c.nations.Store(&next)
+}
+
+// relation says how player relates to t: through t's lists, and through the
+// nation of the player's own town.
+func (c *ClaimIndex) relation(t *claimTown, player string) relation {
+	r := relation{
+		Resident: t.residents[player],
+		Trusted:  t.trusted[player],
+		Outlaw:   t.outlaws[player],
+	}
+	m := c.cur.Load()
+	if m == nil || t.nation == nil {
+		return r
+	}
+	home, ok := m.residents[player]
+	if !ok || home.nation == nil {
+		return r
+	}
+	r.NationMember = *home.nation == *t.nation
+	if nations := c.nations.Load(); nations != nil {
+		if n, ok := (*nations)[*t.nation]; ok {
+			r.Ally = n.allies[*home.nation]
+			r.Enemy = n.enemies[*home.nation]
+		}
+	}
+	return r
+}
+
+// seed loads the index from the latest town and nation snapshots, so
+// lookups work before the first scrape finishes. Only entities seen at the
+// last tick of their kind are included. It does nothing once loaded.
+func (c *ClaimIndex) seed(ctx context.Context, pool *pgxpool.Pool, server string) (int, error) {
+	if c == nil || c.cur.Load() != nil {
+		return 0, nil
+	}
+
+	nations := make(map[string]*claimNation)
+	err := latestSnapshots(ctx, pool, server, nationSnapshots, func(raw json.RawMessage) {
+		var n api.NationDetail
+		if json.Unmarshal(raw, &n) == nil {
+			nations[n.UUID] = &claimNation{allies: entrySet(n.Allies), enemies: entrySet(n.Enemies)}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	towns := make(map[string]*claimTown)
+	err = latestSnapshots(ctx, pool, server, townSnapshots, func(raw json.RawMessage) {
+		var t api.TownDetail
+		if json.Unmarshal(raw, &t) == nil {
+			towns[t.UUID] = newClaimTown(t)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// A scrape may have finished while this was loading.
+	if len(nations) > 0 {
+		c.nations.CompareAndSwap(nil, &nations)
+	}
+	if len(towns) == 0 || !c.cur.CompareAndSwap(nil, buildClaimMap(towns)) {
+		return 0, nil
+	}
+	return len(towns), nil
+}
+
+// latestSnapshots calls fn with the latest payload of every entity of tbl
+// that was seen at the last tick of its kind.
+func latestSnapshots(ctx context.Context, pool *pgxpool.Pool, server string, tbl snapshotTable, fn func(json.RawMessage)) error {
+	rows, err := pool.Query(ctx, fmt.Sprintf(`
+		SELECT DISTINCT ON (%[2]s) data FROM %[1]s
+		WHERE server_id = $1
+		  AND COALESCE(observed_until, snapshot_ts) >= (
+		      SELECT MAX(snapshot_ts) FROM snapshot_ticks WHERE server_id = $1 AND kind = $2)
+		ORDER BY %[2]s, snapshot_ts DESC`, tbl.table, tbl.uuidCol), server, tbl.kind)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var raw json.RawMessage
+		if err := rows.Scan(&raw); err != nil {
+			return err
+		}
+		fn(raw)
+	}
+	return rows.Err()
+}
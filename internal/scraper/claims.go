@@ -0,0 +1,119 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/0Mattias/earthmc-scraper/internal/api"
+	"github.com/0Mattias/earthmc-scraper/internal/db"
+)
+
+// writeClaims brings town_claims in line with the changed towns in b, in
+// the snapshot's transaction. Each town's chunks are diffed against its open
+// claims: new chunks open a claim at ts, and dropped chunks close theirs. A
+// chunk that changed hands is closed for its previous owner, and when
+// b.Listed is set, towns missing from it lose all their claims.
+func (l *LowFreq) writeClaims(ctx context.Context, tx pgx.Tx, ts time.Time, b snapshotBatch) error {
+	claimed := make(map[string]map[chunk]bool, len(b.Changed))
+	uuids := make([]string, 0, len(b.Changed))
+	for _, r := range b.Changed {
+		var t struct {
+			Coordinates *api.TownCoordinates `json:"coordinates"`
+		}
+		if err := json.Unmarshal(r.Raw, &t); err != nil || t.Coordinates == nil {
+			// Leave the town's claims as they were.
+			continue
+		}
+		claimed[r.UUID] = townChunks(t.Coordinates)
+		uuids = append(uuids, r.UUID)
+	}
+
+	open := make(map[string]map[chunk]bool, len(uuids))
+	if len(uuids) > 0 {
+		res, err := tx.Query(ctx, `
+			SELECT town_uuid, chunk_x, chunk_z FROM town_claims
+			WHERE server_id = $1 AND town_uuid = ANY($2) AND valid_to IS NULL`,
+			l.server, uuids)
+		if err != nil {
+			return fmt.Errorf("load open claims: %w", err)
+		}
+		for res.Next() {
+			var (
+				uuid string
+				c    chunk
+			)
+			if err := res.Scan(&uuid, &c.x, &c.z); err != nil {
+				res.Close()
+				return err
+			}
+			if open[uuid] == nil {
+				open[uuid] = make(map[chunk]bool)
+			}
+			open[uuid][c] = true
+		}
+		res.Close()
+		if err := res.Err(); err != nil {
+			return fmt.Errorf("load open claims: %w", err)
+		}
+	}
+
+	var (
+		opened       [][]any
+		lostTowns    []string
+		lostX, lostZ []int
+		gainTowns    []string
+		gainX, gainZ []int
+	)
+	for _, uuid := range uuids {
+		for c := range claimed[uuid] {
+			if !open[uuid][c] {
+				opened = append(opened, []any{l.server, uuid, c.x, c.z, ts, b.Run.ID})
+				gainTowns, gainX, gainZ = append(gainTowns, uuid), append(gainX, c.x), append(gainZ, c.z)
+			}
+		}
+		for c := range open[uuid] {
+			if !claimed[uuid][c] {
+				lostTowns, lostX, lostZ = append(lostTowns, uuid), append(lostX, c.x), append(lostZ, c.z)
+			}
+		}
+	}
+
+	if len(lostTowns) > 0 {
+		if _, err := tx.Exec(ctx, `
+			UPDATE town_claims c SET valid_to = $2
+			FROM unnest($3::text[], $4::int[], $5::int[]) AS l (town_uuid, x, z)
+			WHERE c.server_id = $1 AND c.valid_to IS NULL
+			  AND c.town_uuid = l.town_uuid AND c.chunk_x = l.x AND c.chunk_z = l.z`,
+			l.server, ts, lostTowns, lostX, lostZ); err != nil {
+			return fmt.Errorf("close lost claims: %w", err)
+		}
+	}
+	if len(gainTowns) > 0 {
+		if _, err := tx.Exec(ctx, `
+			UPDATE town_claims c SET valid_to = $2
+			FROM unnest($3::text[], $4::int[], $5::int[]) AS g (town_uuid, x, z)
+			WHERE c.server_id = $1 AND c.valid_to IS NULL
+			  AND c.chunk_x = g.x AND c.chunk_z = g.z AND c.town_uuid <> g.town_uuid`,
+			l.server, ts, gainTowns, gainX, gainZ); err != nil {
+			return fmt.Errorf("close claims taken over: %w", err)
+		}
+	}
+	if _, err := db.CopyRows(ctx, tx, "town_claims",
+		[]string{"server_id", "town_uuid", "chunk_x", "chunk_z", "valid_from", "run_id"}, opened); err != nil {
+		return err
+	}
+
+	if len(b.Listed) > 0 {
+		if _, err := tx.Exec(ctx, `
+			UPDATE town_claims SET valid_to = $2
+			WHERE server_id = $1 AND valid_to IS NULL AND NOT (town_uuid = ANY($3))`,
+			l.server, ts, b.Listed); err != nil {
+			return fmt.Errorf("close claims of deleted towns: %w", err)
+		}
+	}
+	return nil
+}
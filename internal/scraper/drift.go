@@ -0,0 +1,59 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"time"
+
+	"github.com/0Mattias/earthmc-scraper/internal/drift"
+)
+
+// driftSampleSize is how many payloads per entity kind are checked against
+// their Go type on each low-freq tick.
+const driftSampleSize = 20
+
+// checkDrift compares a random sample of payloads with model and records any
+// differences in schema_drift. Failures are logged, never returned.
+func (l *LowFreq) checkDrift(ctx context.Context, ts time.Time, entity string, details []json.RawMessage, model interface{}) {
+	sample := details
+	if len(details) > driftSampleSize {
+		sample = make([]json.RawMessage, driftSampleSize)
+		for i, idx := range rand.Perm(len(details))[:driftSampleSize] {
+			sample[i] = details[idx]
+		}
+	}
+
+	findings := drift.Check(entity, sample, model)
+	if len(findings) == 0 {
+		return
+	}
+
+	for _, f := range findings {
+		var isNew bool
+		err := l.pool.QueryRow(ctx, `
+			INSERT INTO schema_drift (server_id, entity, path, change, expected_type, observed_type, first_seen, last_seen)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $7)
+			ON CONFLICT (server_id, entity, path, change) DO UPDATE SET
+				expected_type = EXCLUDED.expected_type,
+				observed_type = EXCLUDED.observed_type,
+				last_seen     = EXCLUDED.last_seen,
+				occurrences   = schema_drift.occurrences + 1
+			RETURNING occurrences = 1`,
+			l.server, f.Entity, f.Path, string(f.Change), f.Expected, f.Observed, ts,
+		).Scan(&isNew)
+		if err != nil {
+			l.log.Error("low-freq: record schema drift failed", "entity", entity, "path", f.Path, "error", err)
+			return
+		}
+		if isNew {
+			l.log.Warn("schema drift detected",
+				"entity", f.Entity,
+				"path", f.Path,
+				"change", f.Change,
+				"expected", f.Expected,
+				"observed", f.Observed,
+			)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/0Mattias/earthmc-scraper/internal/api"
+	"github.com/0Mattias/earthmc-scraper/internal/db"
+)
+
+// entityEvent is one typed change between two snapshots of an entity, as
+// stored in the *_events tables.
+type entityEvent struct {
+	Type string
+	// The other entity involved, e.g. the resident who joined
+	RelatedUUID *string
+	RelatedName *string
+	// What changed when the type alone does not say, e.g. a status flag
+	Attribute *string
+	OldValue  *string
+	NewValue  *string
+	Delta     *float64
+	Detail    json.RawMessage
+}
+
+// eventDiff finds the events between an entity's previous and current
+// payloads.
+type eventDiff func(prev, cur json.RawMessage) ([]entityEvent, error)
+
+// writeEvents diffs each changed entity in b against its latest snapshot
+// before ts and stores the events in tbl.events. It runs in the snapshot's
+// transaction, so spooled batches replayed in order diff against the right
+// rows. Entities without an earlier snapshot have no events.
+func (l *LowFreq) writeEvents(ctx context.Context, tx pgx.Tx, ts time.Time, tbl snapshotTable, b snapshotBatch) error {
+	uuids := make([]string, len(b.Changed))
+	for i, r := range b.Changed {
+		uuids[i] = r.UUID
+	}
+
+	res, err := tx.Query(ctx, fmt.Sprintf(`
+		SELECT DISTINCT ON (%[2]s) %[2]s, COALESCE(observed_until, snapshot_ts), data FROM %[1]s
+		WHERE server_id = $1 AND %[2]s = ANY($2) AND snapshot_ts < $3
+		ORDER BY %[2]s, snapshot_ts DESC`, tbl.table, tbl.uuidCol),
+		l.server, uuids, ts)
+	if err != nil {
+		return fmt.Errorf("load previous %s: %w", tbl.table, err)
+	}
+	type previous struct {
+		seen time.Time
+		data json.RawMessage
+	}
+	prev := make(map[string]previous, len(uuids))
+	for res.Next() {
+		var (
+			uuid string
+			p    previous
+		)
+		if err := res.Scan(&uuid, &p.seen, &p.data); err != nil {
+			res.Close()
+			return err
+		}
+		prev[uuid] = p
+	}
+	res.Close()
+	if err := res.Err(); err != nil {
+		return fmt.Errorf("load previous %s: %w", tbl.table, err)
+	}
+
+	var rows [][]any
+	for _, r := range b.Changed {
+		p, ok := prev[r.UUID]
+		if !ok {
+			continue
+		}
+		events, err := tbl.diff(p.data, r.Raw)
+		if err != nil {
+			l.log.Warn("skip "+tbl.kind+" events: parse error", "uuid", r.UUID, "error", err)
+			continue
+		}
+		for _, e := range events {
+			var detail any
+			if e.Detail != nil {
+				detail = e.Detail
+			}
+			rows = append(rows, []any{
+				l.server, ts, p.seen, r.UUID, r.Name, e.Type,
+				e.RelatedUUID, e.RelatedName, e.Attribute, e.OldValue, e.NewValue, e.Delta, detail, b.Run.ID,
+			})
+		}
+	}
+	_, err = db.CopyRows(ctx, tx, tbl.events, []string{
+		"server_id", "snapshot_ts", "prev_ts", tbl.uuidCol, tbl.nameCol, "event_type",
+		"related_uuid", "related_name", "attribute", "old_value", "new_value", "delta", "detail", "run_id",
+	}, rows)
+	return err
+}
+
+// ---- Diff helpers ----
+
+// entryEvents reports the entries added to and removed from a list,
+// matched by uuid.
+func entryEvents(added, removed string, prev, cur []api.ListEntry) []entityEvent {
+	before := make(map[string]bool, len(prev))
+	for _, e := range prev {
+		before[e.UUID] = true
+	}
+	after := make(map[string]bool, len(cur))
+	for _, e := range cur {
+		after[e.UUID] = true
+	}
+
+	var events []entityEvent
+	for _, e := range cur {
+		if !before[e.UUID] {
+			events = append(events, relatedEvent(added, e))
+		}
+	}
+	for _, e := range prev {
+		if !after[e.UUID] {
+			events = append(events, relatedEvent(removed, e))
+		}
+	}
+	return events
+}
+
+// stringsDiff returns the values in cur but not prev, and in prev but not
+// cur, each in list order.
+func stringsDiff(prev, cur []string) (added, removed []string) {
+	before := make(map[string]bool, len(prev))
+	for _, v := range prev {
+		before[v] = true
+	}
+	after := make(map[string]bool, len(cur))
+	for _, v := range cur {
+		after[v] = true
+	}
+	for _, v := range cur {
+		if !before[v] {
+			added = append(added, v)
+		}
+	}
+	for _, v := range prev {
+		if !after[v] {
+			removed = append(removed, v)
+		}
+	}
+	return added, removed
+}
+
+// membershipEvents reports leaving prev and joining cur when a single
+// reference (a town's nation, say) changed. Either side may be nil.
+func membershipEvents(joined, left string, prev, cur *api.ListEntry) []entityEvent {
+	if entryUUID(prev) == entryUUID(cur) {
+		return nil
+	}
+	var events []entityEvent
+	if prev != nil {
+		events = append(events, relatedEvent(left, *prev))
+	}
+	if cur != nil {
+		events = append(events, relatedEvent(joined, *cur))
+	}
+	return events
+}
+
+// replacedEvent reports a single reference (a mayor, say) that changed
+// hands. The new holder is the related entity; the names are the values.
+func replacedEvent(typ string, prev, cur *api.ListEntry) []entityEvent {
+	if entryUUID(prev) == entryUUID(cur) {
+		return nil
+	}
+	e := entityEvent{Type: typ, OldValue: entryName(prev), NewValue: entryName(cur)}
+	if cur != nil {
+		e.RelatedUUID, e.RelatedName = &cur.UUID, &cur.Name
+	}
+	return []entityEvent{e}
+}
+
+func relatedEvent(typ string, e api.ListEntry) entityEvent {
+	return entityEvent{Type: typ, RelatedUUID: &e.UUID, RelatedName: &e.Name}
+}
+
+// textEvent reports a changed optional string, such as a board.
+func textEvent(typ string, prev, cur *string) []entityEvent {
+	if (prev == nil) == (cur == nil) && (prev == nil || *prev == *cur) {
+		return nil
+	}
+	return []entityEvent{{Type: typ, OldValue: prev, NewValue: cur}}
+}
+
+// flagEvent reports a toggled boolean, named by attr.
+func flagEvent(typ, attr string, prev, cur bool) []entityEvent {
+	if prev == cur {
+		return nil
+	}
+	return []entityEvent{{
+		Type:      typ,
+		Attribute: &attr,
+		OldValue:  ptr(strconv.FormatBool(prev)),
+		NewValue:  ptr(strconv.FormatBool(cur)),
+	}}
+}
+
+// deltaEvent reports a changed number with the difference as delta.
+func deltaEvent(typ string, prev, cur float64) []entityEvent {
+	if prev == cur {
+		return nil
+	}
+	return []entityEvent{{
+		Type:     typ,
+		OldValue: ptr(strconv.FormatFloat(prev, 'f', -1, 64)),
+		NewValue: ptr(strconv.FormatFloat(cur, 'f', -1, 64)),
+		Delta:    ptr(cur - prev),
+	}}
+}
+
+func entryUUID(e *api.ListEntry) string {
+	if e == nil {
+		return ""
+	}
+	return e.UUID
+}
+
+func entryName(e *api.ListEntry) *string {
+	if e == nil {
+		return nil
+	}
+	return &e.Name
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,60 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// describe renders the set fields of e on one line, for comparing events.
+func describe(e entityEvent) string {
+	parts := []string{e.Type}
+	for _, f := range []struct {
+		key string
+		val *string
+	}{
+		{"attr", e.Attribute},
+		{"related", e.RelatedName},
+		{"uuid", e.RelatedUUID},
+		{"old", e.OldValue},
+		{"new", e.NewValue},
+	} {
+		if f.val != nil {
+			parts = append(parts, f.key+"="+*f.val)
+		}
+	}
+	if e.Delta != nil {
+		parts = append(parts, fmt.Sprintf("delta=%g", *e.Delta))
+	}
+	if e.Detail != nil {
+		parts = append(parts, "detail="+string(e.Detail))
+	}
+	return strings.Join(parts, " ")
+}
+
+type diffCase struct {
+	name      string
+	prev, cur string
+	want      []string
+}
+
+func runDiffCases(t *testing.T, diff eventDiff, tests []diffCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := diff(json.RawMessage(tt.prev), json.RawMessage(tt.cur))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range events {
+				got = append(got, describe(e))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events:\n got %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
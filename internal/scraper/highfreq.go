@@ -9,18 +9,57 @@ import (
 	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/0Mattias/earthmc-scraper/internal/api"
+	"github.com/0Mattias/earthmc-scraper/internal/db"
+	"github.com/0Mattias/earthmc-scraper/internal/spool"
 )
 
 // HighFreq scrapes online player status and map coordinates every interval.
 type HighFreq struct {
+	server             string
 	client             *api.Client
 	pool               *pgxpool.Pool
 	interval           time.Duration
 	running            sync.Mutex
 	lastPartitionCheck time.Time
+	log                *slog.Logger
+	sessions           *sessionTracker
+
+	// Delta writes: the last written state per online player (nil until a
+	// keyframe has been written) and when the last keyframe was.
+	keyframeEvery time.Duration
+	lastKeyframe  time.Time
+	lastState     map[string]activityState
+
+	// Activity ticks and scrape_runs entries the database could not take,
+	// replayed in order
+	spool *spool.Queue
+	runs  *spool.Queue
+
+	// Which town each chunk belongs to, kept current by the low-freq loop,
+	// and the town each visible player stood in at the last written tick
+	// (nil for wilderness)
+	claims   *ClaimIndex
+	lastTown map[string]*claimTown
+}
+
+// HighFreqOptions tunes a HighFreq scraper.
+type HighFreqOptions struct {
+	// Interval between ticks
+	Interval time.Duration
+	// SessionGrace is how long a player may be missing from /online before
+	// their session is closed
+	SessionGrace time.Duration
+	// KeyframeInterval is how often every online player is written, changed
+	// or not
+	KeyframeInterval time.Duration
+	// Spool holds failed activity writes for replay; nil disables it
+	Spool *spool.Spool
+	// Claims locates visible players in towns; nil leaves rows unstamped
+	Claims *ClaimIndex
 }
 
 // activityRow represents a single player activity record.
@@ -32,14 +71,26 @@ type activityRow struct {
 	X, Y, Z    *int
 	Yaw        *int
 	World      *string
+	// Where a visible player stands, once the claim index is loaded
+	InTownUUID   *string
+	InNationUUID *string
+	IsWilderness *bool
+	town         *claimTown
 }
 
-// NewHighFreq creates a new high-frequency scraper.
-func NewHighFreq(client *api.Client, pool *pgxpool.Pool, interval time.Duration) *HighFreq {
+// NewHighFreq creates a new high-frequency scraper for the named EarthMC server.
+func NewHighFreq(server string, client *api.Client, pool *pgxpool.Pool, opts HighFreqOptions) *HighFreq {
 	return &HighFreq{
-		client:   client,
-		pool:     pool,
-		interval: interval,
+		server:        server,
+		client:        client,
+		pool:          pool,
+		interval:      opts.Interval,
+		log:           slog.With("server", server),
+		sessions:      newSessionTracker(server, pool, opts.SessionGrace),
+		keyframeEvery: opts.KeyframeInterval,
+		spool:         opts.Spool.Queue(server + "/activity"),
+		runs:          opts.Spool.Queue(server + "/runs-" + loopHigh),
+		claims:        opts.Claims,
 	}
 }
 
@@ -51,26 +102,33 @@ func (h *HighFreq) ensurePartitions(ctx context.Context) {
 	}
 	_, err := h.pool.Exec(ctx, "SELECT create_activity_partitions(NOW(), 720)")
 	if err != nil {
-		slog.Error("failed to create partitions", "error", err)
+		h.log.Error("failed to create partitions", "error", err)
 		return
 	}
 	h.lastPartitionCheck = time.Now()
-	slog.Info("ensured hourly partitions exist for next 30 days")
+	h.log.Info("ensured hourly partitions exist for next 30 days")
 }
 
 // Run starts the high-frequency scrape loop. Blocks until context is cancelled.
 func (h *HighFreq) Run(ctx context.Context) {
-	slog.Info("high-freq scraper started", "interval", h.interval)
+	h.log.Info("high-freq scraper started", "interval", h.interval)
 	ticker := time.NewTicker(h.interval)
 	defer ticker.Stop()
 
+	if h.spool != nil {
+		go replaySpool(ctx, h.log, []replayer{
+			{h.spool, h.replayActivity},
+			{h.runs, replayRun(h.pool, h.server)},
+		})
+	}
+
 	// Run immediately on start
 	h.tick(ctx)
 
 	for {
 		select {
 		case <-ctx.Done():
-			slog.Info("high-freq scraper stopped")
+			h.log.Info("high-freq scraper stopped")
 			return
 		case <-ticker.C:
 			h.tick(ctx)
@@ -81,18 +139,46 @@ func (h *HighFreq) Run(ctx context.Context) {
 func (h *HighFreq) tick(ctx context.Context) {
 	// Skip if previous tick is still running
 	if !h.running.TryLock() {
-		slog.Warn("high-freq tick skipped: previous still running")
+		h.log.Warn("high-freq tick skipped: previous still running")
+		rec := skippedRun(loopHigh)
+		if err := recordRun(ctx, h.pool, h.runs, h.server, rec.StartedAt, rec); err != nil {
+			h.log.Error("high-freq: record run failed", "error", err)
+		}
 		return
 	}
 	defer h.running.Unlock()
 
+	_ = h.scrape(ctx)
+}
+
+// ScrapeOnce runs a single high-freq scrape outside the loop.
+func (h *HighFreq) ScrapeOnce(ctx context.Context) error {
+	h.running.Lock()
+	defer h.running.Unlock()
+	return h.scrape(ctx)
+}
+
+// scrape fetches and stores one sample and records it in scrape_runs.
+// Failures are logged here and also returned for ScrapeOnce.
+func (h *HighFreq) scrape(ctx context.Context) error {
+	run := newRun(loopHigh, time.Now())
+	err := h.sample(ctx, run)
+	if rerr := recordRun(ctx, h.pool, h.runs, h.server, run.ts, run.finish()); rerr != nil {
+		h.log.Error("high-freq: record run failed", "error", rerr)
+	}
+	return err
+}
+
+func (h *HighFreq) sample(ctx context.Context, run *scrapeRun) error {
 	// Ensure hourly partitions exist ahead of current time
 	h.ensurePartitions(ctx)
 
-	start := time.Now()
-	snapshotTS := start
+	start := run.StartedAt
+	snapshotTS := run.ts
 
-	// Fetch online players and map positions concurrently
+	// Fetch online players and map positions concurrently. These calls jump
+	// ahead of low-freq batches in the client's rate limiter.
+	apiCtx := api.WithPriority(run.ctx(ctx), api.PriorityHigh)
 	var (
 		onlineResp *api.OnlineResponse
 		mapResp    *api.MapPlayersResponse
@@ -104,22 +190,24 @@ func (h *HighFreq) tick(ctx context.Context) {
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		onlineResp, onlineErr = h.client.GetOnline(ctx)
+		onlineResp, onlineErr = h.client.GetOnline(apiCtx)
 	}()
 	go func() {
 		defer wg.Done()
-		mapResp, mapErr = h.client.GetMapPlayers(ctx)
+		mapResp, mapErr = h.client.GetMapPlayers(apiCtx)
 	}()
 	wg.Wait()
 
 	if onlineErr != nil {
-		slog.Error("high-freq: failed to fetch online players", "error", onlineErr)
-		return
+		h.log.Error("high-freq: failed to fetch online players", "error", onlineErr)
+		run.step("online", runStep{}, start, onlineErr)
+		return fmt.Errorf("get online: %w", onlineErr)
 	}
 	if mapErr != nil {
-		slog.Warn("high-freq: failed to fetch map players, proceeding without coords", "error", mapErr)
+		h.log.Warn("high-freq: failed to fetch map players, proceeding without coords", "error", mapErr)
 		mapResp = &api.MapPlayersResponse{}
 	}
+	run.step("map", runStep{Fetched: len(mapResp.Players)}, start, mapErr)
 
 	// Build map of visible players by UUID (normalize UUID: remove dashes)
 	visibleMap := make(map[string]*api.MapPlayer, len(mapResp.Players))
@@ -147,73 +235,234 @@ func (h *HighFreq) tick(ctx context.Context) {
 			row.Z = &mp.Z
 			row.Yaw = &mp.Yaw
 			row.World = &mp.World
+			h.locate(&row)
 		}
 
 		rows = append(rows, row)
 	}
 
-	if len(rows) == 0 {
-		slog.Debug("high-freq: no online players")
-		return
+	// Sessions also need empty ticks, to close out the last players
+	if err := h.sessions.observe(ctx, snapshotTS, rows); err != nil {
+		h.log.Error("high-freq: session tracking failed", "error", err)
 	}
 
-	// Batch insert using a single multi-value INSERT for speed
-	if err := h.insertActivity(ctx, snapshotTS, rows); err != nil {
-		slog.Error("high-freq: insert activity failed", "error", err)
-		return
+	// Write only the players whose state changed (and those who left), or
+	// everyone on a keyframe
+	keyframe := h.needsKeyframe(snapshotTS)
+	changed := h.deltas(rows, keyframe)
+	borders, towns := h.crossings(rows)
+
+	// A spooled tick counts as written: it is replayed before anything
+	// queued after it, so the deltas that follow still apply.
+	batch := activityBatch{Run: run.runRef, Keyframe: keyframe, Rows: changed, Borders: borders}
+	spooled, err := h.spool.Write(snapshotTS, batch, func() error {
+		return h.insertActivity(ctx, snapshotTS, batch)
+	})
+	run.step("online", runStep{Fetched: len(rows), Inserted: len(changed), Spooled: spooled}, start, err)
+	if err != nil {
+		h.log.Error("high-freq: insert activity failed", "error", err)
+		h.discardWrite()
+		return fmt.Errorf("insert activity: %w", err)
+	}
+	h.commitState(snapshotTS, rows, keyframe)
+	if towns != nil {
+		h.lastTown = towns
+	}
+
+	if len(rows) == 0 {
+		h.log.Debug("high-freq: no online players")
+		return nil
 	}
 
 	// Upsert dimension table
 	if err := h.upsertPlayers(ctx, snapshotTS, rows); err != nil {
-		slog.Error("high-freq: upsert players failed", "error", err)
+		h.log.Error("high-freq: upsert players failed", "error", err)
 	}
 
-	slog.Info("high-freq tick complete",
+	h.log.Info("high-freq tick complete",
 		"online", onlineResp.Count,
 		"visible", len(visibleMap),
-		"inserted", len(rows),
+		"inserted", len(changed),
+		"keyframe", keyframe,
+		"border_events", len(borders),
+		"spooled", spooled,
 		"duration", time.Since(start).Round(time.Millisecond),
 	)
+	return nil
 }
 
-func (h *HighFreq) insertActivity(ctx context.Context, ts time.Time, rows []activityRow) error {
-	// Build multi-value INSERT for maximum throughput
-	var sb strings.Builder
-	sb.WriteString("INSERT INTO player_activity (snapshot_ts, player_uuid, player_name, is_online, is_visible, x, y, z, yaw, world) VALUES ")
+// locate stamps a visible row with the town and nation it stands in.
+func (h *HighFreq) locate(r *activityRow) {
+	t, ok := h.claims.lookup(*r.World, *r.X, *r.Z)
+	if !ok {
+		return
+	}
+	r.IsWilderness = ptr(t == nil)
+	if t != nil {
+		r.InTownUUID, r.InNationUUID, r.town = &t.uuid, t.nation, t
+	}
+}
 
-	args := make([]interface{}, 0, len(rows)*10)
-	for i, r := range rows {
-		if i > 0 {
-			sb.WriteString(",")
+// activityState is the part of a player's activity that delta writes
+// compare; yaw alone changing does not produce a row.
+type activityState struct {
+	name    string // carried for the row written when they leave
+	visible bool
+	x, y, z int
+	world   string
+}
+
+func (s activityState) sameAs(o activityState) bool {
+	return s.visible == o.visible && s.x == o.x && s.y == o.y && s.z == o.z && s.world == o.world
+}
+
+func stateOf(r activityRow) activityState {
+	st := activityState{name: r.PlayerName, visible: r.IsVisible}
+	if r.X != nil {
+		st.x, st.y, st.z = *r.X, *r.Y, *r.Z
+	}
+	if r.World != nil {
+		st.world = *r.World
+	}
+	return st
+}
+
+// needsKeyframe reports whether this tick must write every online player:
+// when nothing has been written yet, every keyframe interval, and on the
+// first tick of each hour so every partition is self-contained.
+func (h *HighFreq) needsKeyframe(ts time.Time) bool {
+	return h.lastState == nil ||
+		ts.Sub(h.lastKeyframe) >= h.keyframeEvery ||
+		!ts.Truncate(time.Hour).Equal(h.lastKeyframe.Truncate(time.Hour))
+}
+
+// deltas returns the rows to write: online players whose state changed (all
+// of them on a keyframe), plus an is_online = false row for each player who
+// was online at the last tick but is gone now.
+func (h *HighFreq) deltas(rows []activityRow, keyframe bool) []activityRow {
+	out := make([]activityRow, 0, len(rows))
+	online := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		online[r.PlayerUUID] = true
+		prev, ok := h.lastState[r.PlayerUUID]
+		if keyframe || !ok || !prev.sameAs(stateOf(r)) {
+			out = append(out, r)
 		}
-		base := i * 10
-		sb.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)",
-			base+1, base+2, base+3, base+4, base+5, base+6, base+7, base+8, base+9, base+10))
-		args = append(args, ts, r.PlayerUUID, r.PlayerName, r.IsOnline, r.IsVisible, r.X, r.Y, r.Z, r.Yaw, r.World)
 	}
+	for uuid, prev := range h.lastState {
+		if !online[uuid] {
+			out = append(out, activityRow{PlayerUUID: uuid, PlayerName: prev.name})
+		}
+	}
+	return out
+}
 
-	_, err := h.pool.Exec(ctx, sb.String(), args...)
-	return err
+// commitState records what the database now holds after a successful write.
+func (h *HighFreq) commitState(ts time.Time, rows []activityRow, keyframe bool) {
+	state := make(map[string]activityState, len(rows))
+	for _, r := range rows {
+		state[r.PlayerUUID] = stateOf(r)
+	}
+	h.lastState = state
+	if keyframe {
+		h.lastKeyframe = ts
+	}
 }
 
-func (h *HighFreq) upsertPlayers(ctx context.Context, ts time.Time, rows []activityRow) error {
-	var sb strings.Builder
-	sb.WriteString("INSERT INTO players (uuid, name, first_seen, last_seen) VALUES ")
+// discardWrite is called when a tick's write failed and it is unknown what
+// landed. The next tick writes everyone online as a keyframe; the last state
+// is kept so players who left since still get their is_online = false rows.
+func (h *HighFreq) discardWrite() {
+	h.lastKeyframe = time.Time{}
+}
 
-	args := make([]interface{}, 0, len(rows)*4)
-	for i, r := range rows {
-		if i > 0 {
-			sb.WriteString(",")
+var activityColumns = []string{
+	"server_id", "snapshot_ts", "player_uuid", "player_name", "is_online", "is_visible",
+	"x", "y", "z", "yaw", "world", "is_keyframe",
+	"in_town_uuid", "in_nation_uuid", "is_wilderness",
+}
+
+// activityBatch is one tick's insertActivity, as spooled.
+type activityBatch struct {
+	Run      runRef        `json:"run"`
+	Keyframe bool          `json:"keyframe"`
+	Rows     []activityRow `json:"rows"`
+	Borders  []borderEvent `json:"borders,omitempty"`
+}
+
+// insertActivity writes the changed rows and records the tick in one
+// transaction, so player_activity_dense never sees half a tick.
+func (h *HighFreq) insertActivity(ctx context.Context, ts time.Time, b activityBatch) error {
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := h.writeActivity(ctx, tx, ts, b); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// replayActivity writes a spooled tick. Its hour may have been rolled up
+// without it, so the rollup is marked stale in the same transaction and
+// redone by the next retention pass.
+func (h *HighFreq) replayActivity(ctx context.Context, rec spool.Record) error {
+	var b activityBatch
+	if err := json.Unmarshal(rec.Data, &b); err != nil {
+		return spool.Reject(err)
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := h.writeActivity(ctx, tx, rec.TS, b); err != nil {
+		return replayErr(err)
+	}
+	if _, err := tx.Exec(ctx,
+		"DELETE FROM activity_rollups WHERE hour = DATE_TRUNC('hour', $1::timestamptz)", rec.TS); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (h *HighFreq) writeActivity(ctx context.Context, tx pgx.Tx, ts time.Time, b activityBatch) error {
+	if err := b.Run.ensure(ctx, tx, h.server, ts); err != nil {
+		return fmt.Errorf("record run: %w", err)
+	}
+
+	copied := make([][]any, len(b.Rows))
+	for i, r := range b.Rows {
+		copied[i] = []any{
+			h.server, ts, r.PlayerUUID, r.PlayerName, r.IsOnline, r.IsVisible, r.X, r.Y, r.Z, r.Yaw, r.World, b.Keyframe,
+			r.InTownUUID, r.InNationUUID, r.IsWilderness,
 		}
-		base := i * 4
-		sb.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d)",
-			base+1, base+2, base+3, base+4))
-		args = append(args, r.PlayerUUID, r.PlayerName, ts, ts)
+	}
+	if _, err := db.CopyRows(ctx, tx, "player_activity", activityColumns, copied); err != nil {
+		return err
 	}
 
-	sb.WriteString(" ON CONFLICT (uuid) DO UPDATE SET name = EXCLUDED.name, last_seen = EXCLUDED.last_seen")
+	if _, err := tx.Exec(ctx,
+		"INSERT INTO activity_ticks (server_id, snapshot_ts, is_keyframe, run_id) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING",
+		h.server, ts, b.Keyframe, b.Run.ID); err != nil {
+		return fmt.Errorf("record tick: %w", err)
+	}
+	if err := h.writeBorders(ctx, tx, ts, b); err != nil {
+		return fmt.Errorf("write border events: %w", err)
+	}
+	return nil
+}
 
-	_, err := h.pool.Exec(ctx, sb.String(), args...)
+func (h *HighFreq) upsertPlayers(ctx context.Context, ts time.Time, rows []activityRow) error {
+	players := make([][]any, len(rows))
+	for i, r := range rows {
+		players[i] = []any{h.server, r.PlayerUUID, r.PlayerName, ts, ts}
+	}
+	_, err := dimensionMerge("players").Run(ctx, h.pool, players, nil)
 	return err
 }
 
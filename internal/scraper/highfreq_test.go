@@ -0,0 +1,162 @@
+package scraper
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// visibleAt is a visible player standing at block (x, z) in the overworld.
+func visibleAt(uuid, name string, x, z int) activityRow {
+	return activityRow{
+		PlayerUUID: uuid, PlayerName: name, IsOnline: true, IsVisible: true,
+		X: ptr(x), Y: ptr(64), Z: ptr(z), World: ptr("minecraft_overworld"),
+	}
+}
+
+func TestNeedsKeyframe(t *testing.T) {
+	last := time.Date(2026, 3, 1, 12, 10, 0, 0, time.UTC)
+	state := map[string]activityState{}
+
+	tests := []struct {
+		name  string
+		state map[string]activityState
+		ts    time.Time
+		want  bool
+	}{
+		{"nothing written yet", nil, last.Add(time.Minute), true},
+		{"within the interval", state, last.Add(4 * time.Minute), false},
+		{"interval elapsed", state, last.Add(5 * time.Minute), true},
+		{"first tick of a new hour", state, time.Date(2026, 3, 1, 13, 0, 30, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &HighFreq{keyframeEvery: 5 * time.Minute, lastKeyframe: last, lastState: tt.state}
+			if got := h.needsKeyframe(tt.ts); got != tt.want {
+				t.Errorf("needsKeyframe(%v) = %v, want %v", tt.ts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeltas(t *testing.T) {
+	moved := visibleAt("p1", "Fix", 10, 0)
+	turned := visibleAt("p1", "Fix", 8, 0)
+	turned.Yaw = ptr(90)
+	hidden := activityRow{PlayerUUID: "p1", PlayerName: "Fix", IsOnline: true}
+	state := map[string]activityState{
+		"p1": stateOf(visibleAt("p1", "Fix", 8, 0)),
+		"p2": stateOf(visibleAt("p2", "Owen3H", 0, 0)),
+	}
+
+	tests := []struct {
+		name     string
+		state    map[string]activityState
+		rows     []activityRow
+		keyframe bool
+		// "uuid" for a written row, "uuid offline" for a departure
+		want []string
+	}{
+		{
+			name:     "keyframe writes every player",
+			state:    state,
+			rows:     []activityRow{turned, visibleAt("p2", "Owen3H", 0, 0)},
+			keyframe: true,
+			want:     []string{"p1", "p2"},
+		},
+		{
+			name:  "unchanged players are skipped",
+			state: state,
+			rows:  []activityRow{visibleAt("p1", "Fix", 8, 0), visibleAt("p2", "Owen3H", 0, 0)},
+		},
+		{
+			name:  "yaw alone is not a change",
+			state: state,
+			rows:  []activityRow{turned, visibleAt("p2", "Owen3H", 0, 0)},
+		},
+		{
+			name:  "moved",
+			state: state,
+			rows:  []activityRow{moved, visibleAt("p2", "Owen3H", 0, 0)},
+			want:  []string{"p1"},
+		},
+		{
+			name:  "went hidden",
+			state: state,
+			rows:  []activityRow{hidden, visibleAt("p2", "Owen3H", 0, 0)},
+			want:  []string{"p1"},
+		},
+		{
+			name:  "new player",
+			state: state,
+			rows:  []activityRow{visibleAt("p1", "Fix", 8, 0), visibleAt("p2", "Owen3H", 0, 0), visibleAt("p3", "Kuroi", 1, 1)},
+			want:  []string{"p3"},
+		},
+		{
+			name:  "logged off",
+			state: state,
+			rows:  []activityRow{visibleAt("p1", "Fix", 8, 0)},
+			want:  []string{"p2 offline Owen3H"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &HighFreq{lastState: tt.state}
+			var got []string
+			for _, r := range h.deltas(tt.rows, tt.keyframe) {
+				if r.IsOnline {
+					got = append(got, r.PlayerUUID)
+				} else {
+					got = append(got, r.PlayerUUID+" offline "+r.PlayerName)
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("deltas = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommitState(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	h := &HighFreq{keyframeEvery: 5 * time.Minute}
+	rows := []activityRow{visibleAt("p1", "Fix", 8, 0)}
+
+	h.commitState(ts, rows, true)
+	if !h.lastKeyframe.Equal(ts) || len(h.lastState) != 1 {
+		t.Fatalf("after a keyframe: lastKeyframe %v, state %v", h.lastKeyframe, h.lastState)
+	}
+	if h.needsKeyframe(ts.Add(time.Minute)) {
+		t.Error("keyframe needed a minute after one was written")
+	}
+
+	h.commitState(ts.Add(time.Minute), nil, false)
+	if !h.lastKeyframe.Equal(ts) || len(h.lastState) != 0 {
+		t.Errorf("after a delta: lastKeyframe %v, state %v", h.lastKeyframe, h.lastState)
+	}
+}
+
+func TestDiscardWrite(t *testing.T) {
+	ts := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	h := &HighFreq{keyframeEvery: 5 * time.Minute}
+	h.commitState(ts, []activityRow{visibleAt("p1", "Fix", 8, 0), visibleAt("p2", "Owen3H", 0, 0)}, true)
+
+	// Owen3H leaves during a tick whose write fails.
+	h.discardWrite()
+
+	next := ts.Add(2 * time.Minute)
+	if !h.needsKeyframe(next) {
+		t.Fatal("no keyframe after a failed write")
+	}
+	var got []string
+	for _, r := range h.deltas([]activityRow{visibleAt("p1", "Fix", 8, 0)}, true) {
+		got = append(got, fmt.Sprintf("%s online=%v", r.PlayerUUID, r.IsOnline))
+	}
+	sort.Strings(got)
+	if want := []string{"p1 online=true", "p2 online=false"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rows after a failed write = %q, want %q", got, want)
+	}
+}
@@ -3,9 +3,9 @@ package scraper
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"strings"
 	"sync"
 	"time"
 
@@ -13,38 +13,97 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/0Mattias/earthmc-scraper/internal/api"
+	"github.com/0Mattias/earthmc-scraper/internal/db"
+	"github.com/0Mattias/earthmc-scraper/internal/spool"
 )
 
 // LowFreq scrapes full server/player/town/nation data every interval.
 type LowFreq struct {
+	server   string
 	client   *api.Client
 	pool     *pgxpool.Pool
 	interval time.Duration
 	running  sync.Mutex
+	log      *slog.Logger
+
+	// Latest content hash per entity, keyed by snapshot kind
+	hashes map[string]*hashCache
+
+	// Snapshot writes the database could not take, one ordered queue per
+	// kind ("server", "town", "nation", "player", "quarter")
+	spools map[string]*spool.Queue
+	// scrape_runs entries the database could not take
+	runs *spool.Queue
+
+	// Rebuilt from every town and nation scrape for the high-freq loop
+	claims *ClaimIndex
 }
 
-// NewLowFreq creates a new low-frequency scraper.
-func NewLowFreq(client *api.Client, pool *pgxpool.Pool, interval time.Duration) *LowFreq {
-	return &LowFreq{
+// LowFreqOptions tunes a LowFreq scraper.
+type LowFreqOptions struct {
+	// Interval between ticks
+	Interval time.Duration
+	// Spool holds failed snapshot writes for replay; nil disables it
+	Spool *spool.Spool
+	// Claims is rebuilt after each town and nation scrape; nil disables it
+	Claims *ClaimIndex
+}
+
+// NewLowFreq creates a new low-frequency scraper for the named EarthMC server.
+func NewLowFreq(server string, client *api.Client, pool *pgxpool.Pool, opts LowFreqOptions) *LowFreq {
+	l := &LowFreq{
+		server:   server,
 		client:   client,
 		pool:     pool,
-		interval: interval,
-	}
+		interval: opts.Interval,
+		log:      slog.With("server", server),
+		hashes: map[string]*hashCache{
+			townSnapshots.kind:   newHashCache(),
+			nationSnapshots.kind: newHashCache(),
+			playerSnapshots.kind: newHashCache(),
+		},
+		spools: make(map[string]*spool.Queue),
+		runs:   opts.Spool.Queue(server + "/runs-" + loopLow),
+		claims: opts.Claims,
+	}
+	for _, kind := range []string{"server", townSnapshots.kind, nationSnapshots.kind, playerSnapshots.kind, "quarter"} {
+		l.spools[kind] = opts.Spool.Queue(server + "/" + kind)
+	}
+	return l
 }
 
 // Run starts the low-frequency scrape loop. Blocks until context is cancelled.
 func (l *LowFreq) Run(ctx context.Context) {
-	slog.Info("low-freq scraper started", "interval", l.interval)
+	l.log.Info("low-freq scraper started", "interval", l.interval)
 	ticker := time.NewTicker(l.interval)
 	defer ticker.Stop()
 
+	if l.spools["server"] != nil {
+		go replaySpool(ctx, l.log, []replayer{
+			{l.spools["server"], l.replayServer},
+			{l.spools[townSnapshots.kind], l.replaySnapshots(townSnapshots)},
+			{l.spools[nationSnapshots.kind], l.replaySnapshots(nationSnapshots)},
+			{l.spools[playerSnapshots.kind], l.replaySnapshots(playerSnapshots)},
+			{l.spools["quarter"], l.replayQuarters},
+			{l.runs, replayRun(l.pool, l.server)},
+		})
+	}
+
+	// Let the high-freq loop locate players while the first town scrape
+	// is still running.
+	if n, err := l.claims.seed(ctx, l.pool, l.server); err != nil {
+		l.log.Warn("low-freq: loading claim index failed", "error", err)
+	} else if n > 0 {
+		l.log.Info("claim index loaded from snapshots", "towns", n)
+	}
+
 	// Run immediately on start
 	l.tick(ctx)
 
 	for {
 		select {
 		case <-ctx.Done():
-			slog.Info("low-freq scraper stopped")
+			l.log.Info("low-freq scraper stopped")
 			return
 		case <-ticker.C:
 			l.tick(ctx)
@@ -52,96 +111,202 @@ func (l *LowFreq) Run(ctx context.Context) {
 	}
 }
 
+// LowFreqSteps names the scrapes a low-freq tick runs.
+var LowFreqSteps = []string{"server", "towns", "nations", "players", "quarters"}
+
+// lowFreqStep scrapes and stores one kind of data for run, and reports
+// what it fetched and wrote.
+type lowFreqStep func(ctx context.Context, run *scrapeRun) (runStep, error)
+
+func (l *LowFreq) step(name string) lowFreqStep {
+	switch name {
+	case "server":
+		return l.scrapeServer
+	case "towns":
+		return l.scrapeTowns
+	case "nations":
+		return l.scrapeNations
+	case "players":
+		return l.scrapePlayers
+	case "quarters":
+		return l.scrapeQuarters
+	}
+	return nil
+}
+
 func (l *LowFreq) tick(ctx context.Context) {
 	if !l.running.TryLock() {
-		slog.Warn("low-freq tick skipped: previous still running")
+		l.log.Warn("low-freq tick skipped: previous still running")
+		rec := skippedRun(loopLow)
+		if err := recordRun(ctx, l.pool, l.runs, l.server, rec.StartedAt, rec); err != nil {
+			l.log.Error("low-freq: record run failed", "error", err)
+		}
 		return
 	}
 	defer l.running.Unlock()
 
 	start := time.Now()
-	snapshotTS := start
+	_ = l.scrape(ctx, start, LowFreqSteps)
 
-	// Run all entity scrapes concurrently with error isolation
-	g, gCtx := errgroup.WithContext(ctx)
+	l.log.Info("low-freq tick complete",
+		"duration", time.Since(start).Round(time.Millisecond),
+	)
+}
 
-	// 1. Server status
-	g.Go(func() error {
-		if err := l.scrapeServer(gCtx, snapshotTS); err != nil {
-			slog.Error("low-freq: server scrape failed", "error", err)
-			// Don't propagate — isolate failures
+// ScrapeOnce runs the named low-freq steps (all of them if none are given)
+// a single time, outside the loop, and returns their joined errors.
+func (l *LowFreq) ScrapeOnce(ctx context.Context, only ...string) error {
+	if len(only) == 0 {
+		only = LowFreqSteps
+	}
+	for _, name := range only {
+		if l.step(name) == nil {
+			return fmt.Errorf("unknown low-freq step %q", name)
 		}
-		return nil
-	})
+	}
 
-	// 2. Towns
-	g.Go(func() error {
-		if err := l.scrapeTowns(gCtx, snapshotTS); err != nil {
-			slog.Error("low-freq: towns scrape failed", "error", err)
-		}
-		return nil
-	})
+	l.running.Lock()
+	defer l.running.Unlock()
+	return l.scrape(ctx, time.Now(), only)
+}
 
-	// 3. Nations
-	g.Go(func() error {
-		if err := l.scrapeNations(gCtx, snapshotTS); err != nil {
-			slog.Error("low-freq: nations scrape failed", "error", err)
-		}
-		return nil
-	})
+// scrape runs the named steps concurrently with error isolation: a failing
+// step is logged and does not cancel the others. The tick is recorded in
+// scrape_runs once every step is done.
+func (l *LowFreq) scrape(ctx context.Context, ts time.Time, steps []string) error {
+	run := newRun(loopLow, ts)
+	g, gCtx := errgroup.WithContext(run.ctx(ctx))
+	errs := make([]error, len(steps))
+	for i, name := range steps {
+		step := l.step(name)
+		g.Go(func() error {
+			start := time.Now()
+			s, err := step(gCtx, run)
+			run.step(name, s, start, err)
+			if err != nil {
+				l.log.Error("low-freq: "+name+" scrape failed", "error", err)
+				errs[i] = fmt.Errorf("%s: %w", name, err)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
 
-	// 4. Players
-	g.Go(func() error {
-		if err := l.scrapePlayers(gCtx, snapshotTS); err != nil {
-			slog.Error("low-freq: players scrape failed", "error", err)
+	if err := recordRun(ctx, l.pool, l.runs, l.server, ts, run.finish()); err != nil {
+		l.log.Error("low-freq: record run failed", "error", err)
+	}
+	return errors.Join(errs...)
+}
+
+// fetchDetails runs a batched POST and keeps whatever succeeded. Failed
+// batches are logged and picked up again on the next tick; an error is only
+// returned if nothing could be fetched.
+func (l *LowFreq) fetchDetails(
+	ctx context.Context,
+	kind string,
+	post func(context.Context, []string) (*api.BatchResult, error),
+	uuids []string,
+) ([]json.RawMessage, error) {
+	res, err := post(ctx, uuids)
+	if err != nil {
+		return nil, err
+	}
+	if batchErr := res.Err(); batchErr != nil {
+		if len(res.Results) == 0 {
+			return nil, batchErr
 		}
-		return nil
-	})
+		l.log.Warn("low-freq: some batches failed, keeping partial results",
+			"kind", kind,
+			"fetched", len(res.Results),
+			"failed_batches", len(res.Failed),
+			"failed_uuids", len(res.FailedUUIDs()),
+			"error", batchErr,
+		)
+	}
+	return res.Results, nil
+}
 
-	_ = g.Wait()
+// ---- Server ----
 
-	slog.Info("low-freq tick complete",
-		"duration", time.Since(start).Round(time.Millisecond),
-	)
+func (l *LowFreq) scrapeServer(ctx context.Context, run *scrapeRun) (runStep, error) {
+	ts := run.ts
+	raw, err := l.client.GetServerRaw(ctx)
+	if err != nil {
+		return runStep{}, fmt.Errorf("get server: %w", err)
+	}
+	l.checkDrift(ctx, ts, "server", []json.RawMessage{raw}, api.ServerResponse{})
+
+	var srv api.ServerResponse
+	if err := json.Unmarshal(raw, &srv); err != nil {
+		return runStep{Fetched: 1}, fmt.Errorf("decode server: %w", err)
+	}
+
+	spooled, err := l.spools["server"].Write(ts, serverRecord{Run: run.runRef, Server: raw}, func() error {
+		return l.insertServerSnapshot(ctx, ts, run.runRef, srv)
+	})
+	if err != nil {
+		return runStep{Fetched: 1}, fmt.Errorf("insert server snapshot: %w", err)
+	}
+
+	l.log.Info("server snapshot saved", "online", srv.Stats.NumOnlinePlayers, "towns", srv.Stats.NumTowns, "nations", srv.Stats.NumNations, "spooled", spooled)
+	return runStep{Fetched: 1, Inserted: 1, Spooled: spooled}, nil
 }
 
-// ---- Server ----
+// serverRecord is a spooled server snapshot.
+type serverRecord struct {
+	Run    runRef          `json:"run"`
+	Server json.RawMessage `json:"server"`
+}
 
-func (l *LowFreq) scrapeServer(ctx context.Context, ts time.Time) error {
-	srv, err := l.client.GetServer(ctx)
+func (l *LowFreq) insertServerSnapshot(ctx context.Context, ts time.Time, run runRef, srv api.ServerResponse) error {
+	tx, err := l.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("get server: %w", err)
+		return err
 	}
+	defer tx.Rollback(ctx)
 
-	_, err = l.pool.Exec(ctx, `
+	if err := run.ensure(ctx, tx, l.server, ts); err != nil {
+		return fmt.Errorf("record run: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
 		INSERT INTO server_snapshots (
-			snapshot_ts, version, moon_phase, has_storm, is_thundering,
+			server_id, snapshot_ts, version, moon_phase, has_storm, is_thundering,
 			server_time, full_time, max_players, num_online_players, num_online_nomads,
 			num_residents, num_nomads, num_towns, num_town_blocks, num_nations,
-			num_quarters, num_cuboids, vote_party_target, vote_party_remaining
-		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19)`,
-		ts, srv.Version, srv.MoonPhase, srv.Status.HasStorm, srv.Status.IsThundering,
+			num_quarters, num_cuboids, vote_party_target, vote_party_remaining, run_id
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21)`,
+		l.server, ts, srv.Version, srv.MoonPhase, srv.Status.HasStorm, srv.Status.IsThundering,
 		srv.Stats.Time, srv.Stats.FullTime, srv.Stats.MaxPlayers, srv.Stats.NumOnlinePlayers, srv.Stats.NumOnlineNomads,
 		srv.Stats.NumResidents, srv.Stats.NumNomads, srv.Stats.NumTowns, srv.Stats.NumTownBlocks, srv.Stats.NumNations,
-		srv.Stats.NumQuarters, srv.Stats.NumCuboids, srv.VoteParty.Target, srv.VoteParty.NumRemaining,
-	)
-	if err != nil {
-		return fmt.Errorf("insert server snapshot: %w", err)
+		srv.Stats.NumQuarters, srv.Stats.NumCuboids, srv.VoteParty.Target, srv.VoteParty.NumRemaining, run.ID,
+	); err != nil {
+		return err
 	}
+	return tx.Commit(ctx)
+}
 
-	slog.Info("server snapshot saved", "online", srv.Stats.NumOnlinePlayers, "towns", srv.Stats.NumTowns, "nations", srv.Stats.NumNations)
-	return nil
+func (l *LowFreq) replayServer(ctx context.Context, rec spool.Record) error {
+	var r serverRecord
+	if err := json.Unmarshal(rec.Data, &r); err != nil {
+		return spool.Reject(err)
+	}
+	var srv api.ServerResponse
+	if err := json.Unmarshal(r.Server, &srv); err != nil {
+		return spool.Reject(err)
+	}
+	return replayErr(l.insertServerSnapshot(ctx, rec.TS, r.Run, srv))
 }
 
 // ---- Towns ----
 
-func (l *LowFreq) scrapeTowns(ctx context.Context, ts time.Time) error {
+func (l *LowFreq) scrapeTowns(ctx context.Context, run *scrapeRun) (runStep, error) {
+	ts := run.ts
 	// Step 1: Get town list
 	townList, err := l.client.GetTownsList(ctx)
 	if err != nil {
-		return fmt.Errorf("get towns list: %w", err)
+		return runStep{}, fmt.Errorf("get towns list: %w", err)
 	}
-	slog.Info("fetched town list", "count", len(townList))
+	l.log.Info("fetched town list", "count", len(townList))
 
 	// Step 2: Fetch full details via POST
 	uuids := make([]string, len(townList))
@@ -149,349 +314,266 @@ func (l *LowFreq) scrapeTowns(ctx context.Context, ts time.Time) error {
 		uuids[i] = t.UUID
 	}
 
-	details, err := l.client.PostTowns(ctx, uuids)
+	details, err := l.fetchDetails(ctx, "towns", l.client.PostTowns, uuids)
 	if err != nil {
-		return fmt.Errorf("post towns: %w", err)
+		return runStep{}, fmt.Errorf("post towns: %w", err)
 	}
-	slog.Info("fetched town details", "count", len(details))
+	l.log.Info("fetched town details", "count", len(details))
+	l.checkDrift(ctx, ts, "town", details, api.TownDetail{})
+	l.updateClaims(details, uuids)
 
 	// Step 3: Insert snapshots and upsert dimensions
-	if err := l.insertTownSnapshots(ctx, ts, details); err != nil {
-		return fmt.Errorf("insert town snapshots: %w", err)
+	step, err := l.writeSnapshots(ctx, run, townSnapshots, details, uuids)
+	if err != nil {
+		return step, fmt.Errorf("insert town snapshots: %w", err)
 	}
 
-	if err := l.upsertTowns(ctx, ts, details); err != nil {
-		return fmt.Errorf("upsert towns: %w", err)
+	if err := l.upsertDimension(ctx, ts, "towns", details); err != nil {
+		return step, fmt.Errorf("upsert towns: %w", err)
 	}
 
-	return nil
+	return step, nil
 }
 
-func (l *LowFreq) insertTownSnapshots(ctx context.Context, ts time.Time, details []json.RawMessage) error {
-	if len(details) == 0 {
-		return nil
+// updateClaims rebuilds the claim index from the fetched towns.
+func (l *LowFreq) updateClaims(details []json.RawMessage, listed []string) {
+	if l.claims == nil {
+		return
 	}
-
-	// Batch insert in chunks to avoid exceeding query param limits
-	const chunkSize = 500
-	for i := 0; i < len(details); i += chunkSize {
-		end := i + chunkSize
-		if end > len(details) {
-			end = len(details)
-		}
-		chunk := details[i:end]
-
-		var sb strings.Builder
-		sb.WriteString("INSERT INTO town_snapshots (snapshot_ts, town_uuid, town_name, data) VALUES ")
-
-		args := make([]interface{}, 0, len(chunk)*4)
-		for j, raw := range chunk {
-			name, uuid, err := extractNameUUID(raw)
-			if err != nil {
-				slog.Warn("skip town: parse error", "error", err)
-				continue
-			}
-			if j > 0 {
-				sb.WriteString(",")
-			}
-			base := j * 4
-			sb.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d)", base+1, base+2, base+3, base+4))
-			args = append(args, ts, uuid, name, raw)
-		}
-
-		if len(args) == 0 {
+	towns := make([]api.TownDetail, 0, len(details))
+	for _, raw := range details {
+		var t api.TownDetail
+		if err := json.Unmarshal(raw, &t); err != nil {
 			continue
 		}
-
-		if _, err := l.pool.Exec(ctx, sb.String(), args...); err != nil {
-			return fmt.Errorf("batch insert towns %d-%d: %w", i, end, err)
-		}
+		towns = append(towns, t)
 	}
-	return nil
+	l.claims.update(towns, listed)
 }
 
-func (l *LowFreq) upsertTowns(ctx context.Context, ts time.Time, details []json.RawMessage) error {
-	if len(details) == 0 {
-		return nil
+// updateRelations refreshes the nation allies and enemies in the claim index.
+func (l *LowFreq) updateRelations(details []json.RawMessage, listed []string) {
+	if l.claims == nil {
+		return
 	}
-
-	const chunkSize = 500
-	for i := 0; i < len(details); i += chunkSize {
-		end := i + chunkSize
-		if end > len(details) {
-			end = len(details)
-		}
-		chunk := details[i:end]
-
-		var sb strings.Builder
-		sb.WriteString("INSERT INTO towns (uuid, name, first_seen, last_seen) VALUES ")
-
-		args := make([]interface{}, 0, len(chunk)*4)
-		count := 0
-		for _, raw := range chunk {
-			name, uuid, err := extractNameUUID(raw)
-			if err != nil {
-				continue
-			}
-			if count > 0 {
-				sb.WriteString(",")
-			}
-			base := count * 4
-			sb.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d)", base+1, base+2, base+3, base+4))
-			args = append(args, uuid, name, ts, ts)
-			count++
-		}
-
-		if count == 0 {
+	nations := make([]api.NationDetail, 0, len(details))
+	for _, raw := range details {
+		var n api.NationDetail
+		if err := json.Unmarshal(raw, &n); err != nil {
 			continue
 		}
-
-		sb.WriteString(" ON CONFLICT (uuid) DO UPDATE SET name = EXCLUDED.name, last_seen = EXCLUDED.last_seen")
-
-		if _, err := l.pool.Exec(ctx, sb.String(), args...); err != nil {
-			return fmt.Errorf("upsert towns %d-%d: %w", i, end, err)
-		}
+		nations = append(nations, n)
 	}
-	return nil
+	l.claims.updateNations(nations, listed)
 }
 
 // ---- Nations ----
 
-func (l *LowFreq) scrapeNations(ctx context.Context, ts time.Time) error {
+func (l *LowFreq) scrapeNations(ctx context.Context, run *scrapeRun) (runStep, error) {
+	ts := run.ts
 	nationList, err := l.client.GetNationsList(ctx)
 	if err != nil {
-		return fmt.Errorf("get nations list: %w", err)
+		return runStep{}, fmt.Errorf("get nations list: %w", err)
 	}
-	slog.Info("fetched nation list", "count", len(nationList))
+	l.log.Info("fetched nation list", "count", len(nationList))
 
 	uuids := make([]string, len(nationList))
 	for i, n := range nationList {
 		uuids[i] = n.UUID
 	}
 
-	details, err := l.client.PostNations(ctx, uuids)
+	details, err := l.fetchDetails(ctx, "nations", l.client.PostNations, uuids)
 	if err != nil {
-		return fmt.Errorf("post nations: %w", err)
+		return runStep{}, fmt.Errorf("post nations: %w", err)
 	}
-	slog.Info("fetched nation details", "count", len(details))
+	l.log.Info("fetched nation details", "count", len(details))
+	l.checkDrift(ctx, ts, "nation", details, api.NationDetail{})
+	l.updateRelations(details, uuids)
 
-	if err := l.insertNationSnapshots(ctx, ts, details); err != nil {
-		return fmt.Errorf("insert nation snapshots: %w", err)
+	step, err := l.writeSnapshots(ctx, run, nationSnapshots, details, nil)
+	if err != nil {
+		return step, fmt.Errorf("insert nation snapshots: %w", err)
 	}
 
-	if err := l.upsertNations(ctx, ts, details); err != nil {
-		return fmt.Errorf("upsert nations: %w", err)
+	if err := l.upsertDimension(ctx, ts, "nations", details); err != nil {
+		return step, fmt.Errorf("upsert nations: %w", err)
 	}
 
-	return nil
+	return step, nil
 }
 
-func (l *LowFreq) insertNationSnapshots(ctx context.Context, ts time.Time, details []json.RawMessage) error {
-	if len(details) == 0 {
-		return nil
-	}
-
-	const chunkSize = 500
-	for i := 0; i < len(details); i += chunkSize {
-		end := i + chunkSize
-		if end > len(details) {
-			end = len(details)
-		}
-		chunk := details[i:end]
+// ---- Players (full profile) ----
 
-		var sb strings.Builder
-		sb.WriteString("INSERT INTO nation_snapshots (snapshot_ts, nation_uuid, nation_name, data) VALUES ")
+func (l *LowFreq) scrapePlayers(ctx context.Context, run *scrapeRun) (runStep, error) {
+	ts := run.ts
+	playerList, err := l.client.GetPlayersList(ctx)
+	if err != nil {
+		return runStep{}, fmt.Errorf("get players list: %w", err)
+	}
+	l.log.Info("fetched player list", "count", len(playerList))
 
-		args := make([]interface{}, 0, len(chunk)*4)
-		count := 0
-		for _, raw := range chunk {
-			name, uuid, err := extractNameUUID(raw)
-			if err != nil {
-				slog.Warn("skip nation: parse error", "error", err)
-				continue
-			}
-			if count > 0 {
-				sb.WriteString(",")
-			}
-			base := count * 4
-			sb.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d)", base+1, base+2, base+3, base+4))
-			args = append(args, ts, uuid, name, raw)
-			count++
-		}
+	uuids := make([]string, len(playerList))
+	for i, p := range playerList {
+		uuids[i] = p.UUID
+	}
 
-		if count == 0 {
-			continue
-		}
+	details, err := l.fetchDetails(ctx, "players", l.client.PostPlayers, uuids)
+	if err != nil {
+		return runStep{}, fmt.Errorf("post players: %w", err)
+	}
+	l.log.Info("fetched player details", "count", len(details))
+	l.checkDrift(ctx, ts, "player", details, api.PlayerDetail{})
 
-		if _, err := l.pool.Exec(ctx, sb.String(), args...); err != nil {
-			return fmt.Errorf("batch insert nations %d-%d: %w", i, end, err)
-		}
+	step, err := l.writeSnapshots(ctx, run, playerSnapshots, details, nil)
+	if err != nil {
+		return step, fmt.Errorf("insert player snapshots: %w", err)
 	}
-	return nil
-}
 
-func (l *LowFreq) upsertNations(ctx context.Context, ts time.Time, details []json.RawMessage) error {
-	if len(details) == 0 {
-		return nil
+	// Also upsert the players dimension table
+	if err := l.upsertDimension(ctx, ts, "players", details); err != nil {
+		return step, fmt.Errorf("upsert players: %w", err)
 	}
 
-	const chunkSize = 500
-	for i := 0; i < len(details); i += chunkSize {
-		end := i + chunkSize
-		if end > len(details) {
-			end = len(details)
-		}
-		chunk := details[i:end]
+	// The dimension only keeps the latest name; remember every one.
+	if err := l.upsertNameHistory(ctx, ts, details); err != nil {
+		return step, fmt.Errorf("upsert player name history: %w", err)
+	}
 
-		var sb strings.Builder
-		sb.WriteString("INSERT INTO nations (uuid, name, first_seen, last_seen) VALUES ")
+	return step, nil
+}
 
-		args := make([]interface{}, 0, len(chunk)*4)
-		count := 0
-		for _, raw := range chunk {
-			name, uuid, err := extractNameUUID(raw)
-			if err != nil {
-				continue
-			}
-			if count > 0 {
-				sb.WriteString(",")
-			}
-			base := count * 4
-			sb.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d)", base+1, base+2, base+3, base+4))
-			args = append(args, uuid, name, ts, ts)
-			count++
-		}
+// dimensionMerge upserts into a dimension table keyed by (server_id, uuid).
+func dimensionMerge(table string) db.Merge {
+	return db.Merge{
+		Table:    table,
+		Columns:  []string{"server_id", "uuid", "name", "first_seen", "last_seen"},
+		Conflict: []string{"server_id", "uuid"},
+		Update:   []string{"name", "last_seen"},
+	}
+}
 
-		if count == 0 {
+// upsertDimension merges the entities in details into a dimension table
+// (players, towns or nations): first_seen is kept, name and last_seen follow
+// the latest scrape.
+func (l *LowFreq) upsertDimension(ctx context.Context, ts time.Time, table string, details []json.RawMessage) error {
+	rows := make([][]any, 0, len(details))
+	for _, raw := range details {
+		name, uuid, err := extractNameUUID(raw)
+		if err != nil {
 			continue
 		}
+		rows = append(rows, []any{l.server, uuid, name, ts, ts})
+	}
+	_, err := dimensionMerge(table).Run(ctx, l.pool, rows, nil)
+	return err
+}
 
-		sb.WriteString(" ON CONFLICT (uuid) DO UPDATE SET name = EXCLUDED.name, last_seen = EXCLUDED.last_seen")
-
-		if _, err := l.pool.Exec(ctx, sb.String(), args...); err != nil {
-			return fmt.Errorf("upsert nations %d-%d: %w", i, end, err)
+// upsertNameHistory records the name each player in details was seen with
+// at ts, extending last_seen for names already known.
+func (l *LowFreq) upsertNameHistory(ctx context.Context, ts time.Time, details []json.RawMessage) error {
+	rows := make([][]any, 0, len(details))
+	for _, raw := range details {
+		name, uuid, err := extractNameUUID(raw)
+		if err != nil {
+			continue
 		}
-	}
-	return nil
+		rows = append(rows, []any{l.server, uuid, name, ts, ts})
+	}
+	_, err := db.Merge{
+		Table:    "player_name_history",
+		Columns:  []string{"server_id", "player_uuid", "name", "first_seen", "last_seen"},
+		Conflict: []string{"server_id", "player_uuid", "name"},
+		Update:   []string{"last_seen"},
+	}.Run(ctx, l.pool, rows, nil)
+	return err
 }
 
-// ---- Players (full profile) ----
+// ---- Quarters ----
 
-func (l *LowFreq) scrapePlayers(ctx context.Context, ts time.Time) error {
-	playerList, err := l.client.GetPlayersList(ctx)
+func (l *LowFreq) scrapeQuarters(ctx context.Context, run *scrapeRun) (runStep, error) {
+	ts := run.ts
+	quarterList, err := l.client.GetQuartersList(ctx)
 	if err != nil {
-		return fmt.Errorf("get players list: %w", err)
+		return runStep{}, fmt.Errorf("get quarters list: %w", err)
 	}
-	slog.Info("fetched player list", "count", len(playerList))
+	l.log.Info("fetched quarter list", "count", len(quarterList))
 
-	uuids := make([]string, len(playerList))
-	for i, p := range playerList {
-		uuids[i] = p.UUID
+	uuids := make([]string, len(quarterList))
+	for i, q := range quarterList {
+		uuids[i] = q.UUID
 	}
 
-	details, err := l.client.PostPlayers(ctx, uuids)
+	details, err := l.fetchDetails(ctx, "quarters", l.client.PostQuarters, uuids)
 	if err != nil {
-		return fmt.Errorf("post players: %w", err)
+		return runStep{}, fmt.Errorf("post quarters: %w", err)
 	}
-	slog.Info("fetched player details", "count", len(details))
+	l.log.Info("fetched quarter details", "count", len(details))
+	l.checkDrift(ctx, ts, "quarter", details, api.QuarterDetail{})
 
-	if err := l.insertPlayerSnapshots(ctx, ts, details); err != nil {
-		return fmt.Errorf("insert player snapshots: %w", err)
+	step := runStep{Fetched: len(details)}
+	step.Spooled, err = l.spools["quarter"].Write(ts, quarterRecord{Run: run.runRef, Details: details}, func() error {
+		return l.insertQuarterSnapshots(ctx, ts, run.runRef, details)
+	})
+	if err != nil {
+		return step, fmt.Errorf("insert quarter snapshots: %w", err)
 	}
-
-	// Also upsert the players dimension table
-	if err := l.upsertPlayersFull(ctx, ts, details); err != nil {
-		return fmt.Errorf("upsert players: %w", err)
+	if step.Spooled {
+		l.log.Info("quarter snapshots spooled", "count", len(details))
 	}
+	step.Inserted = len(details)
 
-	return nil
+	return step, nil
 }
 
-func (l *LowFreq) insertPlayerSnapshots(ctx context.Context, ts time.Time, details []json.RawMessage) error {
-	if len(details) == 0 {
-		return nil
-	}
-
-	const chunkSize = 500
-	for i := 0; i < len(details); i += chunkSize {
-		end := i + chunkSize
-		if end > len(details) {
-			end = len(details)
-		}
-		chunk := details[i:end]
-
-		var sb strings.Builder
-		sb.WriteString("INSERT INTO player_snapshots (snapshot_ts, player_uuid, player_name, data) VALUES ")
+// quarterRecord is a spooled batch of quarter snapshots.
+type quarterRecord struct {
+	Run     runRef            `json:"run"`
+	Details []json.RawMessage `json:"details"`
+}
 
-		args := make([]interface{}, 0, len(chunk)*4)
-		count := 0
-		for _, raw := range chunk {
-			name, uuid, err := extractNameUUID(raw)
-			if err != nil {
-				slog.Warn("skip player: parse error", "error", err)
-				continue
-			}
-			if count > 0 {
-				sb.WriteString(",")
-			}
-			base := count * 4
-			sb.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d)", base+1, base+2, base+3, base+4))
-			args = append(args, ts, uuid, name, raw)
-			count++
+func (l *LowFreq) insertQuarterSnapshots(ctx context.Context, ts time.Time, run runRef, details []json.RawMessage) error {
+	rows := make([][]any, 0, len(details))
+	for _, raw := range details {
+		var q struct {
+			Name  *string        `json:"name"`
+			UUID  string         `json:"uuid"`
+			Town  *api.ListEntry `json:"town"`
+			Owner *api.ListEntry `json:"owner"`
 		}
-
-		if count == 0 {
+		if err := json.Unmarshal(raw, &q); err != nil {
+			l.log.Warn("skip quarter: parse error", "error", err)
 			continue
 		}
-
-		if _, err := l.pool.Exec(ctx, sb.String(), args...); err != nil {
-			return fmt.Errorf("batch insert players %d-%d: %w", i, end, err)
+		var townUUID, ownerUUID *string
+		if q.Town != nil {
+			townUUID = &q.Town.UUID
+		}
+		if q.Owner != nil {
+			ownerUUID = &q.Owner.UUID
 		}
+		rows = append(rows, []any{l.server, ts, q.UUID, q.Name, townUUID, ownerUUID, raw, run.ID})
 	}
-	return nil
-}
 
-func (l *LowFreq) upsertPlayersFull(ctx context.Context, ts time.Time, details []json.RawMessage) error {
-	if len(details) == 0 {
-		return nil
+	tx, err := l.pool.Begin(ctx)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback(ctx)
 
-	const chunkSize = 500
-	for i := 0; i < len(details); i += chunkSize {
-		end := i + chunkSize
-		if end > len(details) {
-			end = len(details)
-		}
-		chunk := details[i:end]
-
-		var sb strings.Builder
-		sb.WriteString("INSERT INTO players (uuid, name, first_seen, last_seen) VALUES ")
-
-		args := make([]interface{}, 0, len(chunk)*4)
-		count := 0
-		for _, raw := range chunk {
-			name, uuid, err := extractNameUUID(raw)
-			if err != nil {
-				continue
-			}
-			if count > 0 {
-				sb.WriteString(",")
-			}
-			base := count * 4
-			sb.WriteString(fmt.Sprintf("($%d,$%d,$%d,$%d)", base+1, base+2, base+3, base+4))
-			args = append(args, uuid, name, ts, ts)
-			count++
-		}
-
-		if count == 0 {
-			continue
-		}
-
-		sb.WriteString(" ON CONFLICT (uuid) DO UPDATE SET name = EXCLUDED.name, last_seen = EXCLUDED.last_seen")
+	if err := run.ensure(ctx, tx, l.server, ts); err != nil {
+		return fmt.Errorf("record run: %w", err)
+	}
+	if _, err := db.CopyRows(ctx, tx, "quarter_snapshots",
+		[]string{"server_id", "snapshot_ts", "quarter_uuid", "quarter_name", "town_uuid", "owner_uuid", "data", "run_id"}, rows); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
 
-		if _, err := l.pool.Exec(ctx, sb.String(), args...); err != nil {
-			return fmt.Errorf("upsert players %d-%d: %w", i, end, err)
-		}
+func (l *LowFreq) replayQuarters(ctx context.Context, rec spool.Record) error {
+	var r quarterRecord
+	if err := json.Unmarshal(rec.Data, &r); err != nil {
+		return spool.Reject(err)
 	}
-	return nil
+	return replayErr(l.insertQuarterSnapshots(ctx, rec.TS, r.Run, r.Details))
 }
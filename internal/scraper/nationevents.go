@@ -0,0 +1,107 @@
+package scraper
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/0Mattias/earthmc-scraper/internal/api"
+)
+
+// Nation event types in nation_events.event_type.
+const (
+	nationTownJoined        = "town_joined"
+	nationTownLeft          = "town_left"
+	nationKingChanged       = "king_changed"
+	nationCapitalChanged    = "capital_changed"
+	nationAllyAdded         = "ally_added"
+	nationAllyRemoved       = "ally_removed"
+	nationEnemyAdded        = "enemy_added"
+	nationEnemyRemoved      = "enemy_removed"
+	nationSanctionedAdded   = "sanctioned_added"
+	nationSanctionedRemoved = "sanctioned_removed"
+	nationRankAssigned      = "rank_assigned"
+	nationRankRemoved       = "rank_removed"
+	nationColourChanged     = "colour_changed"
+	nationBalanceChanged    = "balance_changed"
+)
+
+// diffNations is the eventDiff for nation snapshots.
+func diffNations(prevRaw, curRaw json.RawMessage) ([]entityEvent, error) {
+	var prev, cur api.NationDetail
+	if err := json.Unmarshal(prevRaw, &prev); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(curRaw, &cur); err != nil {
+		return nil, err
+	}
+
+	var events []entityEvent
+	events = append(events, entryEvents(nationTownJoined, nationTownLeft, prev.Towns, cur.Towns)...)
+	events = append(events, replacedEvent(nationKingChanged, prev.King, cur.King)...)
+	events = append(events, replacedEvent(nationCapitalChanged, prev.Capital, cur.Capital)...)
+	events = append(events, entryEvents(nationAllyAdded, nationAllyRemoved, prev.Allies, cur.Allies)...)
+	events = append(events, entryEvents(nationEnemyAdded, nationEnemyRemoved, prev.Enemies, cur.Enemies)...)
+	events = append(events, entryEvents(nationSanctionedAdded, nationSanctionedRemoved, prev.Sanctioned, cur.Sanctioned)...)
+	events = append(events, rankEvents(prev, cur)...)
+	for _, c := range []struct {
+		attr      string
+		prev, cur *string
+	}{
+		{"fill", prev.DynmapColour, cur.DynmapColour},
+		{"outline", prev.DynmapOutline, cur.DynmapOutline},
+	} {
+		for _, e := range textEvent(nationColourChanged, c.prev, c.cur) {
+			e.Attribute = &c.attr
+			events = append(events, e)
+		}
+	}
+	if prev.Stats != nil && cur.Stats != nil {
+		events = append(events, deltaEvent(nationBalanceChanged, prev.Stats.Balance, cur.Stats.Balance)...)
+	}
+	return events, nil
+}
+
+// rankEvents reports residents given or stripped of a nation rank. Ranks
+// list residents by name; the uuid is looked up in the resident lists.
+func rankEvents(prev, cur api.NationDetail) []entityEvent {
+	uuids := make(map[string]string, len(cur.Residents))
+	for _, list := range [][]api.ListEntry{prev.Residents, cur.Residents} {
+		for _, r := range list {
+			uuids[r.Name] = r.UUID
+		}
+	}
+
+	names := make(map[string]bool, len(cur.Ranks))
+	for rank := range prev.Ranks {
+		names[rank] = true
+	}
+	for rank := range cur.Ranks {
+		names[rank] = true
+	}
+	ranks := make([]string, 0, len(names))
+	for rank := range names {
+		ranks = append(ranks, rank)
+	}
+	sort.Strings(ranks)
+
+	var events []entityEvent
+	for _, rank := range ranks {
+		added, removed := stringsDiff(prev.Ranks[rank], cur.Ranks[rank])
+		for _, c := range []struct {
+			typ   string
+			names []string
+		}{
+			{nationRankAssigned, added},
+			{nationRankRemoved, removed},
+		} {
+			for _, name := range c.names {
+				e := entityEvent{Type: c.typ, RelatedName: &name, Attribute: &rank}
+				if uuid, ok := uuids[name]; ok {
+					e.RelatedUUID = &uuid
+				}
+				events = append(events, e)
+			}
+		}
+	}
+	return events
+}
@@ -0,0 +1,67 @@
+package scraper
+
+import "testing"
+
+func TestDiffNations(t *testing.T) {
+	runDiffCases(t, diffNations, []diffCase{
+		{
+			name: "unchanged",
+			prev: `{"name":"Japan","king":{"name":"Fix","uuid":"p1"},"dynmapColour":"ff0000","ranks":{"Chancellor":["Owen3H"]}}`,
+			cur:  `{"name":"Japan","king":{"name":"Fix","uuid":"p1"},"dynmapColour":"ff0000","ranks":{"Chancellor":["Owen3H"]}}`,
+		},
+		{
+			name: "towns joined and left",
+			prev: `{"towns":[{"name":"Tokyo","uuid":"t1"},{"name":"Osaka","uuid":"t3"}]}`,
+			cur:  `{"towns":[{"name":"Tokyo","uuid":"t1"},{"name":"Kyoto","uuid":"t2"}]}`,
+			want: []string{
+				"town_joined related=Kyoto uuid=t2",
+				"town_left related=Osaka uuid=t3",
+			},
+		},
+		{
+			name: "king and capital changed",
+			prev: `{"king":{"name":"Fix","uuid":"p1"},"capital":{"name":"Tokyo","uuid":"t1"}}`,
+			cur:  `{"king":{"name":"Owen3H","uuid":"p2"},"capital":{"name":"Kyoto","uuid":"t2"}}`,
+			want: []string{
+				"king_changed related=Owen3H uuid=p2 old=Fix new=Owen3H",
+				"capital_changed related=Kyoto uuid=t2 old=Tokyo new=Kyoto",
+			},
+		},
+		{
+			name: "relations",
+			prev: `{"allies":[{"name":"Korea","uuid":"n2"}],"enemies":[],"sanctioned":[{"name":"China","uuid":"n3"}]}`,
+			cur:  `{"allies":[],"enemies":[{"name":"Korea","uuid":"n2"}],"sanctioned":[{"name":"China","uuid":"n3"}]}`,
+			want: []string{
+				"ally_removed related=Korea uuid=n2",
+				"enemy_added related=Korea uuid=n2",
+			},
+		},
+		{
+			name: "ranks by name, uuid from residents, sorted by rank",
+			prev: `{"residents":[{"name":"Fix","uuid":"p1"},{"name":"Owen3H","uuid":"p2"}],"ranks":{"Soldier":["Fix"],"Chancellor":["Owen3H"]}}`,
+			cur:  `{"residents":[{"name":"Fix","uuid":"p1"}],"ranks":{"Soldier":["Fix","Ghost"]}}`,
+			want: []string{
+				"rank_removed attr=Chancellor related=Owen3H uuid=p2",
+				"rank_assigned attr=Soldier related=Ghost",
+			},
+		},
+		{
+			name: "colours",
+			prev: `{"dynmapColour":"ff0000","dynmapOutline":"000000"}`,
+			cur:  `{"dynmapColour":"00ff00","dynmapOutline":"000000"}`,
+			want: []string{"colour_changed attr=fill old=ff0000 new=00ff00"},
+		},
+		{
+			name: "outline cleared",
+			prev: `{"dynmapOutline":"000000"}`,
+			cur:  `{}`,
+			want: []string{"colour_changed attr=outline old=000000"},
+		},
+		{
+			name: "balance changed",
+			prev: `{"stats":{"balance":1000}}`,
+			cur:  `{"stats":{"balance":1250}}`,
+			want: []string{"balance_changed old=1000 new=1250 delta=250"},
+		},
+	})
+}
@@ -0,0 +1,84 @@
+package scraper
+
+import (
+	"encoding/json"
+	"math"
+
+	"github.com/0Mattias/earthmc-scraper/internal/api"
+)
+
+// Player event types in player_events.event_type.
+const (
+	playerNameChanged       = "name_changed"
+	playerTownJoined        = "town_joined"
+	playerTownLeft          = "town_left"
+	playerNationJoined      = "nation_joined"
+	playerNationLeft        = "nation_left"
+	playerTownRankAdded     = "town_rank_added"
+	playerTownRankRemoved   = "town_rank_removed"
+	playerNationRankAdded   = "nation_rank_added"
+	playerNationRankRemoved = "nation_rank_removed"
+	playerStatusChanged     = "status_changed"
+	playerFriendAdded       = "friend_added"
+	playerFriendRemoved     = "friend_removed"
+	playerBalanceChanged    = "balance_changed"
+)
+
+// largeBalanceChange is the smallest balance change, in gold, recorded as
+// an event. Smaller ones are everyday trading and taxes.
+const largeBalanceChange = 500
+
+// playerFlags are the status flags reported by status_changed, by attribute.
+var playerFlags = []struct {
+	attr string
+	get  func(*api.PlayerStatus) bool
+}{
+	{"mayor", func(s *api.PlayerStatus) bool { return s.IsMayor }},
+	{"king", func(s *api.PlayerStatus) bool { return s.IsKing }},
+	{"npc", func(s *api.PlayerStatus) bool { return s.IsNPC }},
+}
+
+// diffPlayers is the eventDiff for player snapshots.
+func diffPlayers(prevRaw, curRaw json.RawMessage) ([]entityEvent, error) {
+	var prev, cur api.PlayerDetail
+	if err := json.Unmarshal(prevRaw, &prev); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(curRaw, &cur); err != nil {
+		return nil, err
+	}
+
+	var events []entityEvent
+	if prev.Name != cur.Name {
+		events = append(events, entityEvent{Type: playerNameChanged, OldValue: &prev.Name, NewValue: &cur.Name})
+	}
+	events = append(events, membershipEvents(playerTownJoined, playerTownLeft, prev.Town, cur.Town)...)
+	events = append(events, membershipEvents(playerNationJoined, playerNationLeft, prev.Nation, cur.Nation)...)
+	if prev.Ranks != nil && cur.Ranks != nil {
+		events = append(events, playerRankEvents(playerTownRankAdded, playerTownRankRemoved, prev.Ranks.TownRanks, cur.Ranks.TownRanks)...)
+		events = append(events, playerRankEvents(playerNationRankAdded, playerNationRankRemoved, prev.Ranks.NationRanks, cur.Ranks.NationRanks)...)
+	}
+	if prev.Status != nil && cur.Status != nil {
+		for _, f := range playerFlags {
+			events = append(events, flagEvent(playerStatusChanged, f.attr, f.get(prev.Status), f.get(cur.Status))...)
+		}
+	}
+	events = append(events, entryEvents(playerFriendAdded, playerFriendRemoved, prev.Friends, cur.Friends)...)
+	if prev.Stats != nil && cur.Stats != nil && math.Abs(cur.Stats.Balance-prev.Stats.Balance) >= largeBalanceChange {
+		events = append(events, deltaEvent(playerBalanceChanged, prev.Stats.Balance, cur.Stats.Balance)...)
+	}
+	return events, nil
+}
+
+// playerRankEvents reports ranks given to or taken from a player.
+func playerRankEvents(added, removed string, prev, cur []string) []entityEvent {
+	plus, minus := stringsDiff(prev, cur)
+	var events []entityEvent
+	for _, rank := range plus {
+		events = append(events, entityEvent{Type: added, Attribute: &rank})
+	}
+	for _, rank := range minus {
+		events = append(events, entityEvent{Type: removed, Attribute: &rank})
+	}
+	return events
+}
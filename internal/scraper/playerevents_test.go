@@ -0,0 +1,72 @@
+package scraper
+
+import "testing"
+
+func TestDiffPlayers(t *testing.T) {
+	runDiffCases(t, diffPlayers, []diffCase{
+		{
+			name: "unchanged",
+			prev: `{"name":"Fix","town":{"name":"Tokyo","uuid":"t1"},"stats":{"balance":10}}`,
+			cur:  `{"name":"Fix","town":{"name":"Tokyo","uuid":"t1"},"stats":{"balance":10}}`,
+		},
+		{
+			name: "renamed",
+			prev: `{"name":"Fix"}`,
+			cur:  `{"name":"Fix2"}`,
+			want: []string{"name_changed old=Fix new=Fix2"},
+		},
+		{
+			name: "joined a town and nation",
+			prev: `{"town":null,"nation":null}`,
+			cur:  `{"town":{"name":"Tokyo","uuid":"t1"},"nation":{"name":"Japan","uuid":"n1"}}`,
+			want: []string{
+				"town_joined related=Tokyo uuid=t1",
+				"nation_joined related=Japan uuid=n1",
+			},
+		},
+		{
+			name: "town renamed is not a move",
+			prev: `{"town":{"name":"Tokyo","uuid":"t1"}}`,
+			cur:  `{"town":{"name":"Edo","uuid":"t1"}}`,
+		},
+		{
+			name: "ranks",
+			prev: `{"ranks":{"townRanks":["Helper"],"nationRanks":[]}}`,
+			cur:  `{"ranks":{"townRanks":["Sheriff"],"nationRanks":["Chancellor"]}}`,
+			want: []string{
+				"town_rank_added attr=Sheriff",
+				"town_rank_removed attr=Helper",
+				"nation_rank_added attr=Chancellor",
+			},
+		},
+		{
+			name: "status flags",
+			prev: `{"status":{"isMayor":true,"isKing":false,"isOnline":false}}`,
+			cur:  `{"status":{"isMayor":false,"isKing":true,"isOnline":true}}`,
+			want: []string{
+				"status_changed attr=mayor old=true new=false",
+				"status_changed attr=king old=false new=true",
+			},
+		},
+		{
+			name: "friends",
+			prev: `{"friends":[{"name":"Owen3H","uuid":"p2"}]}`,
+			cur:  `{"friends":[{"name":"Kuroi","uuid":"p3"}]}`,
+			want: []string{
+				"friend_added related=Kuroi uuid=p3",
+				"friend_removed related=Owen3H uuid=p2",
+			},
+		},
+		{
+			name: "small balance change is not recorded",
+			prev: `{"stats":{"balance":1000}}`,
+			cur:  `{"stats":{"balance":1499}}`,
+		},
+		{
+			name: "large balance change",
+			prev: `{"stats":{"balance":1000}}`,
+			cur:  `{"stats":{"balance":500}}`,
+			want: []string{"balance_changed old=1000 new=500 delta=-500"},
+		},
+	})
+}
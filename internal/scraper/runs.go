@@ -0,0 +1,193 @@
+package scraper
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/0Mattias/earthmc-scraper/internal/api"
+	"github.com/0Mattias/earthmc-scraper/internal/db"
+	"github.com/0Mattias/earthmc-scraper/internal/spool"
+)
+
+// Loops as recorded in scrape_runs.loop.
+const (
+	loopHigh = "high"
+	loopLow  = "low"
+)
+
+// Run statuses in scrape_runs.status.
+const (
+	runOK      = "ok"
+	runPartial = "partial" // some steps failed
+	runFailed  = "failed"  // every step failed
+	runSkipped = "skipped" // the previous tick was still running
+)
+
+// runRef identifies the run a write belongs to. Every write upserts the
+// run's row first, so the foreign key holds however writes are replayed.
+type runRef struct {
+	ID        pgtype.UUID `json:"id"`
+	Loop      string      `json:"loop"`
+	StartedAt time.Time   `json:"started_at"`
+}
+
+// ensure creates the run's scrape_runs row if it does not exist yet.
+func (r runRef) ensure(ctx context.Context, q db.Bulker, server string, ts time.Time) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO scrape_runs (id, server_id, loop, snapshot_ts, started_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO NOTHING`,
+		r.ID, server, r.Loop, ts, r.StartedAt)
+	return err
+}
+
+// runStep is one step's outcome in scrape_runs.steps.
+type runStep struct {
+	Fetched    int    `json:"fetched"`
+	Inserted   int    `json:"inserted"`
+	Spooled    bool   `json:"spooled,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// scrapeRun is one tick as it happens. Steps may report concurrently, and
+// every request made with ctx() counts towards its HTTP stats.
+type scrapeRun struct {
+	runRef
+	ts   time.Time
+	http api.Stats
+
+	mu    sync.Mutex
+	steps map[string]runStep
+}
+
+func newRun(loop string, ts time.Time) *scrapeRun {
+	var id pgtype.UUID
+	rand.Read(id.Bytes[:])
+	id.Bytes[6] = id.Bytes[6]&0x0f | 0x40 // version 4
+	id.Bytes[8] = id.Bytes[8]&0x3f | 0x80 // RFC 4122 variant
+	id.Valid = true
+
+	return &scrapeRun{
+		runRef: runRef{ID: id, Loop: loop, StartedAt: time.Now()},
+		ts:     ts,
+		steps:  make(map[string]runStep),
+	}
+}
+
+// ctx attributes the HTTP requests made with the returned context to r.
+func (r *scrapeRun) ctx(ctx context.Context) context.Context {
+	return api.WithStats(ctx, &r.http)
+}
+
+// step records how a step went. err may be nil.
+func (r *scrapeRun) step(name string, s runStep, start time.Time, err error) {
+	s.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		s.Error = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps[name] = s
+}
+
+// runRecord is a finished run, as written to scrape_runs and spooled.
+type runRecord struct {
+	runRef
+	FinishedAt time.Time          `json:"finished_at"`
+	Status     string             `json:"status"`
+	Skipped    bool               `json:"skipped"`
+	Spooled    bool               `json:"spooled"`
+	Steps      map[string]runStep `json:"steps"`
+	HTTP       api.Totals         `json:"http"`
+}
+
+func (r *scrapeRun) finish() runRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec := runRecord{
+		runRef:     r.runRef,
+		FinishedAt: time.Now(),
+		Status:     runOK,
+		Steps:      r.steps,
+		HTTP:       r.http.Totals(),
+	}
+	failed := 0
+	for _, s := range r.steps {
+		if s.Error != "" {
+			failed++
+		}
+		rec.Spooled = rec.Spooled || s.Spooled
+	}
+	switch {
+	case failed > 0 && failed == len(r.steps):
+		rec.Status = runFailed
+	case failed > 0:
+		rec.Status = runPartial
+	}
+	return rec
+}
+
+// skippedRun is the record of a tick that did not start because the
+// previous one was still running.
+func skippedRun(loop string) runRecord {
+	r := newRun(loop, time.Now())
+	return runRecord{runRef: r.runRef, FinishedAt: r.StartedAt, Status: runSkipped, Skipped: true, Steps: r.steps}
+}
+
+// write upserts the finished run into scrape_runs.
+func (rec runRecord) write(ctx context.Context, pool *pgxpool.Pool, server string, ts time.Time) error {
+	steps, err := json.Marshal(rec.Steps)
+	if err != nil {
+		return err
+	}
+	_, err = pool.Exec(ctx, `
+		INSERT INTO scrape_runs (
+			id, server_id, loop, snapshot_ts, started_at, finished_at, status, skipped, spooled, steps,
+			http_requests, http_retries, http_errors, http_rate_limited, http_not_modified, http_bytes, http_wait_ms
+		) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17)
+		ON CONFLICT (id) DO UPDATE SET
+			finished_at       = EXCLUDED.finished_at,
+			status            = EXCLUDED.status,
+			skipped           = EXCLUDED.skipped,
+			spooled           = EXCLUDED.spooled,
+			steps             = EXCLUDED.steps,
+			http_requests     = EXCLUDED.http_requests,
+			http_retries      = EXCLUDED.http_retries,
+			http_errors       = EXCLUDED.http_errors,
+			http_rate_limited = EXCLUDED.http_rate_limited,
+			http_not_modified = EXCLUDED.http_not_modified,
+			http_bytes        = EXCLUDED.http_bytes,
+			http_wait_ms      = EXCLUDED.http_wait_ms`,
+		rec.ID, server, rec.Loop, ts, rec.StartedAt, rec.FinishedAt, rec.Status, rec.Skipped, rec.Spooled, steps,
+		rec.HTTP.Requests, rec.HTTP.Retries, rec.HTTP.Errors, rec.HTTP.RateLimited, rec.HTTP.NotModified,
+		rec.HTTP.Bytes, rec.HTTP.WaitMS)
+	return err
+}
+
+// recordRun writes a finished run to the ledger, through q when the
+// database is down.
+func recordRun(ctx context.Context, pool *pgxpool.Pool, q *spool.Queue, server string, ts time.Time, rec runRecord) error {
+	_, err := q.Write(ts, rec, func() error {
+		return rec.write(ctx, pool, server, ts)
+	})
+	return err
+}
+
+// replayRun returns the spool replay function for a server's run ledger.
+func replayRun(pool *pgxpool.Pool, server string) func(context.Context, spool.Record) error {
+	return func(ctx context.Context, r spool.Record) error {
+		var rec runRecord
+		if err := json.Unmarshal(r.Data, &rec); err != nil {
+			return spool.Reject(err)
+		}
+		return replayErr(rec.write(ctx, pool, server, r.TS))
+	}
+}
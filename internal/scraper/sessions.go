@@ -0,0 +1,312 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Session boundary reasons stored in player_sessions.
+const (
+	sessionLogin   = "login"
+	sessionLogout  = "logout"
+	sessionUnknown = "unknown" // the scraper was not running at the boundary
+)
+
+// session is the in-memory state of one open player_sessions row.
+type session struct {
+	id          int64 // 0 until the row has been inserted
+	uuid        string
+	name        string
+	startedAt   time.Time
+	startReason string
+	lastSeen    time.Time
+	samples     int32
+	visible     int32
+	worlds      []string
+	minX, maxX  *int32
+	minZ, maxZ  *int32
+
+	endedAt   time.Time
+	endReason string
+}
+
+func (s *session) observe(r activityRow, ts time.Time) {
+	s.name = r.PlayerName
+	s.lastSeen = ts
+	s.samples++
+	if !r.IsVisible {
+		return
+	}
+	s.visible++
+	if r.World != nil && !slices.Contains(s.worlds, *r.World) {
+		s.worlds = append(s.worlds, *r.World)
+	}
+	if r.X != nil && r.Z != nil {
+		x, z := int32(*r.X), int32(*r.Z)
+		s.minX, s.maxX = extend(s.minX, s.maxX, x)
+		s.minZ, s.maxZ = extend(s.minZ, s.maxZ, z)
+	}
+}
+
+func extend(lo, hi *int32, v int32) (*int32, *int32) {
+	if lo == nil || v < *lo {
+		lo = &v
+	}
+	if hi == nil || v > *hi {
+		hi = &v
+	}
+	return lo, hi
+}
+
+// sessionTracker turns the high-freq /online samples into player_sessions
+// rows. It is only used from HighFreq's tick, so it needs no locking.
+type sessionTracker struct {
+	server string
+	pool   *pgxpool.Pool
+	grace  time.Duration
+
+	loaded   bool
+	lastTick time.Time
+	open     map[string]*session // by player UUID
+}
+
+func newSessionTracker(server string, pool *pgxpool.Pool, grace time.Duration) *sessionTracker {
+	return &sessionTracker{
+		server: server,
+		pool:   pool,
+		grace:  grace,
+		open:   make(map[string]*session),
+	}
+}
+
+// load picks up the sessions left open by a previous run. The newest of them
+// stands in for the previous run's last tick, so a quick restart continues
+// them and a long outage closes them as unknown.
+func (t *sessionTracker) load(ctx context.Context) error {
+	rows, err := t.pool.Query(ctx, `
+		SELECT id, player_uuid, player_name, started_at, start_reason, last_seen_at,
+		       samples, visible_samples, worlds, min_x, max_x, min_z, max_z
+		FROM player_sessions
+		WHERE server_id = $1 AND ended_at IS NULL`, t.server)
+	if err != nil {
+		return fmt.Errorf("load open sessions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s := &session{}
+		if err := rows.Scan(&s.id, &s.uuid, &s.name, &s.startedAt, &s.startReason, &s.lastSeen,
+			&s.samples, &s.visible, &s.worlds, &s.minX, &s.maxX, &s.minZ, &s.maxZ); err != nil {
+			return err
+		}
+		t.open[s.uuid] = s
+		if s.lastSeen.After(t.lastTick) {
+			t.lastTick = s.lastSeen
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	t.loaded = true
+	return nil
+}
+
+// observe applies one successful tick: players in rows are online at ts.
+func (t *sessionTracker) observe(ctx context.Context, ts time.Time, rows []activityRow) error {
+	if !t.loaded {
+		if err := t.load(ctx); err != nil {
+			return err
+		}
+	}
+	return t.write(ctx, t.advance(ts, rows))
+}
+
+// advance applies one tick to the open sessions in memory and returns the
+// sessions it closed.
+func (t *sessionTracker) advance(ts time.Time, rows []activityRow) []*session {
+	// After a scraping gap nobody's presence in between is known, so every
+	// open session ends as unknown and this tick starts fresh ones.
+	gap := t.lastTick.IsZero() || ts.Sub(t.lastTick) > t.grace
+	t.lastTick = ts
+
+	var closed []*session
+	if gap {
+		for uuid, s := range t.open {
+			s.endedAt, s.endReason = s.lastSeen, sessionUnknown
+			closed = append(closed, s)
+			delete(t.open, uuid)
+		}
+	}
+
+	startReason := sessionLogin
+	if gap {
+		startReason = sessionUnknown
+	}
+	seen := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		seen[r.PlayerUUID] = true
+		s, ok := t.open[r.PlayerUUID]
+		if !ok {
+			s = &session{uuid: r.PlayerUUID, startedAt: ts, startReason: startReason}
+			t.open[r.PlayerUUID] = s
+		}
+		s.observe(r, ts)
+	}
+
+	for uuid, s := range t.open {
+		if !seen[uuid] && ts.Sub(s.lastSeen) > t.grace {
+			s.endedAt, s.endReason = s.lastSeen, sessionLogout
+			closed = append(closed, s)
+			delete(t.open, uuid)
+		}
+	}
+	return closed
+}
+
+// write persists closed sessions and every open one: new sessions are
+// inserted, the rest updated in place.
+func (t *sessionTracker) write(ctx context.Context, closed []*session) error {
+	var inserts, updates []*session
+	for _, s := range closed {
+		// A session that never made it into the table is simply dropped.
+		if s.id != 0 {
+			updates = append(updates, s)
+		}
+	}
+	for _, s := range t.open {
+		if s.id == 0 {
+			inserts = append(inserts, s)
+		} else if s.lastSeen.Equal(t.lastTick) {
+			updates = append(updates, s)
+		}
+	}
+
+	// Closes go first so a player who reconnected after a gap never has two
+	// open rows.
+	if err := t.update(ctx, updates); err != nil {
+		return fmt.Errorf("update sessions: %w", err)
+	}
+	if err := t.insert(ctx, inserts); err != nil {
+		return fmt.Errorf("insert sessions: %w", err)
+	}
+	return nil
+}
+
+// sessionColumns are per-session values as parallel arrays for UNNEST.
+type sessionColumns struct {
+	ids              []int64
+	uuids, names     []string
+	startedAt        []time.Time
+	startReason      []string
+	lastSeen         []time.Time
+	samples, visible []int32
+	worlds           []string // comma-joined
+	minX, maxX       []*int32
+	minZ, maxZ       []*int32
+	endedAt          []*time.Time
+	endReason        []*string
+}
+
+func columnsOf(sessions []*session) sessionColumns {
+	var c sessionColumns
+	for _, s := range sessions {
+		c.ids = append(c.ids, s.id)
+		c.uuids = append(c.uuids, s.uuid)
+		c.names = append(c.names, s.name)
+		c.startedAt = append(c.startedAt, s.startedAt)
+		c.startReason = append(c.startReason, s.startReason)
+		c.lastSeen = append(c.lastSeen, s.lastSeen)
+		c.samples = append(c.samples, s.samples)
+		c.visible = append(c.visible, s.visible)
+		c.worlds = append(c.worlds, strings.Join(s.worlds, ","))
+		c.minX = append(c.minX, s.minX)
+		c.maxX = append(c.maxX, s.maxX)
+		c.minZ = append(c.minZ, s.minZ)
+		c.maxZ = append(c.maxZ, s.maxZ)
+		if s.endReason != "" {
+			c.endedAt = append(c.endedAt, &s.endedAt)
+			c.endReason = append(c.endReason, &s.endReason)
+		} else {
+			c.endedAt = append(c.endedAt, nil)
+			c.endReason = append(c.endReason, nil)
+		}
+	}
+	return c
+}
+
+func (t *sessionTracker) insert(ctx context.Context, sessions []*session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	c := columnsOf(sessions)
+
+	// Any row still open for these players is stale (e.g. its close failed
+	// to write), and would block the insert on the one-open-session index.
+	if _, err := t.pool.Exec(ctx, `
+		UPDATE player_sessions SET ended_at = last_seen_at, end_reason = $3
+		WHERE server_id = $1 AND player_uuid = ANY($2) AND ended_at IS NULL`,
+		t.server, c.uuids, sessionUnknown); err != nil {
+		return err
+	}
+
+	rows, err := t.pool.Query(ctx, `
+		INSERT INTO player_sessions (
+			server_id, player_uuid, player_name, started_at, start_reason, last_seen_at,
+			samples, visible_samples, worlds, min_x, max_x, min_z, max_z
+		)
+		SELECT $1, u.uuid, u.name, u.started_at, u.start_reason, u.last_seen,
+		       u.samples, u.visible, STRING_TO_ARRAY(u.worlds, ','), u.min_x, u.max_x, u.min_z, u.max_z
+		FROM UNNEST($2::text[], $3::text[], $4::timestamptz[], $5::text[], $6::timestamptz[],
+		            $7::int[], $8::int[], $9::text[], $10::int[], $11::int[], $12::int[], $13::int[])
+		     AS u(uuid, name, started_at, start_reason, last_seen, samples, visible, worlds, min_x, max_x, min_z, max_z)
+		RETURNING id, player_uuid`,
+		t.server, c.uuids, c.names, c.startedAt, c.startReason, c.lastSeen,
+		c.samples, c.visible, c.worlds, c.minX, c.maxX, c.minZ, c.maxZ)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id   int64
+			uuid string
+		)
+		if err := rows.Scan(&id, &uuid); err != nil {
+			return err
+		}
+		if s, ok := t.open[uuid]; ok {
+			s.id = id
+		}
+	}
+	return rows.Err()
+}
+
+func (t *sessionTracker) update(ctx context.Context, sessions []*session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	c := columnsOf(sessions)
+	_, err := t.pool.Exec(ctx, `
+		UPDATE player_sessions s SET
+			player_name     = u.name,
+			last_seen_at    = u.last_seen,
+			samples         = u.samples,
+			visible_samples = u.visible,
+			worlds          = STRING_TO_ARRAY(u.worlds, ','),
+			min_x = u.min_x, max_x = u.max_x, min_z = u.min_z, max_z = u.max_z,
+			ended_at        = u.ended_at,
+			end_reason      = u.end_reason
+		FROM UNNEST($1::bigint[], $2::text[], $3::timestamptz[], $4::int[], $5::int[], $6::text[],
+		            $7::int[], $8::int[], $9::int[], $10::int[], $11::timestamptz[], $12::text[])
+		     AS u(id, name, last_seen, samples, visible, worlds, min_x, max_x, min_z, max_z, ended_at, end_reason)
+		WHERE s.id = u.id`,
+		c.ids, c.names, c.lastSeen, c.samples, c.visible, c.worlds,
+		c.minX, c.maxX, c.minZ, c.maxZ, c.endedAt, c.endReason)
+	return err
+}
@@ -0,0 +1,177 @@
+package scraper
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// hiddenOnline is an online player not shown on the map.
+func hiddenOnline(uuid, name string) activityRow {
+	return activityRow{PlayerUUID: uuid, PlayerName: name, IsOnline: true}
+}
+
+// testTracker is a tracker whose open sessions count as loaded.
+func testTracker() *sessionTracker {
+	t := newSessionTracker("aurora", nil, 90*time.Second)
+	t.loaded = true
+	return t
+}
+
+// describeSession renders the fields the tests compare; times are seconds
+// after base.
+func describeSession(s *session, base time.Time) string {
+	out := fmt.Sprintf("%s %s@%s seen@%s samples=%d",
+		s.uuid, s.startReason, s.startedAt.Sub(base), s.lastSeen.Sub(base), s.samples)
+	if s.endReason != "" {
+		out += fmt.Sprintf(" %s@%s", s.endReason, s.endedAt.Sub(base))
+	}
+	return out
+}
+
+func TestSessionTrackerAdvance(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	fix, owen := hiddenOnline("p1", "Fix"), hiddenOnline("p2", "Owen3H")
+
+	type tick struct {
+		at   time.Duration
+		rows []activityRow
+	}
+	tests := []struct {
+		name       string
+		ticks      []tick
+		wantOpen   []string
+		wantClosed []string // closed by the last tick
+	}{
+		{
+			name:     "cold start begins sessions as unknown",
+			ticks:    []tick{{0, []activityRow{fix}}},
+			wantOpen: []string{"p1 unknown@0s seen@0s samples=1"},
+		},
+		{
+			name:     "players joining later log in",
+			ticks:    []tick{{0, []activityRow{fix}}, {3 * time.Second, []activityRow{fix, owen}}},
+			wantOpen: []string{"p1 unknown@0s seen@3s samples=2", "p2 login@3s seen@3s samples=1"},
+		},
+		{
+			name: "missing within the grace keeps the session open",
+			ticks: []tick{
+				{0, []activityRow{fix, owen}},
+				{30 * time.Second, []activityRow{fix}},
+				{90 * time.Second, []activityRow{fix}},
+			},
+			wantOpen: []string{"p1 unknown@0s seen@1m30s samples=3", "p2 unknown@0s seen@0s samples=1"},
+		},
+		{
+			name: "missing past the grace logs out at the last sighting",
+			ticks: []tick{
+				{0, []activityRow{fix, owen}},
+				{60 * time.Second, []activityRow{fix}},
+				{120 * time.Second, []activityRow{fix}},
+			},
+			wantOpen:   []string{"p1 unknown@0s seen@2m0s samples=3"},
+			wantClosed: []string{"p2 unknown@0s seen@0s samples=1 logout@0s"},
+		},
+		{
+			name: "returning after logging out starts a new session",
+			ticks: []tick{
+				{0, []activityRow{fix, owen}},
+				{60 * time.Second, []activityRow{fix}},
+				{120 * time.Second, []activityRow{fix}},
+				{150 * time.Second, []activityRow{fix, owen}},
+			},
+			wantOpen: []string{"p1 unknown@0s seen@2m30s samples=4", "p2 login@2m30s seen@2m30s samples=1"},
+		},
+		{
+			name: "a scraper gap ends everything as unknown",
+			ticks: []tick{
+				{0, []activityRow{fix}},
+				{3 * time.Second, []activityRow{fix, owen}},
+				{10 * time.Minute, []activityRow{fix}},
+			},
+			wantOpen: []string{"p1 unknown@10m0s seen@10m0s samples=1"},
+			wantClosed: []string{
+				"p1 unknown@0s seen@3s samples=2 unknown@3s",
+				"p2 login@3s seen@3s samples=1 unknown@3s",
+			},
+		},
+		{
+			name:  "an empty tick still advances",
+			ticks: []tick{{0, []activityRow{fix}}, {60 * time.Second, nil}, {120 * time.Second, nil}},
+			wantClosed: []string{
+				"p1 unknown@0s seen@0s samples=1 logout@0s",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := testTracker()
+			var closed []*session
+			for _, tk := range tt.ticks {
+				closed = tr.advance(base.Add(tk.at), tk.rows)
+			}
+
+			var gotOpen, gotClosed []string
+			for _, s := range tr.open {
+				gotOpen = append(gotOpen, describeSession(s, base))
+			}
+			for _, s := range closed {
+				gotClosed = append(gotClosed, describeSession(s, base))
+			}
+			sort.Strings(gotOpen)
+			sort.Strings(gotClosed)
+			if !reflect.DeepEqual(gotOpen, tt.wantOpen) {
+				t.Errorf("open:\n got %q\nwant %q", gotOpen, tt.wantOpen)
+			}
+			if !reflect.DeepEqual(gotClosed, tt.wantClosed) {
+				t.Errorf("closed:\n got %q\nwant %q", gotClosed, tt.wantClosed)
+			}
+		})
+	}
+}
+
+func TestSessionBoundsAndWorlds(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	nether := visibleAt("p1", "Fix", -40, 7)
+	nether.World = ptr("minecraft_the_nether")
+
+	tr := testTracker()
+	for i, r := range []activityRow{
+		visibleAt("p1", "Fix", 10, -5),
+		hiddenOnline("p1", "Fix"),
+		visibleAt("p1", "Fix", 25, 3),
+		nether,
+		visibleAt("p1", "Fix2", 12, -20),
+	} {
+		tr.advance(base.Add(time.Duration(i)*3*time.Second), []activityRow{r})
+	}
+
+	s := tr.open["p1"]
+	if s == nil {
+		t.Fatal("no open session")
+	}
+	if s.samples != 5 || s.visible != 4 {
+		t.Errorf("samples %d visible %d, want 5 and 4", s.samples, s.visible)
+	}
+	if want := []string{"minecraft_overworld", "minecraft_the_nether"}; !reflect.DeepEqual(s.worlds, want) {
+		t.Errorf("worlds = %v, want %v", s.worlds, want)
+	}
+	got := [4]int32{*s.minX, *s.maxX, *s.minZ, *s.maxZ}
+	if want := [4]int32{-40, 25, -20, 7}; got != want {
+		t.Errorf("bounds (minX, maxX, minZ, maxZ) = %v, want %v", got, want)
+	}
+	if s.name != "Fix2" {
+		t.Errorf("name = %q, want the latest, Fix2", s.name)
+	}
+}
+
+func TestSessionHiddenOnlyHasNoBounds(t *testing.T) {
+	tr := testTracker()
+	tr.advance(time.Now(), []activityRow{hiddenOnline("p1", "Fix")})
+	s := tr.open["p1"]
+	if s.visible != 0 || s.minX != nil || s.maxZ != nil || s.worlds != nil {
+		t.Errorf("hidden-only session has visible %d, bounds %v %v, worlds %v", s.visible, s.minX, s.maxZ, s.worlds)
+	}
+}
@@ -0,0 +1,303 @@
+package scraper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/0Mattias/earthmc-scraper/internal/db"
+	"github.com/0Mattias/earthmc-scraper/internal/spool"
+)
+
+// snapshotTable describes one of the JSONB *_snapshots tables written by the
+// low-freq loop.
+type snapshotTable struct {
+	kind    string // recorded in snapshot_ticks, e.g. "town"
+	table   string
+	uuidCol string
+	nameCol string
+
+	// Changes between an entity's snapshots are written to the events
+	// table when diff is set.
+	events string
+	diff   eventDiff
+}
+
+var (
+	townSnapshots = snapshotTable{
+		kind: "town", table: "town_snapshots", uuidCol: "town_uuid", nameCol: "town_name",
+		events: "town_events", diff: diffTowns,
+	}
+	nationSnapshots = snapshotTable{
+		kind: "nation", table: "nation_snapshots", uuidCol: "nation_uuid", nameCol: "nation_name",
+		events: "nation_events", diff: diffNations,
+	}
+	playerSnapshots = snapshotTable{
+		kind: "player", table: "player_snapshots", uuidCol: "player_uuid", nameCol: "player_name",
+		events: "player_events", diff: diffPlayers,
+	}
+)
+
+// hashCache remembers, per entity, the content hash and row id of its latest
+// snapshot. It starts empty, so the first tick after a restart writes every
+// entity once.
+type hashCache struct {
+	mu      sync.Mutex
+	entries map[string]hashEntry
+}
+
+type hashEntry struct {
+	hash string
+	id   int64
+}
+
+func newHashCache() *hashCache {
+	return &hashCache{entries: make(map[string]hashEntry)}
+}
+
+func (c *hashCache) get(uuid string) (hashEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[uuid]
+	return e, ok
+}
+
+func (c *hashCache) set(uuid string, e hashEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[uuid] = e
+}
+
+// retain forgets every entity not in seen.
+func (c *hashCache) retain(seen map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for uuid := range c.entries {
+		if !seen[uuid] {
+			delete(c.entries, uuid)
+		}
+	}
+}
+
+func (c *hashCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]hashEntry)
+}
+
+// contentHash identifies a payload's content. The API serialises fields in a
+// stable order, so equal bytes mean an unchanged entity.
+func contentHash(raw json.RawMessage) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:16])
+}
+
+// snapshotRow is a parsed payload ready to write.
+type snapshotRow struct {
+	UUID string          `json:"uuid"`
+	Name string          `json:"name"`
+	Hash string          `json:"hash"`
+	Raw  json.RawMessage `json:"raw"`
+}
+
+// snapshotBatch is one tick's write to a snapshot table, as spooled.
+type snapshotBatch struct {
+	Run     runRef        `json:"run"`
+	Changed []snapshotRow `json:"changed"`
+	// Unchanged entities by the id of their latest row, or by uuid when
+	// that row was spooled and its id is not known yet
+	UnchangedIDs   []int64  `json:"unchanged_ids"`
+	UnchangedUUIDs []string `json:"unchanged_uuids"`
+	// Listed is every town the list endpoint returned, for closing the
+	// claims of deleted towns. Only town batches carry it.
+	Listed []string `json:"listed,omitempty"`
+}
+
+// writeSnapshots stores a new row only for entities whose content changed
+// since their last snapshot or that the previous tick did not see, extends
+// observed_until on the unchanged ones, and records the tick in
+// snapshot_ticks so the *_filled views can rebuild one row per entity per
+// tick.
+func (l *LowFreq) writeSnapshots(ctx context.Context, run *scrapeRun, tbl snapshotTable, details []json.RawMessage, listed []string) (runStep, error) {
+	step := runStep{Fetched: len(details)}
+	if len(details) == 0 {
+		return step, nil
+	}
+	ts := run.ts
+	cache := l.hashes[tbl.kind]
+
+	b := snapshotBatch{Run: run.runRef, Listed: listed}
+	seen := make(map[string]bool, len(details))
+	for _, raw := range details {
+		name, uuid, err := extractNameUUID(raw)
+		if err != nil {
+			l.log.Warn("skip "+tbl.kind+": parse error", "error", err)
+			continue
+		}
+		seen[uuid] = true
+		hash := contentHash(raw)
+		if prev, ok := cache.get(uuid); ok && prev.hash == hash {
+			if prev.id != 0 {
+				b.UnchangedIDs = append(b.UnchangedIDs, prev.id)
+			} else {
+				b.UnchangedUUIDs = append(b.UnchangedUUIDs, uuid)
+			}
+			continue
+		}
+		b.Changed = append(b.Changed, snapshotRow{UUID: uuid, Name: name, Hash: hash, Raw: raw})
+	}
+	// An entity missing from this tick (a failed batch, a deleted town) was
+	// not observed, so its row must not be extended across the gap: when it
+	// comes back it starts a new row even if nothing changed.
+	cache.retain(seen)
+
+	var ids map[string]int64
+	spooled, err := l.spools[tbl.kind].Write(ts, b, func() (err error) {
+		ids, err = l.applySnapshots(ctx, ts, tbl, b)
+		return err
+	})
+	if err != nil {
+		// Unknown what landed; the next tick starts over from full rows.
+		cache.reset()
+		return step, err
+	}
+	step.Inserted, step.Spooled = len(b.Changed), spooled
+
+	// A spooled row's id is unknown (0) until a later tick finds it by uuid.
+	for _, r := range b.Changed {
+		cache.set(r.UUID, hashEntry{hash: r.Hash, id: ids[r.UUID]})
+	}
+	for _, uuid := range b.UnchangedUUIDs {
+		if prev, ok := cache.get(uuid); ok && ids[uuid] != 0 {
+			cache.set(uuid, hashEntry{hash: prev.hash, id: ids[uuid]})
+		}
+	}
+
+	l.log.Info("snapshots saved", "kind", tbl.kind, "changed", len(b.Changed),
+		"unchanged", len(b.UnchangedIDs)+len(b.UnchangedUUIDs), "spooled", spooled)
+	return step, nil
+}
+
+// applySnapshots writes a batch in one transaction and returns the ids of
+// the rows it inserted or extended by uuid.
+func (l *LowFreq) applySnapshots(ctx context.Context, ts time.Time, tbl snapshotTable, b snapshotBatch) (map[string]int64, error) {
+	tx, err := l.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := b.Run.ensure(ctx, tx, l.server, ts); err != nil {
+		return nil, fmt.Errorf("record run: %w", err)
+	}
+
+	ids := make(map[string]int64, len(b.Changed)+len(b.UnchangedUUIDs))
+	scan := func(r pgx.Rows) error {
+		var (
+			id   int64
+			uuid string
+		)
+		if err := r.Scan(&id, &uuid); err != nil {
+			return err
+		}
+		ids[uuid] = id
+		return nil
+	}
+
+	if tbl.diff != nil && len(b.Changed) > 0 {
+		if err := l.writeEvents(ctx, tx, ts, tbl, b); err != nil {
+			return nil, fmt.Errorf("write %s: %w", tbl.events, err)
+		}
+	}
+
+	if tbl.kind == townSnapshots.kind {
+		if err := l.writeClaims(ctx, tx, ts, b); err != nil {
+			return nil, fmt.Errorf("write town_claims: %w", err)
+		}
+	}
+
+	rows := make([][]any, len(b.Changed))
+	for i, r := range b.Changed {
+		// snapshot_ts doubles as the initial observed_until.
+		rows[i] = []any{l.server, ts, ts, r.UUID, r.Name, r.Hash, r.Raw, b.Run.ID}
+	}
+	insert := db.Merge{
+		Table:     tbl.table,
+		Columns:   []string{"server_id", "snapshot_ts", "observed_until", tbl.uuidCol, tbl.nameCol, "content_hash", "data", "run_id"},
+		Returning: []string{"id", tbl.uuidCol},
+	}
+	if _, err := insert.Run(ctx, tx, rows, scan); err != nil {
+		return nil, fmt.Errorf("insert %s: %w", tbl.table, err)
+	}
+
+	if len(b.UnchangedIDs) > 0 {
+		tag, err := tx.Exec(ctx,
+			fmt.Sprintf("UPDATE %s SET observed_until = $1 WHERE id = ANY($2)", tbl.table),
+			ts, b.UnchangedIDs)
+		if err != nil {
+			return nil, fmt.Errorf("touch unchanged %s: %w", tbl.table, err)
+		}
+		if tag.RowsAffected() != int64(len(b.UnchangedIDs)) {
+			// Rows vanished under us (e.g. retention); rewrite everything
+			// next tick rather than leave holes in the filled view.
+			l.log.Warn("hash cache out of sync, resetting", "table", tbl.table,
+				"expected", len(b.UnchangedIDs), "updated", tag.RowsAffected())
+			l.hashes[tbl.kind].reset()
+		}
+	}
+
+	if len(b.UnchangedUUIDs) > 0 {
+		res, err := tx.Query(ctx, fmt.Sprintf(`
+			UPDATE %[1]s s SET observed_until = $3
+			FROM (
+				SELECT DISTINCT ON (%[2]s) id FROM %[1]s
+				WHERE server_id = $1 AND %[2]s = ANY($2)
+				ORDER BY %[2]s, snapshot_ts DESC
+			) latest
+			WHERE s.id = latest.id
+			RETURNING s.id, s.%[2]s`, tbl.table, tbl.uuidCol),
+			l.server, b.UnchangedUUIDs, ts)
+		if err != nil {
+			return nil, fmt.Errorf("touch unchanged %s by uuid: %w", tbl.table, err)
+		}
+		for res.Next() {
+			if err := scan(res); err != nil {
+				res.Close()
+				return nil, err
+			}
+		}
+		res.Close()
+		if err := res.Err(); err != nil {
+			return nil, fmt.Errorf("touch unchanged %s by uuid: %w", tbl.table, err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO snapshot_ticks (server_id, kind, snapshot_ts) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`, l.server, tbl.kind, ts); err != nil {
+		return nil, fmt.Errorf("record snapshot tick: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// replaySnapshots applies spooled batches for tbl. It leaves the hash cache
+// alone: live ticks have moved past these rows.
+func (l *LowFreq) replaySnapshots(tbl snapshotTable) func(context.Context, spool.Record) error {
+	return func(ctx context.Context, rec spool.Record) error {
+		var b snapshotBatch
+		if err := json.Unmarshal(rec.Data, &b); err != nil {
+			return spool.Reject(err)
+		}
+		_, err := l.applySnapshots(ctx, rec.TS, tbl, b)
+		return replayErr(err)
+	}
+}
@@ -0,0 +1,69 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/0Mattias/earthmc-scraper/internal/spool"
+)
+
+// replayInterval is how often spooled writes are retried.
+const replayInterval = 15 * time.Second
+
+// replayer pairs a spool queue with the function that applies its records.
+type replayer struct {
+	queue *spool.Queue
+	apply func(context.Context, spool.Record) error
+}
+
+// replaySpool retries spooled writes, oldest first, until ctx is done.
+func replaySpool(ctx context.Context, log *slog.Logger, replayers []replayer) {
+	ticker := time.NewTicker(replayInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, r := range replayers {
+			if _, err := r.queue.Replay(ctx, r.apply); err != nil && ctx.Err() == nil {
+				log.Warn("spool replay failed, will retry", "error", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// rejectCodes are the SQLSTATEs that mean a record's content can never be
+// written: malformed or out-of-range values, and constraint violations.
+// 23514 is also what inserting into a dropped partition raises.
+var rejectCodes = map[string]bool{
+	"22001": true, // string_data_right_truncation
+	"22003": true, // numeric_value_out_of_range
+	"22007": true, // invalid_datetime_format
+	"22008": true, // datetime_field_overflow
+	"22021": true, // character_not_in_repertoire
+	"22P02": true, // invalid_text_representation
+	"22P05": true, // untranslatable_character
+	"23502": true, // not_null_violation
+	"23503": true, // foreign_key_violation
+	"23505": true, // unique_violation
+	"23514": true, // check_violation
+}
+
+// replayErr rejects records the database refused for their content so they
+// cannot block their queue; they move to its dead-letter file. Anything
+// else, such as a lost connection, a missing table or a revoked privilege,
+// is retried until the database is fixed.
+func replayErr(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && rejectCodes[pgErr.Code] {
+		return spool.Reject(err)
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package scraper
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/0Mattias/earthmc-scraper/internal/api"
+)
+
+// Town event types in town_events.event_type.
+const (
+	townResidentJoined = "resident_joined"
+	townResidentLeft   = "resident_left"
+	townMayorChanged   = "mayor_changed"
+	townNationJoined   = "nation_joined"
+	townNationLeft     = "nation_left"
+	townClaimsGained   = "claims_gained"
+	townClaimsLost     = "claims_lost"
+	townBalanceChanged = "balance_changed"
+	townBoardChanged   = "board_changed"
+	townStatusChanged  = "status_changed"
+	townOutlawAdded    = "outlaw_added"
+	townOutlawRemoved  = "outlaw_removed"
+	townTrustedAdded   = "trusted_added"
+	townTrustedRemoved = "trusted_removed"
+)
+
+// townFlags are the status flags reported by status_changed, by attribute.
+var townFlags = []struct {
+	attr string
+	get  func(*api.TownStatus) bool
+}{
+	{"open", func(s *api.TownStatus) bool { return s.IsOpen }},
+	{"public", func(s *api.TownStatus) bool { return s.IsPublic }},
+	{"neutral", func(s *api.TownStatus) bool { return s.IsNeutral }},
+	{"ruined", func(s *api.TownStatus) bool { return s.IsRuined }},
+	{"for_sale", func(s *api.TownStatus) bool { return s.IsForSale }},
+}
+
+// diffTowns is the eventDiff for town snapshots.
+func diffTowns(prevRaw, curRaw json.RawMessage) ([]entityEvent, error) {
+	var prev, cur api.TownDetail
+	if err := json.Unmarshal(prevRaw, &prev); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(curRaw, &cur); err != nil {
+		return nil, err
+	}
+
+	var events []entityEvent
+	events = append(events, entryEvents(townResidentJoined, townResidentLeft, prev.Residents, cur.Residents)...)
+	events = append(events, replacedEvent(townMayorChanged, prev.Mayor, cur.Mayor)...)
+	events = append(events, membershipEvents(townNationJoined, townNationLeft, prev.Nation, cur.Nation)...)
+	events = append(events, claimEvents(prev.Coordinates, cur.Coordinates)...)
+	if prev.Stats != nil && cur.Stats != nil {
+		events = append(events, deltaEvent(townBalanceChanged, prev.Stats.Balance, cur.Stats.Balance)...)
+	}
+	events = append(events, textEvent(townBoardChanged, prev.Board, cur.Board)...)
+	if prev.Status != nil && cur.Status != nil {
+		for _, f := range townFlags {
+			events = append(events, flagEvent(townStatusChanged, f.attr, f.get(prev.Status), f.get(cur.Status))...)
+		}
+	}
+	events = append(events, entryEvents(townOutlawAdded, townOutlawRemoved, prev.Outlaws, cur.Outlaws)...)
+	events = append(events, entryEvents(townTrustedAdded, townTrustedRemoved, prev.Trusted, cur.Trusted)...)
+	return events, nil
+}
+
+// chunk is a claimed town block, in chunk coordinates.
+type chunk struct{ x, z int }
+
+// townChunks returns the town blocks in c as a set. Malformed entries are
+// skipped.
+func townChunks(c *api.TownCoordinates) map[chunk]bool {
+	if c == nil {
+		return nil
+	}
+	set := make(map[chunk]bool, len(c.TownBlocks))
+	for _, b := range c.TownBlocks {
+		if len(b) == 2 {
+			set[chunk{b[0], b[1]}] = true
+		}
+	}
+	return set
+}
+
+// claimEvents reports the chunks claimed and unclaimed between two
+// snapshots, with the count as delta and the chunks as detail.
+func claimEvents(prev, cur *api.TownCoordinates) []entityEvent {
+	if prev == nil || cur == nil {
+		return nil
+	}
+	before, after := townChunks(prev), townChunks(cur)
+
+	var events []entityEvent
+	for _, c := range []struct {
+		typ      string
+		from, to map[chunk]bool
+		sign     float64
+	}{
+		{townClaimsGained, before, after, 1},
+		{townClaimsLost, after, before, -1},
+	} {
+		var changed [][2]int
+		for ch := range c.to {
+			if !c.from[ch] {
+				changed = append(changed, [2]int{ch.x, ch.z})
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		sort.Slice(changed, func(i, j int) bool {
+			if changed[i][0] != changed[j][0] {
+				return changed[i][0] < changed[j][0]
+			}
+			return changed[i][1] < changed[j][1]
+		})
+		detail, _ := json.Marshal(changed)
+		events = append(events, entityEvent{
+			Type:   c.typ,
+			Delta:  ptr(c.sign * float64(len(changed))),
+			Detail: detail,
+		})
+	}
+	return events
+}
@@ -0,0 +1,92 @@
+package scraper
+
+import "testing"
+
+func TestDiffTowns(t *testing.T) {
+	runDiffCases(t, diffTowns, []diffCase{
+		{
+			name: "unchanged",
+			prev: `{"name":"Tokyo","mayor":{"name":"Fix","uuid":"p1"},"residents":[{"name":"Fix","uuid":"p1"}],"stats":{"balance":10}}`,
+			cur:  `{"name":"Tokyo","mayor":{"name":"Fix","uuid":"p1"},"residents":[{"name":"Fix","uuid":"p1"}],"stats":{"balance":10}}`,
+		},
+		{
+			name: "residents joined and left",
+			prev: `{"residents":[{"name":"Fix","uuid":"p1"},{"name":"Owen3H","uuid":"p2"}]}`,
+			cur:  `{"residents":[{"name":"Fix","uuid":"p1"},{"name":"Kuroi","uuid":"p3"}]}`,
+			want: []string{
+				"resident_joined related=Kuroi uuid=p3",
+				"resident_left related=Owen3H uuid=p2",
+			},
+		},
+		{
+			name: "renamed resident is not a join",
+			prev: `{"residents":[{"name":"Fix","uuid":"p1"}]}`,
+			cur:  `{"residents":[{"name":"Fix2","uuid":"p1"}]}`,
+		},
+		{
+			name: "mayor changed",
+			prev: `{"mayor":{"name":"Fix","uuid":"p1"}}`,
+			cur:  `{"mayor":{"name":"Owen3H","uuid":"p2"}}`,
+			want: []string{"mayor_changed related=Owen3H uuid=p2 old=Fix new=Owen3H"},
+		},
+		{
+			name: "moved nation",
+			prev: `{"nation":{"name":"Japan","uuid":"n1"}}`,
+			cur:  `{"nation":{"name":"Korea","uuid":"n2"}}`,
+			want: []string{
+				"nation_left related=Japan uuid=n1",
+				"nation_joined related=Korea uuid=n2",
+			},
+		},
+		{
+			name: "left nation",
+			prev: `{"nation":{"name":"Japan","uuid":"n1"}}`,
+			cur:  `{"nation":null}`,
+			want: []string{"nation_left related=Japan uuid=n1"},
+		},
+		{
+			name: "claims gained and lost",
+			prev: `{"coordinates":{"townBlocks":[[0,0],[0,1],[5,5]]}}`,
+			cur:  `{"coordinates":{"townBlocks":[[0,0],[2,-1],[0,1],[-3,4]]}}`,
+			want: []string{
+				"claims_gained delta=2 detail=[[-3,4],[2,-1]]",
+				"claims_lost delta=-1 detail=[[5,5]]",
+			},
+		},
+		{
+			name: "claims need coordinates on both sides",
+			prev: `{}`,
+			cur:  `{"coordinates":{"townBlocks":[[0,0]]}}`,
+		},
+		{
+			name: "balance changed",
+			prev: `{"stats":{"balance":100.5}}`,
+			cur:  `{"stats":{"balance":90}}`,
+			want: []string{"balance_changed old=100.5 new=90 delta=-10.5"},
+		},
+		{
+			name: "board set",
+			prev: `{"board":null}`,
+			cur:  `{"board":"Welcome"}`,
+			want: []string{"board_changed new=Welcome"},
+		},
+		{
+			name: "status flags toggled",
+			prev: `{"status":{"isOpen":false,"isPublic":true,"isCapital":false}}`,
+			cur:  `{"status":{"isOpen":true,"isPublic":false,"isCapital":true}}`,
+			want: []string{
+				"status_changed attr=open old=false new=true",
+				"status_changed attr=public old=true new=false",
+			},
+		},
+		{
+			name: "outlaws and trusted",
+			prev: `{"outlaws":[{"name":"Grief","uuid":"p9"}],"trusted":[]}`,
+			cur:  `{"outlaws":[],"trusted":[{"name":"Owen3H","uuid":"p2"}]}`,
+			want: []string{
+				"outlaw_removed related=Grief uuid=p9",
+				"trusted_added related=Owen3H uuid=p2",
+			},
+		},
+	})
+}
@@ -0,0 +1,632 @@
+// Package spool is a write-ahead queue on local disk for batches the
+// database could not take. Each queue is one ordered stream (e.g. a
+// server's activity ticks): while it holds records, new batches are appended
+// behind them instead of written directly, so replay preserves the order
+// the change-only writers depend on.
+package spool
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// segmentLimit is the size at which a queue starts a new segment file, so
+// replayed records free disk space as they go.
+const segmentLimit = 16 << 20
+
+// deadLetterFile holds a queue's rejected records, in its directory.
+const deadLetterFile = "rejected"
+
+// frameHeader is the length and CRC-32 of the payload that follows.
+const frameHeader = 8
+
+// maxFrame bounds a frame's length, so a corrupt header cannot trigger a
+// huge allocation.
+const maxFrame = 1 << 30
+
+// ErrFull is returned when appending would take the spool past its size cap.
+var ErrFull = errors.New("spool full")
+
+// Record is one spooled batch, replayed with its original timestamp.
+type Record struct {
+	TS   time.Time       `json:"ts"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Stats describes one queue for /metrics.
+type Stats struct {
+	Records  int64      `json:"records"`
+	Bytes    int64      `json:"bytes"`
+	Oldest   *time.Time `json:"oldest,omitempty"`
+	Dropped  int64      `json:"dropped"`
+	Rejected int64      `json:"rejected"`
+	Replayed int64      `json:"replayed"`
+}
+
+// Spool is a directory of queues sharing one size cap.
+type Spool struct {
+	dir      string
+	maxBytes int64 // 0 means unlimited
+	bytes    atomic.Int64
+
+	mu     sync.Mutex
+	queues map[string]*Queue
+}
+
+// Open loads every queue left under dir by a previous run. A nil *Spool is
+// valid and spools nothing.
+func Open(dir string, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+	s := &Spool{dir: dir, maxBytes: maxBytes, queues: make(map[string]*Queue)}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".seg") {
+			return err
+		}
+		name, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		if _, ok := s.queues[name]; ok {
+			return nil
+		}
+		q := s.newQueue(name)
+		if err := q.load(); err != nil {
+			return fmt.Errorf("load spool queue %s: %w", name, err)
+		}
+		s.queues[name] = q
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Queue returns the named queue, e.g. "aurora/activity", creating it on
+// first use. It returns nil on a nil *Spool.
+func (s *Spool) Queue(name string) *Queue {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.queues[name]
+	if !ok {
+		q = s.newQueue(name)
+		s.queues[name] = q
+	}
+	return q
+}
+
+// Stats reports every queue by name.
+func (s *Spool) Stats() map[string]Stats {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	queues := make([]*Queue, 0, len(s.queues))
+	for _, q := range s.queues {
+		queues = append(queues, q)
+	}
+	s.mu.Unlock()
+
+	out := make(map[string]Stats, len(queues))
+	for _, q := range queues {
+		out[q.name] = q.Stats()
+	}
+	return out
+}
+
+func (s *Spool) newQueue(name string) *Queue {
+	return &Queue{spool: s, name: name, dir: filepath.Join(s.dir, filepath.FromSlash(name))}
+}
+
+// Queue is one ordered stream of spooled records, stored as numbered segment
+// files of framed records plus a cursor marking how far replay has got.
+// Records the database rejected are moved to a dead-letter file beside them.
+type Queue struct {
+	spool *Spool
+	name  string
+	dir   string
+
+	replayMu sync.Mutex // held by the one replayer
+	mu       sync.Mutex
+	segs     []int64 // segment numbers on disk, oldest first
+	size     map[int64]int64
+	w        *os.File // append handle on the newest segment
+	r        *os.File // read handle on the cursor's segment
+
+	cur     int64 // cursor segment
+	off     int64 // cursor offset within it
+	head    *Record
+	headLen int64
+
+	records  int64
+	dropped  int64
+	rejected int64
+	replayed int64
+}
+
+// Reject marks a replay error as permanent: the record is moved to the
+// queue's dead-letter file instead of retried, so one bad batch cannot block
+// its queue.
+func Reject(err error) error {
+	return &rejectError{err}
+}
+
+type rejectError struct{ err error }
+
+func (e *rejectError) Error() string { return e.err.Error() }
+func (e *rejectError) Unwrap() error { return e.err }
+
+// Write runs write directly while the queue is empty. If the queue already
+// holds records, or write fails, payload is appended instead and spooled is
+// true. The returned error is non-nil only when the batch was lost.
+// A nil *Queue just runs write.
+func (q *Queue) Write(ts time.Time, payload any, write func() error) (spooled bool, err error) {
+	if q == nil {
+		return false, write()
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var writeErr error
+	if q.records == 0 {
+		if writeErr = write(); writeErr == nil {
+			return false, nil
+		}
+	}
+	if err := q.append(ts, payload); err != nil {
+		if errors.Is(err, ErrFull) {
+			q.dropped++
+		}
+		return false, errors.Join(writeErr, err)
+	}
+	if q.records == 1 {
+		slog.Warn("spooling writes until the database recovers", "queue", q.name, "error", writeErr)
+	}
+	return true, nil
+}
+
+// Replay applies queued records oldest first until the queue is empty, ctx
+// is done or apply fails. A failed record stays at the head to be retried,
+// unless apply rejected it with Reject.
+func (q *Queue) Replay(ctx context.Context, apply func(context.Context, Record) error) (int, error) {
+	if q == nil {
+		return 0, nil
+	}
+	n := 0
+	for ctx.Err() == nil {
+		done, err := q.replayOne(ctx, apply)
+		if err != nil || done {
+			if done && n > 0 {
+				slog.Info("spool drained", "queue", q.name, "replayed", n)
+			}
+			return n, err
+		}
+		n++
+	}
+	return n, ctx.Err()
+}
+
+func (q *Queue) replayOne(ctx context.Context, apply func(context.Context, Record) error) (done bool, err error) {
+	q.replayMu.Lock()
+	defer q.replayMu.Unlock()
+
+	q.mu.Lock()
+	head, err := q.peek()
+	q.mu.Unlock()
+	if err != nil || head == nil {
+		return true, err
+	}
+	rec := *head
+
+	// apply runs without q.mu so live writes and Stats do not wait on the
+	// database. Only the replayer moves the cursor, so the head stays put;
+	// appends meanwhile land behind it.
+	applyErr := apply(ctx, rec)
+	var rej *rejectError
+	if applyErr != nil && !errors.As(applyErr, &rej) {
+		return false, applyErr
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if applyErr != nil {
+		slog.Error("moving rejected spool record to dead letters", "queue", q.name, "ts", rec.TS, "error", applyErr)
+		if err := q.deadLetter(rec, applyErr); err != nil {
+			return false, err
+		}
+		q.rejected++
+	} else {
+		q.replayed++
+	}
+	return false, q.advance()
+}
+
+// deadRecord is a rejected record with the reason, as kept in the
+// dead-letter file.
+type deadRecord struct {
+	Record
+	Error string `json:"error"`
+}
+
+// deadLetter appends a rejected record to the queue's dead-letter file,
+// framed like a segment, for an operator to inspect or replay by hand. The
+// file is outside the size cap and is never removed by the queue.
+func (q *Queue) deadLetter(rec Record, reason error) error {
+	b, err := json.Marshal(deadRecord{Record: rec, Error: reason.Error()})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(q.dir, deadLetterFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(frame(b)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Stats reports the queue's depth.
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st := Stats{Records: q.records, Dropped: q.dropped, Rejected: q.rejected, Replayed: q.replayed}
+	for _, sz := range q.size {
+		st.Bytes += sz
+	}
+	if q.records > 0 {
+		if rec, err := q.peek(); err == nil && rec != nil {
+			ts := rec.TS
+			st.Oldest = &ts
+		}
+	}
+	return st
+}
+
+// load picks the queue up from disk: segments, the cursor, and a count of
+// the records left. A torn frame at the end of the newest segment (a crash
+// mid-append) is truncated away.
+func (q *Queue) load() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+	q.size = make(map[int64]int64)
+	for _, e := range entries {
+		num, ok := strings.CutSuffix(e.Name(), ".seg")
+		if !ok {
+			continue
+		}
+		seq, err := strconv.ParseInt(num, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		q.segs = append(q.segs, seq)
+		q.size[seq] = info.Size()
+		q.spool.bytes.Add(info.Size())
+	}
+	sort.Slice(q.segs, func(i, j int) bool { return q.segs[i] < q.segs[j] })
+	if len(q.segs) == 0 {
+		return nil
+	}
+
+	q.cur, q.off = q.segs[0], 0
+	if data, err := os.ReadFile(filepath.Join(q.dir, "cursor")); err == nil {
+		var seg, off int64
+		if _, err := fmt.Sscanf(string(data), "%d %d", &seg, &off); err == nil {
+			if sz, ok := q.size[seg]; ok && off <= sz {
+				q.cur, q.off = seg, off
+			}
+		}
+	}
+
+	// Segments before the cursor were fully replayed before a restart.
+	for q.segs[0] < q.cur {
+		if err := os.Remove(q.segPath(q.segs[0])); err != nil {
+			return err
+		}
+		q.spool.bytes.Add(-q.size[q.segs[0]])
+		delete(q.size, q.segs[0])
+		q.segs = q.segs[1:]
+	}
+
+	for _, seq := range q.segs {
+		start := int64(0)
+		if seq == q.cur {
+			start = q.off
+		}
+		n, end, err := countFrames(q.segPath(seq), start)
+		if err != nil {
+			return err
+		}
+		q.records += n
+		if seq == q.segs[len(q.segs)-1] && end < q.size[seq] {
+			slog.Warn("truncating torn spool record", "queue", q.name, "segment", seq, "bytes", q.size[seq]-end)
+			if err := os.Truncate(q.segPath(seq), end); err != nil {
+				return err
+			}
+			q.spool.bytes.Add(end - q.size[seq])
+			q.size[seq] = end
+		}
+	}
+	if q.records == 0 {
+		return q.reset()
+	}
+	slog.Info("spool has records to replay", "queue", q.name, "records", q.records)
+	return nil
+}
+
+// countFrames counts the intact frames in a segment from offset start and
+// returns where the last one ends.
+func countFrames(path string, start int64) (n, end int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	br := bufio.NewReader(f)
+	end = start
+	for {
+		payload, err := readFrame(br)
+		if err != nil {
+			// io.EOF or a torn/corrupt frame: either way the intact
+			// records end here.
+			return n, end, nil
+		}
+		n++
+		end += frameHeader + int64(len(payload))
+	}
+}
+
+func (q *Queue) append(ts time.Time, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	rec, err := json.Marshal(Record{TS: ts, Data: data})
+	if err != nil {
+		return err
+	}
+	buf := frame(rec)
+	n := int64(len(buf))
+
+	if limit := q.spool.maxBytes; limit > 0 && q.spool.bytes.Load()+n > limit {
+		return ErrFull
+	}
+
+	if q.w == nil || q.size[q.newest()]+n > segmentLimit {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := q.w.Write(buf); err != nil {
+		return err
+	}
+	if err := q.w.Sync(); err != nil {
+		return err
+	}
+	q.size[q.newest()] += n
+	q.spool.bytes.Add(n)
+	q.records++
+	return nil
+}
+
+// rotate starts a new segment for appends.
+func (q *Queue) rotate() error {
+	if err := os.MkdirAll(q.dir, 0o755); err != nil {
+		return err
+	}
+	if q.size == nil {
+		q.size = make(map[int64]int64)
+	}
+	seq := int64(1)
+	if len(q.segs) > 0 {
+		seq = q.newest() + 1
+	}
+	f, err := os.OpenFile(q.segPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if q.w != nil {
+		q.w.Close()
+	}
+	q.w = f
+	if len(q.segs) == 0 {
+		q.cur, q.off = seq, 0
+	}
+	q.segs = append(q.segs, seq)
+	q.size[seq] = 0
+	return nil
+}
+
+// peek reads the record at the cursor, or returns nil when there is none.
+// Finished or corrupt segments behind the newest are removed on the way.
+func (q *Queue) peek() (*Record, error) {
+	if q.head != nil {
+		return q.head, nil
+	}
+	for q.records > 0 {
+		if q.r == nil {
+			f, err := os.Open(q.segPath(q.cur))
+			if err != nil {
+				return nil, err
+			}
+			q.r = f
+		}
+		payload, err := readFrame(io.NewSectionReader(q.r, q.off, q.size[q.cur]-q.off))
+		if err == nil {
+			var rec Record
+			if err := json.Unmarshal(payload, &rec); err != nil {
+				return nil, fmt.Errorf("decode spool record: %w", err)
+			}
+			q.head, q.headLen = &rec, frameHeader+int64(len(payload))
+			return q.head, nil
+		}
+		if q.cur == q.newest() {
+			// Appends are whole frames under q.mu, so this is only
+			// reachable if the count drifted; start over empty.
+			slog.Warn("spool queue ended early, resetting", "queue", q.name, "expected", q.records, "error", err)
+			q.records = 0
+			return nil, q.reset()
+		}
+		if !errors.Is(err, io.EOF) {
+			slog.Warn("skipping corrupt spool segment tail", "queue", q.name, "segment", q.cur, "error", err)
+		}
+		if err := q.dropSegment(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// advance moves the cursor past the head record and persists it.
+func (q *Queue) advance() error {
+	q.off += q.headLen
+	q.head = nil
+	q.records--
+	if q.records == 0 {
+		return q.reset()
+	}
+	if q.off >= q.size[q.cur] && q.cur != q.newest() {
+		return q.dropSegment()
+	}
+	return q.saveCursor()
+}
+
+// dropSegment deletes the cursor's segment and moves to the next one.
+func (q *Queue) dropSegment() error {
+	if q.r != nil {
+		q.r.Close()
+		q.r = nil
+	}
+	if err := os.Remove(q.segPath(q.cur)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	q.spool.bytes.Add(-q.size[q.cur])
+	delete(q.size, q.cur)
+	q.segs = q.segs[1:]
+	q.cur, q.off = q.segs[0], 0
+	return q.saveCursor()
+}
+
+// reset removes every segment once the queue is empty.
+func (q *Queue) reset() error {
+	if q.r != nil {
+		q.r.Close()
+		q.r = nil
+	}
+	if q.w != nil {
+		q.w.Close()
+		q.w = nil
+	}
+	for _, seq := range q.segs {
+		if err := os.Remove(q.segPath(seq)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		q.spool.bytes.Add(-q.size[seq])
+	}
+	q.segs, q.size = nil, make(map[int64]int64)
+	q.cur, q.off, q.head = 0, 0, nil
+	if err := os.Remove(filepath.Join(q.dir, "cursor")); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// saveCursor records replay progress, so a restart does not replay (and
+// duplicate) records already applied.
+func (q *Queue) saveCursor() error {
+	path := filepath.Join(q.dir, "cursor")
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%d %d\n", q.cur, q.off); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (q *Queue) newest() int64 {
+	return q.segs[len(q.segs)-1]
+}
+
+func (q *Queue) segPath(seq int64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%016d.seg", seq))
+}
+
+// frame prefixes payload with its length and checksum.
+func frame(payload []byte) []byte {
+	b := make([]byte, frameHeader+len(payload))
+	binary.BigEndian.PutUint32(b[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(b[4:8], crc32.ChecksumIEEE(payload))
+	copy(b[frameHeader:], payload)
+	return b
+}
+
+// readFrame reads one length-prefixed, checksummed payload.
+func readFrame(r io.Reader) ([]byte, error) {
+	var hdr [frameHeader]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("torn frame header: %w", err)
+		}
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[0:4])
+	if size > maxFrame {
+		return nil, fmt.Errorf("frame length %d out of range", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("torn frame: %w", err)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(hdr[4:8]) {
+		return nil, errors.New("frame checksum mismatch")
+	}
+	return payload, nil
+}
@@ -0,0 +1,327 @@
+package spool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var errDown = errors.New("database down")
+
+func failing() error { return errDown }
+
+func mustOpen(t *testing.T, dir string, maxBytes int64) *Spool {
+	t.Helper()
+	s, err := Open(dir, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// spoolAll queues each payload behind a failing write.
+func spoolAll(t *testing.T, q *Queue, payloads ...int) {
+	t.Helper()
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, p := range payloads {
+		spooled, err := q.Write(base.Add(time.Duration(p)*time.Second), p, failing)
+		if err != nil || !spooled {
+			t.Fatalf("Write(%d) = %v, %v; want spooled", p, spooled, err)
+		}
+	}
+}
+
+// collect is an apply func that records payloads in order.
+func collect(got *[]int) func(context.Context, Record) error {
+	return func(_ context.Context, rec Record) error {
+		var p int
+		if err := json.Unmarshal(rec.Data, &p); err != nil {
+			return err
+		}
+		*got = append(*got, p)
+		return nil
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	for _, payload := range []string{"", "x", `{"ts":"2026-03-01T12:00:00Z","data":[1,2,3]}`} {
+		got, err := readFrame(bytes.NewReader(frame([]byte(payload))))
+		if err != nil {
+			t.Fatalf("readFrame(%q): %v", payload, err)
+		}
+		if string(got) != payload {
+			t.Errorf("readFrame = %q, want %q", got, payload)
+		}
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	good := frame([]byte("payload"))
+	corrupt := bytes.Clone(good)
+	corrupt[len(corrupt)-1] ^= 0xff
+	huge := bytes.Clone(good)
+	huge[0] = 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "EOF"},
+		{"torn header", good[:5], "torn frame header"},
+		{"torn payload", good[:len(good)-2], "torn frame"},
+		{"checksum mismatch", corrupt, "checksum mismatch"},
+		{"length out of range", huge, "out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readFrame(bytes.NewReader(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("readFrame error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteGoesDirectWhileEmpty(t *testing.T) {
+	q := mustOpen(t, t.TempDir(), 0).Queue("aurora/activity")
+	calls := 0
+	spooled, err := q.Write(time.Now(), 1, func() error { calls++; return nil })
+	if err != nil || spooled || calls != 1 {
+		t.Fatalf("Write = %v, %v with %d calls; want a direct write", spooled, err, calls)
+	}
+	if st := q.Stats(); st.Records != 0 || st.Bytes != 0 {
+		t.Errorf("stats after a direct write = %+v, want empty", st)
+	}
+}
+
+func TestWriteQueuesBehindRecords(t *testing.T) {
+	q := mustOpen(t, t.TempDir(), 0).Queue("aurora/activity")
+	spoolAll(t, q, 1)
+
+	// Once a record is queued, later writes must not jump ahead of it.
+	spooled, err := q.Write(time.Now(), 2, func() error {
+		t.Fatal("write called while records are queued")
+		return nil
+	})
+	if err != nil || !spooled {
+		t.Fatalf("Write = %v, %v; want spooled", spooled, err)
+	}
+	if st := q.Stats(); st.Records != 2 || st.Oldest == nil {
+		t.Errorf("stats = %+v, want 2 records with an oldest timestamp", st)
+	}
+}
+
+func TestReplayInOrder(t *testing.T) {
+	q := mustOpen(t, t.TempDir(), 0).Queue("aurora/activity")
+	spoolAll(t, q, 1, 2, 3)
+
+	var got []int
+	n, err := q.Replay(context.Background(), collect(&got))
+	if err != nil || n != 3 {
+		t.Fatalf("Replay = %d, %v; want 3", n, err)
+	}
+	if !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("replayed %v, want [1 2 3]", got)
+	}
+	if st := q.Stats(); st.Records != 0 || st.Bytes != 0 || st.Replayed != 3 {
+		t.Errorf("stats = %+v, want empty with 3 replayed", st)
+	}
+	if entries, _ := os.ReadDir(q.dir); len(entries) != 0 {
+		t.Errorf("queue dir holds %d files after draining, want none", len(entries))
+	}
+}
+
+func TestReplayKeepsFailedRecord(t *testing.T) {
+	q := mustOpen(t, t.TempDir(), 0).Queue("aurora/activity")
+	spoolAll(t, q, 1, 2)
+
+	n, err := q.Replay(context.Background(), func(context.Context, Record) error { return errDown })
+	if !errors.Is(err, errDown) || n != 0 {
+		t.Fatalf("Replay = %d, %v; want 0 and the apply error", n, err)
+	}
+
+	var got []int
+	if _, err := q.Replay(context.Background(), collect(&got)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("replayed %v after a failure, want [1 2]", got)
+	}
+}
+
+func TestReplayDeadLettersRejected(t *testing.T) {
+	q := mustOpen(t, t.TempDir(), 0).Queue("aurora/activity")
+	spoolAll(t, q, 1, 2, 3)
+
+	var got []int
+	apply := func(ctx context.Context, rec Record) error {
+		if string(rec.Data) == "2" {
+			return Reject(errors.New("bad row"))
+		}
+		return collect(&got)(ctx, rec)
+	}
+	if _, err := q.Replay(context.Background(), apply); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Errorf("replayed %v, want [1 3]", got)
+	}
+	if st := q.Stats(); st.Rejected != 1 || st.Replayed != 2 || st.Records != 0 {
+		t.Errorf("stats = %+v, want 1 rejected and 2 replayed", st)
+	}
+
+	data, err := os.ReadFile(filepath.Join(q.dir, deadLetterFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := readFrame(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dead deadRecord
+	if err := json.Unmarshal(payload, &dead); err != nil {
+		t.Fatal(err)
+	}
+	if string(dead.Data) != "2" || dead.Error != "bad row" {
+		t.Errorf("dead letter = %s with error %q, want record 2 with %q", dead.Data, dead.Error, "bad row")
+	}
+}
+
+// TestReplayDoesNotHoldQueue checks that writes and stats go through while
+// a record is being applied.
+func TestReplayDoesNotHoldQueue(t *testing.T) {
+	q := mustOpen(t, t.TempDir(), 0).Queue("aurora/activity")
+	spoolAll(t, q, 1)
+
+	var got []int
+	apply := func(ctx context.Context, rec Record) error {
+		if len(got) == 0 {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				q.Stats()
+				q.Write(time.Now(), 2, failing)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Write and Stats blocked during apply")
+			}
+		}
+		return collect(&got)(ctx, rec)
+	}
+	if _, err := q.Replay(context.Background(), apply); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("replayed %v, want [1 2]", got)
+	}
+}
+
+func TestReopenResumesAtCursor(t *testing.T) {
+	dir := t.TempDir()
+	q := mustOpen(t, dir, 0).Queue("aurora/activity")
+	spoolAll(t, q, 1, 2, 3)
+
+	// Apply one record, then fail as if the worker stopped.
+	var got []int
+	applied := 0
+	q.Replay(context.Background(), func(ctx context.Context, rec Record) error {
+		if applied == 1 {
+			return errDown
+		}
+		applied++
+		return collect(&got)(ctx, rec)
+	})
+
+	q = mustOpen(t, dir, 0).Queue("aurora/activity")
+	if st := q.Stats(); st.Records != 2 {
+		t.Fatalf("reopened with %d records, want 2", st.Records)
+	}
+	if _, err := q.Replay(context.Background(), collect(&got)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("replayed %v across a restart, want [1 2 3] with no duplicates", got)
+	}
+}
+
+func TestReopenTruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	q := mustOpen(t, dir, 0).Queue("aurora/activity")
+	spoolAll(t, q, 1, 2)
+
+	seg := q.segPath(q.newest())
+	intact, err := os.Stat(seg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A crash mid-append leaves part of a frame at the end.
+	torn := frame([]byte(`{"ts":"2026-03-01T12:00:03Z","data":3}`))
+	f, err := os.OpenFile(seg, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(torn[:len(torn)-4])
+	f.Close()
+
+	s := mustOpen(t, dir, 0)
+	q = s.Queue("aurora/activity")
+	if st := q.Stats(); st.Records != 2 || st.Bytes != intact.Size() {
+		t.Errorf("reopened stats = %+v, want 2 records in %d bytes", st, intact.Size())
+	}
+	if info, _ := os.Stat(seg); info.Size() != intact.Size() {
+		t.Errorf("segment is %d bytes, want the torn frame truncated to %d", info.Size(), intact.Size())
+	}
+
+	var got []int
+	if _, err := q.Replay(context.Background(), collect(&got)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []int{1, 2}) {
+		t.Errorf("replayed %v, want [1 2]", got)
+	}
+}
+
+func TestWriteFullSpool(t *testing.T) {
+	s := mustOpen(t, t.TempDir(), 64)
+	q := s.Queue("aurora/activity")
+
+	// The first batch is lost along with the write that failed.
+	big := strings.Repeat("x", 64)
+	spooled, err := q.Write(time.Now(), big, failing)
+	if spooled || !errors.Is(err, ErrFull) || !errors.Is(err, errDown) {
+		t.Fatalf("Write past the cap = %v, %v; want ErrFull joined with the write error", spooled, err)
+	}
+
+	spoolAll(t, q, 1)
+	spooled, err = q.Write(time.Now(), big, failing)
+	if spooled || !errors.Is(err, ErrFull) {
+		t.Fatalf("Write past the cap behind a record = %v, %v; want ErrFull", spooled, err)
+	}
+	if st := s.Stats()["aurora/activity"]; st.Dropped != 2 || st.Records != 1 {
+		t.Errorf("stats = %+v, want 1 record and 2 dropped", st)
+	}
+}
+
+func TestNilSpool(t *testing.T) {
+	var s *Spool
+	q := s.Queue("aurora/activity")
+	if q != nil {
+		t.Fatal("nil spool returned a queue")
+	}
+	if _, err := q.Write(time.Now(), 1, failing); !errors.Is(err, errDown) {
+		t.Errorf("nil queue Write = %v, want the write error", err)
+	}
+	if n, err := q.Replay(context.Background(), nil); n != 0 || err != nil {
+		t.Errorf("nil queue Replay = %d, %v", n, err)
+	}
+}